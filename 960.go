@@ -9,22 +9,192 @@ import (
 	"strings"
 )
 
-var startFENs960G map[string]bool
+const (
+	Num960StartPositions = 960
+	// the standard chess start position, RNBQKBNR
+	Standard960Id = 518
+)
+
+// indexed by start position number
+var startFENs960G []string
 
 func init960() {
-	startFENs960G = make(map[string]bool)
-	str := "rrnnbbqk"
-	backrank := []rune(str)
-	addPermutations(backrank, 0, len(backrank)-1, startFENs960G)
+	startFENs960G = make([]string, 0, Num960StartPositions)
+	for id := 0; id < Num960StartPositions; id++ {
+		backrank, _ := Chess960Backrank(id)
+		startFENs960G = append(startFENs960G, chess960FEN(backrank, backrank))
+	}
 }
 
+// Get960StartFENs returns every Chess960 start FEN ordered by start position
+// number
 func Get960StartFENs() []string {
-	outFENs := make([]string, 0)
-	for fen, _ := range startFENs960G {
-		outFENs = append(outFENs, fen)
+	return append([]string{}, startFENs960G...)
+}
+
+// the squares of the knights among the 5 squares left after placing the
+// bishops and queen, indexed by the knight code of a start position number
+var knightPlacements960 = [][2]int{{0, 1}, {0, 2}, {0, 3}, {0, 4}, {1, 2},
+	{1, 3}, {1, 4}, {2, 3}, {2, 4}, {3, 4}}
+
+// Chess960Backrank returns white's back rank, e.g. RNBQKBNR, for start
+// position number id (0-959) in the standard Scharnagl numbering
+func Chess960Backrank(id int) (string, error) {
+	if id < 0 || id >= Num960StartPositions {
+		return "", fmt.Errorf("invalid Chess960 start position %v; expected 0-%v",
+			id, Num960StartPositions-1)
+	}
+
+	backrank := []rune("........")
+	backrank[2*(id%4)+1] = 'B'
+	id /= 4
+	backrank[2*(id%4)] = 'B'
+	id /= 4
+	placeOnEmpty(backrank, id%6, 'Q')
+	id /= 6
+	knights := knightPlacements960[id]
+	// place the 2nd knight first so the 1st knight's index is unaffected
+	placeOnEmpty(backrank, knights[1], 'N')
+	placeOnEmpty(backrank, knights[0], 'N')
+	for _, piece := range "RKR" {
+		placeOnEmpty(backrank, 0, piece)
+	}
+
+	return string(backrank), nil
+}
+
+// placeOnEmpty puts piece on the nth (from 0) empty square of backrank
+func placeOnEmpty(backrank []rune, n int, piece rune) {
+	for ii := range backrank {
+		if backrank[ii] != '.' {
+			continue
+		}
+		if n == 0 {
+			backrank[ii] = piece
+			return
+		}
+		n--
+	}
+}
+
+// Chess960BackrankId returns the start position number of white's back rank,
+// e.g. 518 for RNBQKBNR
+func Chess960BackrankId(backrank string) (int, error) {
+	pieces := []rune(strings.ToLower(backrank))
+	if len(pieces) != 8 || strings.Count(string(pieces), "r") != 2 ||
+		strings.Count(string(pieces), "n") != 2 ||
+		strings.Count(string(pieces), "b") != 2 ||
+		strings.Count(string(pieces), "q") != 1 ||
+		strings.Count(string(pieces), "k") != 1 ||
+		!isLegalBackrank(pieces, len(pieces)-1) {
+
+		return -1, fmt.Errorf("%v is not a Chess960 back rank", backrank)
+	}
+
+	var lightBishop, darkBishop int
+	for ii, piece := range pieces {
+		if piece != 'b' {
+			continue
+		}
+		if ii%2 == 1 {
+			lightBishop = ii / 2
+		} else {
+			darkBishop = ii / 2
+		}
+	}
+
+	// the index of the queen and knights among the squares the bishops, or
+	// the bishops and queen, leave empty
+	queen := -1
+	knights := make([]int, 0, 2)
+	withoutBishops := 0
+	withoutQueen := 0
+	for _, piece := range pieces {
+		switch piece {
+		case 'b':
+			continue
+		case 'q':
+			queen = withoutBishops
+			withoutBishops++
+			continue
+		case 'n':
+			knights = append(knights, withoutQueen)
+		}
+		withoutBishops++
+		withoutQueen++
+	}
+	knightCode := 0
+	for code, placement := range knightPlacements960 {
+		if placement[0] == knights[0] && placement[1] == knights[1] {
+			knightCode = code
+		}
+	}
+
+	return ((knightCode*6+queen)*4+darkBishop)*4 + lightBishop, nil
+}
+
+// Chess960StartFEN returns the start FEN for start position number id
+func Chess960StartFEN(id int) (string, error) {
+	if id < 0 || id >= Num960StartPositions {
+		return "", fmt.Errorf("invalid Chess960 start position %v; expected 0-%v",
+			id, Num960StartPositions-1)
+	}
+
+	return startFENs960G[id], nil
+}
+
+// DoubleChess960StartFEN returns the start FEN of Double Chess960 in which
+// white and black may each have a different start position
+func DoubleChess960StartFEN(whiteId int, blackId int) (string, error) {
+	white, err := Chess960Backrank(whiteId)
+	if err != nil {
+		return "", err
+	}
+	black, err := Chess960Backrank(blackId)
+	if err != nil {
+		return "", err
+	}
+
+	return chess960FEN(white, black), nil
+}
+
+// Chess960Ids returns the start position numbers of white's and black's back
+// ranks in a Chess960 or Double Chess960 start FEN
+func Chess960Ids(fen string) (int, int, error) {
+	fields := strings.Fields(fen)
+	if len(fields) == 0 {
+		return -1, -1, fmt.Errorf("empty FEN")
+	}
+	ranks := strings.Split(fields[0], "/")
+	if len(ranks) != 8 || ranks[1] != "pppppppp" || ranks[6] != "PPPPPPPP" ||
+		strings.Join(ranks[2:6], "/") != "8/8/8/8" {
+
+		return -1, -1, fmt.Errorf("%v is not a Chess960 start position", fen)
+	}
+	if ranks[7] != strings.ToUpper(ranks[7]) ||
+		ranks[0] != strings.ToLower(ranks[0]) {
+
+		return -1, -1, fmt.Errorf("%v is not a Chess960 start position", fen)
+	}
+
+	whiteId, err := Chess960BackrankId(ranks[7])
+	if err != nil {
+		return -1, -1, err
+	}
+	blackId, err := Chess960BackrankId(ranks[0])
+	if err != nil {
+		return -1, -1, err
 	}
 
-	return outFENs
+	return whiteId, blackId, nil
+}
+
+// chess960FEN returns the start FEN with the given back ranks in X-FEN. a
+// start position has exactly 1 rook on each side of the king, which X-FEN
+// always names with KQkq; see ConvertCastling for Shredder-FEN.
+func chess960FEN(white string, black string) string {
+	return fmt.Sprintf("%v/pppppppp/8/8/8/8/PPPPPPPP/%v w KQkq - 0 1",
+		strings.ToLower(black), strings.ToUpper(white))
 }
 
 func isKingBetweenRooks(backrank []rune, lastIdx int) bool {
@@ -75,26 +245,3 @@ func isLegalBackrank(backrank []rune, lastIdx int) bool {
 	return isKingBetweenRooks(backrank, lastIdx) &&
 		hasOppositeColorBishops(backrank, lastIdx)
 }
-
-func addPermutations(backrank []rune, leftIdx int, lastIdx int,
-	startFENs960L map[string]bool) {
-
-	if leftIdx == lastIdx {
-		if isLegalBackrank(backrank, lastIdx) {
-			fen := fmt.Sprintf("%v/pppppppp/8/8/8/8/PPPPPPPP/%v w KQkq - 0 1",
-				string(backrank), strings.ToUpper(string(backrank)))
-			startFENs960L[fen] = true
-		}
-		return
-	}
-
-	for ii := leftIdx; ii <= lastIdx; ii++ {
-		// swap
-		backrank[leftIdx], backrank[ii] = backrank[ii], backrank[leftIdx]
-
-		addPermutations(backrank, leftIdx+1, lastIdx, startFENs960L)
-
-		// unswap
-		backrank[leftIdx], backrank[ii] = backrank[ii], backrank[leftIdx]
-	}
-}
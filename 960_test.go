@@ -1,6 +1,7 @@
 package chesstools
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -37,3 +38,81 @@ func TestKing(t *testing.T) {
 		t.Fatalf("backrank has king between rooks but hasOppositeColorBishops()	returned false")
 	}
 }
+
+func TestChess960Numbering(t *testing.T) {
+	known := map[int]string{0: "BBQNNRKR", 518: "RNBQKBNR", 959: "RKRNNQBB",
+		1: "BQNBNRKR"}
+	for id, expected := range known {
+		backrank, err := Chess960Backrank(id)
+		if err != nil || backrank != expected {
+			t.Fatalf("expected %v for %v but got %v err:%v", expected, id,
+				backrank, err)
+		}
+	}
+
+	fens := Get960StartFENs()
+	if len(fens) != Num960StartPositions {
+		t.Fatalf("expected %v FENs but got %v", Num960StartPositions, len(fens))
+	}
+	seen := make(map[string]bool)
+	for id, fen := range fens {
+		if seen[fen] {
+			t.Fatalf("duplicate start FEN %v", fen)
+		}
+		seen[fen] = true
+		whiteId, blackId, err := Chess960Ids(fen)
+		if err != nil || whiteId != id || blackId != id {
+			t.Fatalf("expected %v for %v but got %v/%v err:%v", id, fen, whiteId,
+				blackId, err)
+		}
+		backrank := strings.ToLower(strings.Fields(fen)[0][:8])
+		if !isLegalBackrank([]rune(backrank), 7) {
+			t.Fatalf("illegal back rank %v", backrank)
+		}
+		issues := ValidateFEN(fen)
+		if len(issues) != 0 {
+			t.Fatalf("unexpected issues for %v: %v", fen, issues)
+		}
+		shredder, err := ConvertCastling(fen, ShredderCastling)
+		if err != nil || len(ValidateFEN(shredder)) != 0 {
+			t.Fatalf("bad Shredder-FEN %v for %v err:%v", shredder, fen, err)
+		}
+		xfen, err := ConvertCastling(shredder, XFENCastling)
+		if err != nil || xfen != fen {
+			t.Fatalf("expected %v from %v but got %v err:%v", fen, shredder, xfen,
+				err)
+		}
+	}
+	if fens[Standard960Id] != "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1" {
+		t.Fatalf("unexpected standard start FEN %v", fens[Standard960Id])
+	}
+
+	_, err := Chess960Backrank(960)
+	if err == nil {
+		t.Fatalf("expected an error for start position 960")
+	}
+	_, err = Chess960BackrankId("RNBKQBNR")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	_, err = Chess960BackrankId("BRBQKNNR")
+	if err == nil {
+		t.Fatalf("expected an error for same colored bishops")
+	}
+}
+
+func TestDoubleChess960(t *testing.T) {
+	fen, err := DoubleChess960StartFEN(518, 0)
+	if err != nil || fen != "bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1" {
+		t.Fatalf("unexpected FEN %v err:%v", fen, err)
+	}
+	whiteId, blackId, err := Chess960Ids(fen)
+	if err != nil || whiteId != 518 || blackId != 0 {
+		t.Fatalf("unexpected ids %v/%v err:%v", whiteId, blackId, err)
+	}
+
+	_, _, err = Chess960Ids("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1")
+	if err == nil {
+		t.Fatalf("expected an error for a position after 1. e4")
+	}
+}
@@ -0,0 +1,301 @@
+package chesstools
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/corentings/chess/v2"
+)
+
+// CastlingNotation selects how the castling field of a FEN names rights
+type CastlingNotation int
+
+const (
+	// X-FEN writes K, Q, k, or q when the castling rook is the outermost rook
+	// on its side of the king and the rook's file otherwise; it is identical
+	// to standard FEN for standard chess
+	XFENCastling CastlingNotation = iota
+	// Shredder-FEN always writes the castling rook's file, e.g. HAha
+	ShredderCastling
+)
+
+// castlingFiles are the rook file letters X-FEN and Shredder-FEN allow
+const castlingFiles = "ABCDEFGHabcdefgh"
+
+type castlingRight struct {
+	color    chess.Color
+	rookFile int
+	kingside bool
+}
+
+func isCastlingLetter(ch byte) bool {
+	return strings.IndexByte("KQkq"+castlingFiles, ch) >= 0
+}
+
+func backRank(c chess.Color) int {
+	if c == chess.White {
+		return 0
+	}
+
+	return 7
+}
+
+func castlingSide(kingside bool) string {
+	if kingside {
+		return "kingside"
+	}
+
+	return "queenside"
+}
+
+// kingFile returns the file of c's king on its back rank or -1
+func (b *fenBoard) kingFile(c chess.Color) int {
+	for file := 0; file < 8; file++ {
+		if b.at(file, backRank(c)) == pieceLetter('k', c) {
+			return file
+		}
+	}
+
+	return -1
+}
+
+// outermostRook returns the file of c's back rank rook furthest from the king
+// on the given side or -1
+func (b *fenBoard) outermostRook(c chess.Color, kingFile int, kingside bool) int {
+	file, step := 0, 1
+	if kingside {
+		file, step = 7, -1
+	}
+	for ; file != kingFile; file += step {
+		if b.at(file, backRank(c)) == pieceLetter('r', c) {
+			return file
+		}
+	}
+
+	return -1
+}
+
+// resolveCastlingRight returns the right granted by castling letter ch, which
+// must satisfy isCastlingLetter, on board
+func resolveCastlingRight(ch byte, board *fenBoard) (castlingRight, error) {
+	c := pieceOwner(ch)
+	rank := backRank(c)
+	kingFile := board.kingFile(c)
+	if kingFile < 0 {
+		return castlingRight{}, fmt.Errorf("%c requires the %v king on rank %v",
+			ch, colorName(c), rank+1)
+	}
+
+	right := castlingRight{color: c}
+	switch upper := strings.ToUpper(string(ch))[0]; upper {
+	case 'K', 'Q':
+		right.kingside = upper == 'K'
+		right.rookFile = board.outermostRook(c, kingFile, right.kingside)
+		if right.rookFile < 0 {
+			return right, fmt.Errorf("%c requires a %v rook %v of the king on %v",
+				ch, colorName(c), castlingSide(right.kingside),
+				squareName(kingFile, rank))
+		}
+	default:
+		right.rookFile = int(upper - 'A')
+		right.kingside = right.rookFile > kingFile
+		if board.at(right.rookFile, rank) != pieceLetter('r', c) {
+			return right, fmt.Errorf("%c requires a %v rook on %v", ch, colorName(c),
+				squareName(right.rookFile, rank))
+		}
+	}
+
+	return right, nil
+}
+
+// parseCastling returns the rights in a standard, X-FEN, or Shredder-FEN
+// castling field for the given placement
+func parseCastling(castling string, board *fenBoard) ([]castlingRight, error) {
+	rights := make([]castlingRight, 0)
+	if castling == "-" {
+		return rights, nil
+	}
+	for _, ch := range []byte(castling) {
+		if !isCastlingLetter(ch) {
+			return nil, fmt.Errorf("%q is not one of K, Q, k, q, A-H, a-h, or -", ch)
+		}
+		right, err := resolveCastlingRight(ch, board)
+		if err != nil {
+			return nil, err
+		}
+		if hasCastlingSide(rights, right) {
+			return nil, fmt.Errorf("%v lists %v %v castling more than once",
+				castling, colorName(right.color), castlingSide(right.kingside))
+		}
+		rights = append(rights, right)
+	}
+
+	return rights, nil
+}
+
+func hasCastlingSide(rights []castlingRight, right castlingRight) bool {
+	return slices.ContainsFunc(rights, func(r castlingRight) bool {
+		return r.color == right.color && r.kingside == right.kingside
+	})
+}
+
+// castlingNotationOf guesses the notation of a castling field; any K, Q, k,
+// or q means X-FEN
+func castlingNotationOf(castling string) CastlingNotation {
+	if strings.ContainsAny(castling, castlingFiles) &&
+		!strings.ContainsAny(castling, "KQkq") {
+
+		return ShredderCastling
+	}
+
+	return XFENCastling
+}
+
+// formatCastling writes rights in notation, white before black and kingside
+// before queenside
+func formatCastling(rights []castlingRight, board *fenBoard,
+	notation CastlingNotation) string {
+
+	ret := ""
+	for _, c := range []chess.Color{chess.White, chess.Black} {
+		for _, kingside := range []bool{true, false} {
+			idx := slices.IndexFunc(rights, func(r castlingRight) bool {
+				return r.color == c && r.kingside == kingside
+			})
+			if idx < 0 {
+				continue
+			}
+			right := rights[idx]
+			letter := byte('A' + right.rookFile)
+			if notation == XFENCastling && right.rookFile ==
+				board.outermostRook(c, board.kingFile(c), kingside) {
+
+				letter = 'Q'
+				if kingside {
+					letter = 'K'
+				}
+			}
+			if c == chess.Black {
+				letter = letter - 'A' + 'a'
+			}
+			ret += string(letter)
+		}
+	}
+	if ret == "" {
+		return "-"
+	}
+
+	return ret
+}
+
+// convertCastlingField rewrites castling for the given placement in notation
+func convertCastlingField(placement string, castling string,
+	notation CastlingNotation) (string, error) {
+
+	v := &fenValidation{issues: make([]FENIssue, 0)}
+	board := v.checkPlacement(placement)
+	if board == nil {
+		return "", fmt.Errorf("%v", v.issues[0])
+	}
+	rights, err := parseCastling(castling, board)
+	if err != nil {
+		return "", err
+	}
+
+	return formatCastling(rights, board, notation), nil
+}
+
+// ConvertCastling rewrites the castling field of fen in notation. it accepts
+// standard FEN, X-FEN, and Shredder-FEN castling fields, so e.g. the
+// Shredder-FEN HAha and X-FEN KQkq of a Chess960 start position convert to
+// each other.
+func ConvertCastling(fen string, notation CastlingNotation) (string, error) {
+	fields := strings.Fields(fen)
+	if len(fields) < 3 {
+		return "", fmt.Errorf("Invalid FEN:{%v} expecting a castling field", fen)
+	}
+	castling, err := convertCastlingField(fields[0], fields[2], notation)
+	if err != nil {
+		return "", fmt.Errorf("Invalid FEN:{%v}: %w", fen, err)
+	}
+	fields[2] = castling
+
+	return strings.Join(fields, " "), nil
+}
+
+// playableOn reports whether the chess package can castle with right;
+// it only moves a king from the e-file with a rook from the a- or h-file
+func (right castlingRight) playableOn(board *fenBoard) bool {
+	rookFile := 0
+	if right.kingside {
+		rookFile = 7
+	}
+
+	return board.kingFile(right.color) == 4 && right.rookFile == rookFile
+}
+
+// resolvableCastling returns the valid rights in castling which board
+// supports, ignoring the rest
+func resolvableCastling(castling string, board *fenBoard) []castlingRight {
+	rights := make([]castlingRight, 0)
+	for _, ch := range []byte(castling) {
+		if !isCastlingLetter(ch) {
+			continue
+		}
+		right, err := resolveCastlingRight(ch, board)
+		if err == nil && !hasCastlingSide(rights, right) {
+			rights = append(rights, right)
+		}
+	}
+
+	return rights
+}
+
+// LoadFEN is chess.FEN which also accepts X-FEN and Shredder-FEN castling
+// fields. like RepairFEN it drops castling rights the placement cannot
+// support. it also drops every right the chess package cannot play, as the
+// package would castle from e1 or e8 with whatever rights it is given, so
+// the loaded position may lack rights fen has; see castlingFEN().
+func LoadFEN(fen string) (func(*chess.Game), error) {
+	fields := strings.Fields(fen)
+	if len(fields) >= 3 && fields[2] != "-" {
+		if strings.Trim(fields[2], "KQkq"+castlingFiles) != "" {
+			return nil, fmt.Errorf("Invalid FEN:{%v}: castling %v is not made of K, Q, k, q, A-H, a-h, or -",
+				fen, fields[2])
+		}
+		v := &fenValidation{issues: make([]FENIssue, 0)}
+		board := v.checkPlacement(fields[0])
+		if board != nil {
+			rights := resolvableCastling(fields[2], board)
+			rights = slices.DeleteFunc(rights, func(right castlingRight) bool {
+				return !right.playableOn(board)
+			})
+			fields[2] = formatCastling(rights, board, XFENCastling)
+			fen = strings.Join(fields, " ")
+		}
+	}
+
+	return chess.FEN(fen)
+}
+
+// castlingFEN returns the FEN of pos, which LoadFEN() loaded from fen, with
+// the castling rights LoadFEN() dropped because the chess package cannot
+// play them restored. engines, explorers, and caches need these rights, e.g.
+// the KQkq of most Chess960 start positions.
+func castlingFEN(pos *chess.Position, fen string) string {
+	posFields := strings.Fields(pos.XFENString())
+	fields := strings.Fields(fen)
+	if len(fields) < 3 || fields[2] == "-" {
+		return pos.XFENString()
+	}
+	v := &fenValidation{issues: make([]FENIssue, 0)}
+	board := v.checkPlacement(fields[0])
+	if board == nil {
+		return pos.XFENString()
+	}
+	posFields[2] = formatCastling(resolvableCastling(fields[2], board), board,
+		XFENCastling)
+
+	return strings.Join(posFields, " ")
+}
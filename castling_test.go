@@ -0,0 +1,171 @@
+package chesstools
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/corentings/chess/v2"
+)
+
+func TestConvertCastling(t *testing.T) {
+	tests := []struct {
+		fen      string
+		xfen     string
+		shredder string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "KQkq", "HAha"},
+		{"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w HFhf - 0 1", "KQkq", "HFhf"},
+		{"4k3/8/8/8/8/8/8/4K2R w K - 0 1", "K", "H"},
+		// the b1 rook is not the outermost so X-FEN names its file
+		{"4k3/8/8/8/8/8/8/RR2K3 w B - 0 1", "B", "B"},
+		{"4k3/8/8/8/8/8/8/RR2K3 w Q - 0 1", "Q", "A"},
+		{"4k3/8/8/8/8/8/8/4K3 w - - 0 1", "-", "-"},
+	}
+
+	for _, test := range tests {
+		for _, expected := range []struct {
+			notation CastlingNotation
+			castling string
+		}{{XFENCastling, test.xfen}, {ShredderCastling, test.shredder}} {
+			fen, err := ConvertCastling(test.fen, expected.notation)
+			if err != nil {
+				t.Fatalf("ConvertCastling(%v) failed: %v", test.fen, err)
+			}
+			issues := ValidateFEN(fen)
+			if HasFENErrors(issues) {
+				t.Fatalf("ConvertCastling(%v) returned invalid %v: %v", test.fen,
+					fen, issues)
+			}
+			castling := strings.Fields(fen)[FENCastlingField]
+			if castling != expected.castling {
+				t.Fatalf("ConvertCastling(%v, %v): expected %v but got %v",
+					test.fen, expected.notation, expected.castling, castling)
+			}
+		}
+	}
+
+	_, err := ConvertCastling("4k3/8/8/8/8/8/8/4K2R w Q - 0 1", ShredderCastling)
+	if err == nil {
+		t.Fatalf("expected an error for a right without a rook")
+	}
+}
+
+func TestNormalizeFENCastling(t *testing.T) {
+	xfen, err := NormalizeFEN("bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1")
+	if err != nil {
+		t.Fatalf("NormalizeFEN failed: %v", err)
+	}
+	shredder, err := NormalizeFEN("bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w HFhf - 3 7")
+	if err != nil {
+		t.Fatalf("NormalizeFEN failed: %v", err)
+	}
+	if xfen != shredder {
+		t.Fatalf("expected X-FEN and Shredder-FEN to normalize identically: %v vs %v",
+			xfen, shredder)
+	}
+
+	_, err = NormalizeFEN("bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w GFgf - 0 1")
+	if err == nil {
+		t.Fatalf("expected an error for rights without rooks")
+	}
+}
+
+func TestLoadFENShredder(t *testing.T) {
+	_, err := LoadFEN("bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w HFhf - 0 1")
+	if err != nil {
+		t.Fatalf("LoadFEN failed: %v", err)
+	}
+}
+
+func TestLoadFENCastling(t *testing.T) {
+	tests := []struct {
+		fen      string
+		castling string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "KQkq"},
+		{"rkr5/pppppppp/8/8/8/8/PPPPPPPP/RKR5 w CAca - 0 1", "-"},
+		{"rkr5/pppppppp/8/8/8/8/PPPPPPPP/RKR5 w KQkq - 0 1", "-"},
+		// the king is on e1 but only the a1 rook is where the package expects
+		{"r3krn1/8/8/8/8/8/8/R3KRN1 w KQkq - 0 1", "Qq"},
+	}
+
+	for _, test := range tests {
+		fenOpt, err := LoadFEN(test.fen)
+		if err != nil {
+			t.Fatalf("LoadFEN(%v) failed: %v", test.fen, err)
+		}
+		pos := chess.NewGame(fenOpt).Position()
+		castling := strings.Fields(pos.XFENString())[FENCastlingField]
+		if castling != test.castling {
+			t.Fatalf("LoadFEN(%v): expected castling %v but got %v", test.fen,
+				test.castling, castling)
+		}
+		for _, mv := range pos.ValidMoves() {
+			if !mv.HasTag(chess.KingSideCastle) &&
+				!mv.HasTag(chess.QueenSideCastle) {
+				continue
+			}
+			if pos.Board().Piece(mv.S1()).Type() != chess.King {
+				t.Fatalf("LoadFEN(%v): castle %v starts without a king", test.fen,
+					mv.String())
+			}
+		}
+	}
+
+	_, err := LoadFEN("4k3/8/8/8/8/8/8/4K3 w X - 0 1")
+	if err == nil {
+		t.Fatalf("expected an error for a castling field of X")
+	}
+}
+
+func TestCastlingFEN(t *testing.T) {
+	tests := []struct {
+		fen      string
+		expected string
+	}{
+		// rights the chess package cannot play are restored
+		{"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1",
+			"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1"},
+		{"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w HFhf - 0 1",
+			"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1"},
+		// rights the placement cannot support stay dropped
+		{"4k3/8/8/8/8/8/8/4K2R w KQ - 0 1", "4k3/8/8/8/8/8/8/4K2R w K - 0 1"},
+		{"4k3/8/8/8/8/8/8/4K3 w K - 0 1", "4k3/8/8/8/8/8/8/4K3 w - - 0 1"},
+	}
+
+	for _, test := range tests {
+		fenOpt, err := LoadFEN(test.fen)
+		if err != nil {
+			t.Fatalf("LoadFEN(%v) failed: %v", test.fen, err)
+		}
+		fen := castlingFEN(chess.NewGame(fenOpt).Position(), test.fen)
+		if fen != test.expected {
+			t.Fatalf("castlingFEN(%v): expected %v but got %v", test.fen,
+				test.expected, fen)
+		}
+	}
+}
+
+func TestLoadFEN960(t *testing.T) {
+	for id := 0; id < Num960StartPositions; id++ {
+		fen, err := Chess960StartFEN(id)
+		if err != nil {
+			t.Fatalf("Chess960StartFEN(%v) failed: %v", id, err)
+		}
+		fenOpt, err := LoadFEN(fen)
+		if err != nil {
+			t.Fatalf("LoadFEN(%v) failed: %v", fen, err)
+		}
+		pos := chess.NewGame(fenOpt).Position()
+		for _, mv := range pos.ValidMoves() {
+			if pos.Board().Piece(mv.S1()).Type() != chess.Pawn &&
+				pos.Board().Piece(mv.S1()).Type() != chess.Knight {
+				t.Fatalf("unexpected first move %v in %v", mv.String(), fen)
+			}
+		}
+		if castlingFEN(pos, fen) != fen {
+			t.Fatalf("expected castlingFEN to restore %v but got %v", fen,
+				castlingFEN(pos, fen))
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package chesstools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	ChessComUrlPrefix    = "https://www.chess.com"
+	ChessComApiUrlPrefix = "https://api.chess.com"
+)
+
+// overridden by tests
+var chessComBaseUrl = ChessComUrlPrefix
+var chessComApiBaseUrl = ChessComApiUrlPrefix
+
+func isChessComUrl(pgnFileOrUrl string) bool {
+	return strings.HasPrefix(pgnFileOrUrl, ChessComUrlPrefix) ||
+		strings.HasPrefix(pgnFileOrUrl, ChessComApiUrlPrefix) ||
+		strings.HasPrefix(pgnFileOrUrl, "https://chess.com")
+}
+
+func openPgnChessCom(chessComUrl string) (io.ReadCloser, error) {
+	// e.g. https://api.chess.com/pub/player/<user>/games/2024/01 for a
+	// monthly archive, or https://www.chess.com/game/live/123456789 for a
+	// single game (https://www.chess.com/live/game/123456789 in older links)
+
+	u, err := url.Parse(chessComUrl)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse chess.com url %v: %w",
+			chessComUrl, err)
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	pathParts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+
+	if len(pathParts) >= 6 && pathParts[0] == "pub" &&
+		pathParts[1] == "player" && pathParts[3] == "games" {
+
+		if !strings.HasSuffix(path, "/pgn") {
+			path += "/pgn"
+		}
+		return openPgnUrl(chessComApiBaseUrl+path, chessComUrl)
+	}
+
+	if len(pathParts) == 3 &&
+		((pathParts[0] == "game" && (pathParts[1] == "live" || pathParts[1] == "daily")) ||
+			(pathParts[1] == "game" && (pathParts[0] == "live" || pathParts[0] == "daily"))) {
+
+		gameType := pathParts[1]
+		if pathParts[1] == "game" {
+			gameType = pathParts[0]
+		}
+		return openPgnChessComGame(chessComUrl, gameType, pathParts[2])
+	}
+
+	return nil, fmt.Errorf("Unrecognized chess.com url %v; expecting a game or monthly archive url",
+		chessComUrl)
+}
+
+type chessComCallbackResp struct {
+	Game struct {
+		PgnHeaders map[string]interface{} `json:"pgnHeaders"`
+	} `json:"game"`
+}
+
+type chessComArchiveResp struct {
+	Games []struct {
+		Url string `json:"url"`
+		Pgn string `json:"pgn"`
+	} `json:"games"`
+}
+
+func decodeChessComJson(url2Fetch string, chessComUrl string,
+	v interface{}) error {
+
+	rc, err := openPgnUrl(url2Fetch, chessComUrl)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	err = json.NewDecoder(rc).Decode(v)
+	if err != nil {
+		return fmt.Errorf("Failed to parse response for chess.com url %v: %w",
+			chessComUrl, err)
+	}
+
+	return nil
+}
+
+// chessComArchiveMonths returns the monthly archives which may hold a game
+// given its Date and EndDate headers, most likely first. archives are by
+// end date, so without EndDate a game which started late in a month, e.g. a
+// daily game or a live game around midnight, may be in the next month's.
+func chessComArchiveMonths(date string, endDate string) ([]time.Time, error) {
+	start, err := time.Parse("2006.01.02", date)
+	if err != nil {
+		return nil, err
+	}
+	start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	months := make([]time.Time, 0, 3)
+	end, err := time.Parse("2006.01.02", endDate)
+	if err == nil {
+		months = append(months, time.Date(end.Year(), end.Month(), 1, 0, 0, 0,
+			0, time.UTC))
+	}
+	for _, month := range []time.Time{start, start.AddDate(0, 1, 0)} {
+		if !slices.Contains(months, month) {
+			months = append(months, month)
+		}
+	}
+
+	return months, nil
+}
+
+// chess.com's public API has no single game export, so find the game's
+// players and date then pull it from white's monthly archive
+func openPgnChessComGame(chessComUrl string, gameType string,
+	gameId string) (io.ReadCloser, error) {
+
+	var callback chessComCallbackResp
+	err := decodeChessComJson(fmt.Sprintf("%v/callback/%v/game/%v",
+		chessComBaseUrl, gameType, gameId), chessComUrl, &callback)
+	if err != nil {
+		return nil, err
+	}
+
+	white, _ := callback.Game.PgnHeaders["White"].(string)
+	date, _ := callback.Game.PgnHeaders["Date"].(string)
+	endDate, _ := callback.Game.PgnHeaders["EndDate"].(string)
+	months, err := chessComArchiveMonths(date, endDate)
+	if white == "" || err != nil {
+		return nil, fmt.Errorf("Cannot find players and date of chess.com game %v",
+			chessComUrl)
+	}
+
+	searched := make([]string, 0, len(months))
+	var archiveErr error
+	for _, month := range months {
+		var archive chessComArchiveResp
+		err = decodeChessComJson(fmt.Sprintf("%v/pub/player/%v/games/%v",
+			chessComApiBaseUrl, strings.ToLower(white), month.Format("2006/01")),
+			chessComUrl, &archive)
+		if err != nil {
+			// e.g. no archive yet for the following month
+			archiveErr = err
+			continue
+		}
+		searched = append(searched, month.Format("2006.01"))
+		for _, g := range archive.Games {
+			if strings.HasSuffix(g.Url, "/"+gameId) {
+				return io.NopCloser(strings.NewReader(g.Pgn)), nil
+			}
+		}
+	}
+	if len(searched) == 0 {
+		return nil, archiveErr
+	}
+
+	return nil, fmt.Errorf("Cannot find chess.com game %v in %v's %v archives",
+		chessComUrl, white, strings.Join(searched, " and "))
+}
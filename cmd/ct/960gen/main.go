@@ -1,31 +1,207 @@
 package gen960
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
+	"io"
+	"math/rand/v2"
 	"os"
+	"time"
 
 	"github.com/mikeb26/chesstools"
 )
 
-func printFENs(uniqFENs []string) {
-	for _, fen := range uniqFENs {
-		fmt.Println(fen)
+const NoId = -1
+
+type Gen960Opts struct {
+	id       int
+	blackId  int
+	random   bool
+	seed     uint64
+	count    int
+	lookup   string
+	double   bool
+	numbered bool
+	shredder bool
+}
+
+func parseArgs(args []string, opts *Gen960Opts) error {
+	f := flag.NewFlagSet("960gen", flag.ExitOnError)
+	var seed int64
+
+	f.IntVar(&opts.id, "id", NoId,
+		"<0-959> print the start position with this number (518 is standard chess)")
+	f.IntVar(&opts.blackId, "blackid", NoId,
+		"<0-959> with --double, black's start position number (default --id)")
+	f.BoolVar(&opts.random, "random", false, "print a random start position")
+	f.Int64Var(&seed, "seed", 0,
+		"<seed> seed --random for a repeatable choice (default the current time)")
+	f.IntVar(&opts.count, "count", 1, "<N> with --random, print N positions")
+	f.StringVar(&opts.lookup, "lookup", "",
+		"<FEN> print the start position number(s) of a FEN")
+	f.BoolVar(&opts.double, "double", false,
+		"Double Chess960; white and black each have their own start position")
+	f.BoolVar(&opts.numbered, "numbered", false,
+		"prefix each FEN with its start position number(s)")
+	f.BoolVar(&opts.shredder, "shredder", false,
+		"write castling rights in Shredder-FEN (rook files, e.g. HAha) instead of X-FEN (KQkq)")
+
+	err := f.Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(f.Args()) != 0 {
+		return fmt.Errorf("unexpected arguments %v", f.Args())
+	}
+
+	seedSet := false
+	f.Visit(func(fl *flag.Flag) {
+		if fl.Name == "seed" {
+			seedSet = true
+		}
+	})
+	if seedSet && !opts.random {
+		return fmt.Errorf("--seed requires --random")
+	}
+	if seedSet {
+		opts.seed = uint64(seed)
+	} else {
+		opts.seed = uint64(time.Now().UnixNano())
+	}
+
+	modes := 0
+	for _, set := range []bool{opts.id != NoId, opts.random, opts.lookup != ""} {
+		if set {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return fmt.Errorf("--id, --random, and --lookup are mutually exclusive")
+	}
+	if opts.lookup != "" && opts.shredder {
+		return fmt.Errorf("--shredder does not apply to --lookup")
+	}
+	if opts.lookup != "" && opts.double {
+		return fmt.Errorf("--lookup reports Double Chess960 numbers without --double")
+	}
+	if opts.blackId != NoId && (!opts.double || opts.id == NoId) {
+		return fmt.Errorf("--blackid requires --double and --id")
+	}
+	if opts.count < 1 || (opts.count != 1 && !opts.random) {
+		return fmt.Errorf("--count requires --random and must be at least 1")
 	}
+	if opts.double && opts.id != NoId && opts.blackId == NoId {
+		opts.blackId = opts.id
+	}
+
+	return nil
 }
 
 func Main(args []string) {
-	if len(args) > 0 {
-		switch args[0] {
-		case "-h", "--help":
-			fmt.Fprintln(os.Stdout, "usage: ct 960gen")
-			return
-		default:
-			fmt.Fprintf(os.Stderr, "960gen: does not accept arguments\n")
-			os.Exit(1)
+	var opts Gen960Opts
+	err := parseArgs(args, &opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse arguments: %v\n", err)
+		os.Exit(1)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	err = generate(&opts, out)
+	flushErr := out.Flush()
+	if err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func generate(opts *Gen960Opts, out io.Writer) error {
+	if opts.lookup != "" {
+		return lookup(opts.lookup, out)
+	}
+
+	if opts.random {
+		rng := rand.New(rand.NewPCG(opts.seed, opts.seed))
+		for ii := 0; ii < opts.count; ii++ {
+			whiteId := rng.IntN(chesstools.Num960StartPositions)
+			blackId := whiteId
+			if opts.double {
+				blackId = rng.IntN(chesstools.Num960StartPositions)
+			}
+			err := printFEN(opts, whiteId, blackId, out)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if opts.id != NoId {
+		blackId := opts.id
+		if opts.double {
+			blackId = opts.blackId
+		}
+		return printFEN(opts, opts.id, blackId, out)
+	}
+
+	// every start position in order
+	for whiteId := 0; whiteId < chesstools.Num960StartPositions; whiteId++ {
+		if !opts.double {
+			err := printFEN(opts, whiteId, whiteId, out)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		for blackId := 0; blackId < chesstools.Num960StartPositions; blackId++ {
+			err := printFEN(opts, whiteId, blackId, out)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func printFEN(opts *Gen960Opts, whiteId int, blackId int, out io.Writer) error {
+	fen, err := chesstools.DoubleChess960StartFEN(whiteId, blackId)
+	if err != nil {
+		return err
+	}
+	if opts.shredder {
+		fen, err = chesstools.ConvertCastling(fen, chesstools.ShredderCastling)
+		if err != nil {
+			return err
 		}
 	}
 
-	uniqFENs := chesstools.Get960StartFENs()
+	switch {
+	case !opts.numbered:
+		_, err = fmt.Fprintf(out, "%v\n", fen)
+	case opts.double:
+		_, err = fmt.Fprintf(out, "%v\t%v\t%v\n", whiteId, blackId, fen)
+	default:
+		_, err = fmt.Fprintf(out, "%v\t%v\n", whiteId, fen)
+	}
+
+	return err
+}
+
+func lookup(fen string, out io.Writer) error {
+	whiteId, blackId, err := chesstools.Chess960Ids(fen)
+	if err != nil {
+		return err
+	}
+
+	if whiteId == blackId {
+		_, err = fmt.Fprintf(out, "%v\n", whiteId)
+	} else {
+		_, err = fmt.Fprintf(out, "white %v black %v\n", whiteId, blackId)
+	}
 
-	printFENs(uniqFENs)
+	return err
 }
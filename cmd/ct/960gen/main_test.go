@@ -0,0 +1,81 @@
+package gen960
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func runGenerate(t *testing.T, args ...string) string {
+	var opts Gen960Opts
+	err := parseArgs(args, &opts)
+	if err != nil {
+		t.Fatalf("parseArgs(%v) failed: %v", args, err)
+	}
+	var buf bytes.Buffer
+	err = generate(&opts, &buf)
+	if err != nil {
+		t.Fatalf("generate(%v) failed: %v", args, err)
+	}
+
+	return buf.String()
+}
+
+func TestGenerate(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(runGenerate(t)), "\n")
+	if len(lines) != 960 ||
+		lines[518] != "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1" {
+		t.Fatalf("unexpected positions; %v lines", len(lines))
+	}
+
+	out := runGenerate(t, "--id", "518", "--numbered")
+	if out != "518\trnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1\n" {
+		t.Fatalf("unexpected --id output %v", out)
+	}
+	out = runGenerate(t, "--id", "0", "--shredder")
+	if out != "bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w HFhf - 0 1\n" {
+		t.Fatalf("unexpected --shredder output %v", out)
+	}
+	out = runGenerate(t, "--lookup", strings.TrimSpace(out))
+	if out != "0\n" {
+		t.Fatalf("unexpected --lookup output for Shredder-FEN %v", out)
+	}
+	out = runGenerate(t, "--double", "--id", "518", "--blackid", "0")
+	if out != "bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1\n" {
+		t.Fatalf("unexpected --double output %v", out)
+	}
+
+	out = runGenerate(t, "--lookup", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	if out != "518\n" {
+		t.Fatalf("unexpected --lookup output %v", out)
+	}
+	out = runGenerate(t, "--lookup", "bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	if out != "white 518 black 0\n" {
+		t.Fatalf("unexpected --lookup output %v", out)
+	}
+}
+
+func TestGenerateRandom(t *testing.T) {
+	first := runGenerate(t, "--random", "--seed", "42", "--count", "5",
+		"--double")
+	second := runGenerate(t, "--random", "--seed", "42", "--count", "5",
+		"--double")
+	if first != second || strings.Count(first, "\n") != 5 {
+		t.Fatalf("expected repeatable random positions:\n%v\n%v", first, second)
+	}
+}
+
+func TestParseArgsErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"--id", "1", "--random"},
+		{"--seed", "1"},
+		{"--blackid", "1"},
+		{"--count", "2"},
+		{"extra"},
+	} {
+		err := parseArgs(args, &Gen960Opts{})
+		if err == nil {
+			t.Fatalf("expected an error for %v", args)
+		}
+	}
+}
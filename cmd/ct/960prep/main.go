@@ -0,0 +1,339 @@
+/* Utility for preparing the opening moves of a Chess960 start position
+ */
+
+package prep960
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikeb26/chesstools"
+)
+
+const (
+	NoId = -1
+
+	DefaultCandidates = 4
+	DefaultPlies      = 8
+	DefaultEngineTime = 60
+)
+
+type Prep960Opts struct {
+	id          int
+	candidates  int
+	plies       int
+	threshold   float64
+	engineTime  uint
+	depth       int
+	output      string
+	noEngine    bool
+	noExplorer  bool
+	fullRatings bool
+	allSpeeds   bool
+}
+
+// candidate is a first move worth preparing; engine candidates carry their
+// principal variation and book moves their Lichess statistics
+type candidate struct {
+	line  []string
+	pv    *chesstools.PVResult
+	rank  int // 1 for the engine's first choice; 0 when not an engine choice
+	stats *chesstools.MoveStats
+}
+
+func parseArgs(args []string, opts *Prep960Opts) error {
+	f := flag.NewFlagSet("960prep", flag.ExitOnError)
+
+	f.IntVar(&opts.id, "id", NoId,
+		"<0-959> Chess960 start position number (518 is standard chess)")
+	f.IntVar(&opts.candidates, "candidates", DefaultCandidates,
+		"<N> number of first moves for the engine to score (MultiPV)")
+	f.IntVar(&opts.plies, "plies", DefaultPlies,
+		"<N> maximum half moves of each engine line to include")
+	f.Float64Var(&opts.threshold, "threshold", 0.05,
+		"<thresholdPct> also include first moves played in at least this share of Lichess games")
+	f.UintVar(&opts.engineTime, "enginetime", DefaultEngineTime,
+		"<engine search time in seconds>")
+	f.IntVar(&opts.depth, "depth", chesstools.DefaultDepth,
+		"<engine search depth> (default search by --enginetime)")
+	f.StringVar(&opts.output, "output", "", "<outputFile> (default stdout)")
+	f.BoolVar(&opts.noEngine, "noengine", false, "skip the engine search")
+	f.BoolVar(&opts.noExplorer, "noexplorer", false,
+		"skip the Lichess chess960 explorer")
+	f.BoolVar(&opts.fullRatings, "fullratings", false,
+		"include Lichess games at every rating rather than 2200+")
+	f.BoolVar(&opts.allSpeeds, "allspeeds", false,
+		"include Lichess games at every speed rather than blitz, rapid, and classical")
+
+	err := f.Parse(args)
+	if err != nil {
+		return err
+	}
+	if len(f.Args()) != 0 {
+		return fmt.Errorf("unexpected arguments %v", f.Args())
+	}
+
+	if opts.id == NoId {
+		return fmt.Errorf("please specify --id <0-959>")
+	}
+	if opts.id < 0 || opts.id >= chesstools.Num960StartPositions {
+		return fmt.Errorf("invalid --id %v; expected 0-%v", opts.id,
+			chesstools.Num960StartPositions-1)
+	}
+	if opts.noEngine && opts.noExplorer {
+		return fmt.Errorf("--noengine and --noexplorer leave nothing to prepare")
+	}
+	if opts.candidates < 1 {
+		return fmt.Errorf("--candidates must be at least 1")
+	}
+	if opts.plies < 1 {
+		return fmt.Errorf("--plies must be at least 1")
+	}
+
+	return nil
+}
+
+func Main(args []string) {
+	var opts Prep960Opts
+	err := parseArgs(args, &opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse arguments: %v\n", err)
+		os.Exit(1)
+		return
+	}
+
+	err = mainWork(&opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func mainWork(opts *Prep960Opts) error {
+	fen, err := chesstools.Chess960StartFEN(opts.id)
+	if err != nil {
+		return err
+	}
+
+	var pvs []*chesstools.PVResult
+	if !opts.noEngine {
+		pvs = enginePVs(opts, fen)
+	}
+	var resp *chesstools.OpeningResp
+	if !opts.noExplorer {
+		resp, err = explorerStats(opts, fen)
+		if err != nil {
+			return err
+		}
+	}
+
+	out := os.Stdout
+	if opts.output != "" {
+		out, err = os.Create(opts.output)
+		if err != nil {
+			return fmt.Errorf("Failed to create %v: %w", opts.output, err)
+		}
+		defer out.Close()
+	}
+	writer := bufio.NewWriter(out)
+	err = writePrep(opts, fen, pvs, resp, writer, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return writer.Flush()
+}
+
+func enginePVs(opts *Prep960Opts, fen string) []*chesstools.PVResult {
+	evalCtx := chesstools.NewEvalCtx(false).WithFEN(fen).WithChess960(true).
+		WithMultiPV(opts.candidates).WithEvalTime(opts.engineTime).
+		WithEvalDepth(opts.depth)
+	defer evalCtx.Close()
+	evalCtx.InitEngine()
+
+	return evalCtx.EvalMultiPV()
+}
+
+// overridden by tests to avoid the network
+var get960Replies = chesstools.GetLichess960Replies
+
+// explorerStats asks the explorer about fen itself rather than a game loaded
+// from it, which would lack most Chess960 castling rights
+func explorerStats(opts *Prep960Opts, fen string) (*chesstools.OpeningResp,
+	error) {
+
+	return get960Replies(fen, opts.fullRatings, opts.allSpeeds)
+}
+
+// collectCandidates returns the engine's choices best first followed by any
+// other first moves popular on Lichess, most played first
+func collectCandidates(opts *Prep960Opts, pvs []*chesstools.PVResult,
+	resp *chesstools.OpeningResp) []*candidate {
+
+	statsFor := func(san string) *chesstools.MoveStats {
+		if resp == nil {
+			return nil
+		}
+		for idx := range resp.Moves {
+			if resp.Moves[idx].San == san {
+				return &resp.Moves[idx]
+			}
+		}
+		return nil
+	}
+
+	cands := make([]*candidate, 0)
+	seen := make(map[string]bool)
+	for idx, pv := range pvs {
+		if seen[pv.Moves[0]] {
+			continue
+		}
+		seen[pv.Moves[0]] = true
+		cands = append(cands, &candidate{
+			line:  pv.Moves[:min(opts.plies, len(pv.Moves))],
+			pv:    pv,
+			rank:  idx + 1,
+			stats: statsFor(pv.Moves[0]),
+		})
+	}
+	if resp == nil || resp.Total() == 0 {
+		return cands
+	}
+
+	for idx := range resp.Moves {
+		mv := &resp.Moves[idx]
+		if seen[mv.San] || chesstools.Pct(mv.Total(), resp.Total()) < opts.threshold {
+			continue
+		}
+		seen[mv.San] = true
+		cands = append(cands, &candidate{line: []string{mv.San}, stats: mv})
+	}
+
+	return cands
+}
+
+func evalStr(pv *chesstools.PVResult) string {
+	if pv.Mate != 0 {
+		return fmt.Sprintf("[%%eval #%v]", pv.Mate)
+	} // else
+
+	scoreFloat := float64(pv.CP) / 100.0
+	return fmt.Sprintf("[%%eval %v]", strconv.FormatFloat(scoreFloat, 'f', 2, 64))
+}
+
+func (c *candidate) comment(resp *chesstools.OpeningResp) string {
+	parts := make([]string, 0)
+	if c.pv != nil {
+		parts = append(parts, fmt.Sprintf("%v engine choice %v at depth %v",
+			evalStr(c.pv), c.rank, c.pv.Depth))
+	}
+	if c.stats != nil {
+		total := c.stats.Total()
+		parts = append(parts, fmt.Sprintf("lichess %v games (%v): white %v draws %v black %v",
+			total, chesstools.PctS(total, resp.Total()),
+			chesstools.PctS(c.stats.WhiteWins, total),
+			chesstools.PctS(c.stats.Draws, total),
+			chesstools.PctS(c.stats.BlackWins, total)))
+	} else if resp != nil {
+		parts = append(parts, "no lichess games")
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// lineMovetext renders line from white's 1st move with comment and then
+// variations following the 1st move
+func lineMovetext(line []string, comment string, variations []string) string {
+	var sb strings.Builder
+	for ii, san := range line {
+		if ii > 0 {
+			sb.WriteString(" ")
+		}
+		switch {
+		case ii%2 == 0:
+			fmt.Fprintf(&sb, "%v. %v", ii/2+1, san)
+		case ii == 1 && (comment != "" || len(variations) > 0):
+			fmt.Fprintf(&sb, "1... %v", san)
+		default:
+			sb.WriteString(san)
+		}
+		if ii != 0 {
+			continue
+		}
+		if comment != "" {
+			fmt.Fprintf(&sb, " { %v }", comment)
+		}
+		for _, variation := range variations {
+			fmt.Fprintf(&sb, " (%v)", variation)
+		}
+	}
+
+	return sb.String()
+}
+
+func prepMovetext(opts *Prep960Opts, fen string, cands []*candidate,
+	resp *chesstools.OpeningResp) string {
+
+	ranks := strings.Split(strings.Fields(fen)[0], "/")
+	intro := fmt.Sprintf("Chess960 start position %v (%v)", opts.id, ranks[7])
+	if resp != nil {
+		intro += fmt.Sprintf("; lichess chess960 games: %v", resp.Total())
+	}
+
+	variations := make([]string, 0, len(cands)-1)
+	for _, c := range cands[1:] {
+		variations = append(variations, lineMovetext(c.line, c.comment(resp), nil))
+	}
+
+	return fmt.Sprintf("{ %v } %v", intro,
+		lineMovetext(cands[0].line, cands[0].comment(resp), variations))
+}
+
+func writePrep(opts *Prep960Opts, fen string, pvs []*chesstools.PVResult,
+	resp *chesstools.OpeningResp, output io.Writer, now time.Time) error {
+
+	cands := collectCandidates(opts, pvs, resp)
+	if len(cands) == 0 {
+		return fmt.Errorf("found no candidate moves for start position %v",
+			opts.id)
+	}
+
+	tags := []chesstools.PgnTag{
+		{Key: "Event", Value: fmt.Sprintf("Chess960 prep: start position %v",
+			opts.id)},
+		{Key: "Site", Value: ""},
+		{Key: "Date", Value: fmt.Sprintf("%v.%02v.%02v", now.Year(),
+			int(now.Month()), now.Day())},
+		{Key: "Round", Value: "1"},
+		{Key: "White", Value: ""},
+		{Key: "Black", Value: ""},
+		{Key: "Result", Value: "*"},
+		{Key: "Variant", Value: "Chess960"},
+		{Key: "Annotator", Value: "https://github.com/mikeb26/chesstools"},
+		{Key: "FEN", Value: fen},
+		{Key: "SetUp", Value: "1"},
+	}
+	pgnWriter := chesstools.NewPgnWriter()
+	err := pgnWriter.WriteTags(output, tags)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(output, "\n")
+	if err != nil {
+		return err
+	}
+	err = pgnWriter.WriteMovetext(output, prepMovetext(opts, fen, cands, resp),
+		"*")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(output, "\n\n")
+
+	return err
+}
@@ -0,0 +1,117 @@
+package prep960
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/corentings/chess/v2"
+	"github.com/mikeb26/chesstools"
+)
+
+func TestParseArgs(t *testing.T) {
+	var opts Prep960Opts
+	err := parseArgs([]string{"--id", "518"}, &opts)
+	if err != nil || opts.id != 518 || opts.candidates != DefaultCandidates {
+		t.Fatalf("unexpected opts %+v err:%v", opts, err)
+	}
+
+	for _, args := range [][]string{{}, {"--id", "960"},
+		{"--id", "0", "--noengine", "--noexplorer"},
+		{"--id", "0", "--candidates", "0"}, {"--id", "0", "extra"}} {
+
+		err = parseArgs(args, &Prep960Opts{})
+		if err == nil {
+			t.Fatalf("expected an error for %v", args)
+		}
+	}
+}
+
+func TestWritePrep(t *testing.T) {
+	var opts Prep960Opts
+	err := parseArgs([]string{"--id", "518", "--plies", "3"}, &opts)
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	fen, err := chesstools.Chess960StartFEN(opts.id)
+	if err != nil {
+		t.Fatalf("Chess960StartFEN failed: %v", err)
+	}
+	pvs := []*chesstools.PVResult{
+		{CP: 25, Depth: 20, Moves: []string{"e4", "e5", "Nf3", "Nc6"}},
+		{CP: 18, Depth: 20, Moves: []string{"d4", "Nf6"}},
+	}
+	resp := &chesstools.OpeningResp{WhiteWins: 50, Draws: 10, BlackWins: 40,
+		Moves: []chesstools.MoveStats{
+			{San: "e4", WhiteWins: 30, Draws: 5, BlackWins: 15},
+			{San: "c4", WhiteWins: 10, Draws: 2, BlackWins: 8},
+			{San: "d4", WhiteWins: 9, Draws: 3, BlackWins: 8},
+			{San: "b3", WhiteWins: 1, Draws: 0, BlackWins: 1},
+		}}
+
+	var buf bytes.Buffer
+	err = writePrep(&opts, fen, pvs, resp, &buf,
+		time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("writePrep failed: %v", err)
+	}
+	pgn := buf.String()
+	for _, expected := range []string{
+		`[Event "Chess960 prep: start position 518"]`,
+		`[Date "2026.10.18"]`,
+		`[Variant "Chess960"]`,
+		`[FEN "` + fen + `"]`,
+		"{ Chess960 start position 518 (RNBQKBNR); lichess chess960 games: 100 }",
+		"1. e4 { [%eval 0.25] engine choice 1 at depth 20; lichess 50 games",
+		"(1. d4 { [%eval 0.18] engine choice 2 at depth 20; lichess 20 games",
+		"(1. c4 { lichess 20 games (20%): white 50% draws 10% black 40% })",
+		"1... e5 2. Nf3 *",
+	} {
+		if !strings.Contains(strings.Join(strings.Fields(pgn), " "), expected) {
+			t.Fatalf("expected %q in\n%v", expected, pgn)
+		}
+	}
+	if strings.Contains(pgn, "b3") {
+		t.Fatalf("expected b3 to fall below --threshold\n%v", pgn)
+	}
+
+	// the prep must read back as a Chess960 game with every line legal
+	reader, err := chess.PGN(strings.NewReader(pgn))
+	if err != nil {
+		t.Fatalf("failed to parse prep PGN: %v\n%v", err, pgn)
+	}
+	g := chess.NewGame(reader)
+	if len(g.GetRootMove().Children()) != 3 {
+		t.Fatalf("expected 3 first moves in\n%v", pgn)
+	}
+
+	err = writePrep(&opts, fen, nil, nil, &buf, time.Now())
+	if err == nil {
+		t.Fatalf("expected an error without candidates")
+	}
+}
+
+func TestExplorerStats(t *testing.T) {
+	defer func() { get960Replies = chesstools.GetLichess960Replies }()
+	var requested string
+	get960Replies = func(fen string, _ bool, _ bool) (*chesstools.OpeningResp,
+		error) {
+
+		requested = fen
+		return &chesstools.OpeningResp{}, nil
+	}
+
+	opts := Prep960Opts{id: 0}
+	fen, err := chesstools.Chess960StartFEN(opts.id)
+	if err != nil {
+		t.Fatalf("Chess960StartFEN failed: %v", err)
+	}
+	_, err = explorerStats(&opts, fen)
+	if err != nil {
+		t.Fatalf("explorerStats failed: %v", err)
+	}
+	if requested != "bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1" {
+		t.Fatalf("unexpected explorer position %v", requested)
+	}
+}
@@ -0,0 +1,119 @@
+/* Utility for classifying games by ECO code and opening name */
+
+package eco
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/corentings/chess/v2"
+	"github.com/mikeb26/chesstools"
+)
+
+const UnknownOpening = "?"
+
+type EcoOpts struct {
+	moves    string
+	pgnFiles []string
+}
+
+func parseArgs(args []string, opts *EcoOpts) error {
+	f := flag.NewFlagSet("eco", flag.ExitOnError)
+
+	f.StringVar(&opts.moves, "moves", "", "<pgnMoves> (e.g. \"1. e4 c5 2. Nf3\")")
+
+	err := f.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	opts.pgnFiles = f.Args()
+	if opts.moves != "" && len(opts.pgnFiles) != 0 {
+		return fmt.Errorf("--moves and PGN files are mutually exclusive")
+	}
+
+	return nil
+}
+
+func Main(args []string) {
+	var opts EcoOpts
+	err := parseArgs(args, &opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse arguments: %v\n", err)
+		os.Exit(1)
+		return
+	}
+
+	if opts.moves != "" {
+		g, err := parseMoves(opts.moves)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%v\n", classifyGame(g))
+		return
+	}
+
+	if len(opts.pgnFiles) == 0 {
+		err = processOnePgn(os.Stdin, "stdin")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	for _, pgnFile := range opts.pgnFiles {
+		f, err := chesstools.OpenPgn(pgnFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		err = processOnePgn(f, pgnFile)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func parseMoves(moves string) (*chess.Game, error) {
+	pgnReader, err := chess.PGN(strings.NewReader(moves))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse moves '%v': %w", moves, err)
+	}
+
+	return chess.NewGame(pgnReader), nil
+}
+
+func processOnePgn(f io.Reader, pgnName string) error {
+	scanner := chess.NewScanner(f)
+
+	for ii := 1; scanner.HasNext(); ii++ {
+		g, err := scanner.ParseNext()
+		if err != nil {
+			return fmt.Errorf("%v#%v: %w", pgnName, ii, err)
+		}
+		if len(g.Moves()) == 0 {
+			continue
+		}
+
+		fmt.Printf("%v#%v\t%v\n", pgnName, ii, classifyGame(g))
+	}
+
+	return nil
+}
+
+func classifyGame(g *chess.Game) string {
+	eco, name, _ := chesstools.ClassifyGame(g)
+	if eco == "" {
+		eco = UnknownOpening
+		name = UnknownOpening
+	}
+
+	return fmt.Sprintf("%v\t%v", eco, name)
+}
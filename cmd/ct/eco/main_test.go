@@ -0,0 +1,38 @@
+package eco
+
+import (
+	"testing"
+)
+
+func TestClassifyMoves(t *testing.T) {
+	g, err := parseMoves("1. d4 d5 2. c4 c6 3. Nf3 Nf6 4. Nc3 a6 5. h4")
+	if err != nil {
+		t.Fatalf("parseMoves failed: %v", err)
+	}
+
+	expected := "D15\tSlav Defense: Chebanenko Variation"
+	got := classifyGame(g)
+	if got != expected {
+		t.Fatalf("Expected %v got %v", expected, got)
+	}
+}
+
+func TestClassifyUnknown(t *testing.T) {
+	g, err := parseMoves("[SetUp \"1\"]\n[FEN \"4k3/8/8/8/8/8/8/4K2R w K - 0 1\"]\n\n1. Rh2 *")
+	if err != nil {
+		t.Fatalf("parseMoves failed: %v", err)
+	}
+
+	expected := UnknownOpening + "\t" + UnknownOpening
+	got := classifyGame(g)
+	if got != expected {
+		t.Fatalf("Expected %v got %v", expected, got)
+	}
+}
+
+func TestParseMovesInvalid(t *testing.T) {
+	_, err := parseMoves("1. e4 e5 2. Ke3")
+	if err == nil {
+		t.Fatalf("expected parseMoves to fail on an illegal move")
+	}
+}
@@ -91,7 +91,7 @@ func displayOutput(evalCtx *chesstools.EvalCtx, er *chesstools.EvalResult,
 		fmt.Printf("EngVer: <unknown>\n")
 	}
 
-	newGameArgs, err := chess.FEN(fen)
+	newGameArgs, err := chesstools.LoadFEN(fen)
 	if err != nil {
 		log.Fatal(fmt.Sprintf("FEN invalid err:%v fen:%v", err, fen))
 	}
@@ -176,6 +176,10 @@ func parseArgs(args []string, evalCtx *chesstools.EvalCtx) (bool, bool, string)
 	if pgnFile != "" {
 		evalCtx = evalCtx.WithPgnFile(pgnFile).WithMoveNum(moveNum).WithTurn(turn)
 	} else if fen != "" {
+		_, err := chesstools.LoadFEN(fen)
+		if err != nil {
+			log.Fatal(chesstools.ExplainFENError(fen, err))
+		}
 		evalCtx = evalCtx.WithFEN(fen)
 	}
 	if evalDepth != 0 {
@@ -226,9 +230,10 @@ func loadFENs(reader io.Reader, source string) ([]inputPosition, error) {
 			continue
 		}
 
-		_, err := chess.FEN(fen)
+		_, err := chesstools.LoadFEN(fen)
 		if err != nil {
-			return nil, fmt.Errorf("%v:%v invalid FEN: %w", source, lineNum, err)
+			return nil, fmt.Errorf("%v:%v %w", source, lineNum,
+				chesstools.ExplainFENError(fen, err))
 		}
 
 		positions = append(positions, inputPosition{
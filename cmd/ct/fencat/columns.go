@@ -0,0 +1,209 @@
+package fencat
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/corentings/chess/v2"
+	"github.com/mikeb26/chesstools"
+)
+
+const (
+	columnGap      = "   "
+	highlightStart = "\x1b[7m"
+	highlightEnd   = "\x1b[0m"
+)
+
+type labeledPosition struct {
+	label string
+	pos   *chess.Position
+}
+
+func loadPositions(opts *FenCatOpts) ([]labeledPosition, error) {
+	positions := make([]labeledPosition, 0, len(opts.fens))
+	for idx, fen := range opts.fens {
+		fenCheck, err := chesstools.LoadFEN(fen)
+		if err != nil {
+			return nil, chesstools.ExplainFENError(fen, err)
+		}
+		p := chess.NewGame(fenCheck).Position()
+
+		label := fmt.Sprintf("%v: %v to move", idx+1,
+			strings.ToLower(p.Turn().Name()))
+		if len(opts.labels) != 0 {
+			label = opts.labels[idx]
+		}
+		positions = append(positions, labeledPosition{label: label, pos: p})
+	}
+
+	return positions, nil
+}
+
+// renderColumns draws the boards opts.columns to a row; with --diff the
+// squares which differ between the 2 boards are highlighted and listed
+func renderColumns(opts *FenCatOpts) (string, error) {
+	positions, err := loadPositions(opts)
+	if err != nil {
+		return "", err
+	}
+
+	marked := make(map[chess.Square]bool)
+	perspective := chess.NoColor
+	if opts.diff {
+		marked = diffSquares(positions[0].pos, positions[1].pos)
+		// compare both boards from the same side
+		perspective = positions[0].pos.Turn()
+	}
+
+	var sb strings.Builder
+	for start := 0; start < len(positions); start += opts.columns {
+		end := min(start+opts.columns, len(positions))
+		if start != 0 {
+			sb.WriteString("\n")
+		}
+
+		blocks := make([][]string, 0, end-start)
+		for _, lp := range positions[start:end] {
+			boardSide := perspective
+			if boardSide == chess.NoColor {
+				boardSide = lp.pos.Turn()
+			}
+			lines := append([]string{lp.label},
+				asciiBoard(lp.pos, boardSide, opts.dark, marked, opts.plain)...)
+			blocks = append(blocks, lines)
+		}
+		sb.WriteString(joinColumns(blocks))
+	}
+	if opts.diff {
+		sb.WriteString(diffSummary(positions[0].pos, positions[1].pos, marked))
+	}
+
+	return sb.String(), nil
+}
+
+// asciiBoard draws p as chess.Board.Draw2 does, one string per line, with
+// marked squares highlighted
+func asciiBoard(p *chess.Position, perspective chess.Color, dark bool,
+	marked map[chess.Square]bool, plain bool) []string {
+
+	files := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	ranks := []int{7, 6, 5, 4, 3, 2, 1, 0}
+	header := " A B C D E F G H"
+	if perspective == chess.Black {
+		files = []int{7, 6, 5, 4, 3, 2, 1, 0}
+		ranks = []int{0, 1, 2, 3, 4, 5, 6, 7}
+		header = " H G F E D C B A"
+	}
+
+	b := p.Board()
+	lines := []string{header}
+	for _, r := range ranks {
+		var sb strings.Builder
+		sb.WriteString(chess.Rank(r).String())
+		for _, f := range files {
+			sq := chess.NewSquare(chess.File(f), chess.Rank(r))
+			piece := b.Piece(sq)
+			glyph := "-"
+			if piece != chess.NoPiece {
+				if dark {
+					glyph = piece.DarkString()
+				} else {
+					glyph = piece.String()
+				}
+			}
+			switch {
+			case !marked[sq]:
+				sb.WriteString(glyph + " ")
+			case plain:
+				sb.WriteString(glyph + "*")
+			default:
+				sb.WriteString(highlightStart + glyph + highlightEnd + " ")
+			}
+		}
+		lines = append(lines, sb.String())
+	}
+
+	return lines
+}
+
+// displayWidth counts terminal cells, ignoring highlighting escapes
+func displayWidth(line string) int {
+	line = strings.ReplaceAll(line, highlightStart, "")
+	line = strings.ReplaceAll(line, highlightEnd, "")
+
+	return utf8.RuneCountInString(line)
+}
+
+func joinColumns(blocks [][]string) string {
+	width := 0
+	height := 0
+	for _, block := range blocks {
+		height = max(height, len(block))
+		for _, line := range block {
+			width = max(width, displayWidth(line))
+		}
+	}
+
+	var sb strings.Builder
+	for row := 0; row < height; row++ {
+		var line strings.Builder
+		for idx, block := range blocks {
+			cell := ""
+			if row < len(block) {
+				cell = block[row]
+			}
+			line.WriteString(cell)
+			if idx != len(blocks)-1 {
+				line.WriteString(strings.Repeat(" ", width-displayWidth(cell)))
+				line.WriteString(columnGap)
+			}
+		}
+		sb.WriteString(strings.TrimRight(line.String(), " "))
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+func diffSquares(a, b *chess.Position) map[chess.Square]bool {
+	diff := make(map[chess.Square]bool)
+	for sqIdx := 0; sqIdx < 64; sqIdx++ {
+		sq := chess.Square(sqIdx)
+		if a.Board().Piece(sq) != b.Board().Piece(sq) {
+			diff[sq] = true
+		}
+	}
+
+	return diff
+}
+
+// diffSummary lists the differing squares followed by any other FEN fields
+// which differ, e.g. castling rights after transposing with a king move
+func diffSummary(a, b *chess.Position, marked map[chess.Square]bool) string {
+	var sb strings.Builder
+
+	squares := make([]string, 0, len(marked))
+	for sqIdx := 0; sqIdx < 64; sqIdx++ {
+		if marked[chess.Square(sqIdx)] {
+			squares = append(squares, chess.Square(sqIdx).String())
+		}
+	}
+	if len(squares) == 0 {
+		sb.WriteString("\nthe piece placement is identical\n")
+	} else {
+		fmt.Fprintf(&sb, "\n%v squares differ: %v\n", len(squares),
+			strings.Join(squares, " "))
+	}
+
+	aFields := strings.Fields(a.XFENString())
+	bFields := strings.Fields(b.XFENString())
+	for idx, name := range []string{"side to move", "castling", "en passant"} {
+		if aFields[idx+1] != bFields[idx+1] {
+			fmt.Fprintf(&sb, "%v differs: %v vs %v\n", name, aFields[idx+1],
+				bFields[idx+1])
+		}
+	}
+
+	return sb.String()
+}
@@ -1,23 +1,82 @@
 package fencat
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/corentings/chess/v2"
+	"github.com/mikeb26/chesstools"
+)
+
+type OutputFormat int
+
+const (
+	AsciiFormat OutputFormat = iota
+	SvgFormat
+	PngFormat
 )
 
 type FenCatOpts struct {
-	dark bool
+	dark    bool
+	format  OutputFormat
+	output  string
+	columns int
+	diff    bool
+	plain   bool
+	labels  []string
+
+	size       int
+	flip       bool
+	coords     bool
+	pieceSet   chesstools.PieceSet
+	theme      chesstools.DiagramTheme
+	highlights []chess.Square
+	arrows     []chesstools.DiagramArrow
+
 	fens []string
 }
 
 func parseArgs(args []string, opts *FenCatOpts) error {
 	opts.fens = make([]string, 0)
 	f := flag.NewFlagSet("fencat", flag.ExitOnError)
+	var formatFlag, piecesFlag, themeFlag, lightFlag, darkFlag string
+	var highlightFlag, highlightColorFlag, arrowFlag, arrowColorFlag string
+	var labelsFlag string
 
 	f.BoolVar(&opts.dark, "dark", false, "<true|false>")
+	f.IntVar(&opts.columns, "columns", 1,
+		"<N> print up to N ascii boards side by side")
+	f.BoolVar(&opts.diff, "diff", false,
+		"show 2 FENs side by side with the squares which differ highlighted")
+	f.BoolVar(&opts.plain, "plain", false,
+		"mark differing squares with * instead of terminal highlighting")
+	f.StringVar(&labelsFlag, "labels", "",
+		"<labels> comma separated labels for side by side boards")
+	f.StringVar(&formatFlag, "format", "ascii", "<ascii|svg|png>")
+	f.StringVar(&opts.output, "output", "",
+		"<svg or png file> (default stdout); with several FENs each is written to <name>-N.<ext>")
+	f.IntVar(&opts.size, "size", chesstools.DefaultDiagramSize,
+		"<pixels> svg or png board width and height")
+	f.BoolVar(&opts.flip, "flip", false, "show the board from black's side")
+	f.BoolVar(&opts.coords, "coords", true, "<true|false> label files and ranks")
+	f.StringVar(&piecesFlag, "pieces", "simple",
+		"<simple|unicode|letters> (png draws unicode as simple)")
+	f.StringVar(&themeFlag, "theme", chesstools.DefaultDiagramTheme,
+		"<brown|blue|green|gray>")
+	f.StringVar(&lightFlag, "lightsq", "", "<#rrggbb> light square color")
+	f.StringVar(&darkFlag, "darksq", "", "<#rrggbb> dark square color")
+	f.StringVar(&highlightFlag, "highlight", "",
+		"<squares> comma separated squares to highlight, e.g. e4,d5")
+	f.StringVar(&highlightColorFlag, "highlightcolor", "",
+		"<#rrggbb[aa]> highlight color")
+	f.StringVar(&arrowFlag, "arrow", "",
+		"<arrows> comma separated arrows to draw, e.g. e2e4,g1f3")
+	f.StringVar(&arrowColorFlag, "arrowcolor", "", "<#rrggbb[aa]> arrow color")
 
 	err := f.Parse(args)
 	if err != nil {
@@ -28,9 +87,125 @@ func parseArgs(args []string, opts *FenCatOpts) error {
 		opts.fens = append(opts.fens, fen)
 	}
 
+	switch strings.ToLower(formatFlag) {
+	case "ascii":
+		opts.format = AsciiFormat
+	case "svg":
+		opts.format = SvgFormat
+	case "png":
+		opts.format = PngFormat
+	default:
+		return fmt.Errorf("unknown --format %v; please choose ascii, svg, or png",
+			formatFlag)
+	}
+	if opts.size < 8 {
+		return fmt.Errorf("--size must be at least 8")
+	}
+	opts.pieceSet, err = chesstools.ParsePieceSet(piecesFlag)
+	if err != nil {
+		return err
+	}
+	theme, ok := chesstools.DiagramThemes[strings.ToLower(themeFlag)]
+	if !ok {
+		return fmt.Errorf("unknown --theme %v; please choose brown, blue, green, or gray",
+			themeFlag)
+	}
+	if lightFlag != "" {
+		theme.Light, err = chesstools.ParseHexColor(lightFlag)
+		if err != nil {
+			return err
+		}
+	}
+	if darkFlag != "" {
+		theme.Dark, err = chesstools.ParseHexColor(darkFlag)
+		if err != nil {
+			return err
+		}
+	}
+	if highlightColorFlag != "" {
+		theme.Highlight, err = chesstools.ParseHexColor(highlightColorFlag)
+		if err != nil {
+			return err
+		}
+	}
+	if arrowColorFlag != "" {
+		theme.Arrow, err = chesstools.ParseHexColor(arrowColorFlag)
+		if err != nil {
+			return err
+		}
+	}
+	opts.theme = theme
+
+	opts.highlights = make([]chess.Square, 0)
+	for _, name := range splitList(highlightFlag) {
+		sq, err := chesstools.ParseSquare(name)
+		if err != nil {
+			return err
+		}
+		opts.highlights = append(opts.highlights, sq)
+	}
+	opts.arrows = make([]chesstools.DiagramArrow, 0)
+	for _, name := range splitList(arrowFlag) {
+		arrow, err := chesstools.ParseArrow(name)
+		if err != nil {
+			return err
+		}
+		opts.arrows = append(opts.arrows, arrow)
+	}
+
+	opts.labels = splitList(labelsFlag)
+	if opts.columns < 1 {
+		return fmt.Errorf("--columns must be at least 1")
+	}
+	if opts.diff {
+		if len(opts.fens) != 2 {
+			return fmt.Errorf("--diff requires exactly 2 FENs")
+		}
+		opts.columns = 2
+	}
+	if opts.format != AsciiFormat && (opts.columns > 1 || opts.diff ||
+		len(opts.labels) != 0) {
+		return fmt.Errorf("--columns, --diff, and --labels require --format ascii")
+	}
+	if opts.format == AsciiFormat && (opts.flip || len(opts.highlights) != 0 ||
+		len(opts.arrows) != 0) {
+		return fmt.Errorf("--flip, --highlight, and --arrow require --format svg or png")
+	}
+	if len(opts.labels) != 0 && len(opts.labels) != len(opts.fens) {
+		return fmt.Errorf("please specify 1 label per FEN; found %v labels for %v FENs",
+			len(opts.labels), len(opts.fens))
+	}
+
+	if opts.format == AsciiFormat && opts.output != "" {
+		return fmt.Errorf("--output requires --format svg or png")
+	}
+	if opts.format != AsciiFormat && opts.output == "" && len(opts.fens) > 1 {
+		return fmt.Errorf("please specify --output when rendering more than 1 FEN as %v",
+			strings.ToLower(formatFlag))
+	}
+
 	return nil
 }
 
+func splitList(list string) []string {
+	ret := make([]string, 0)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			ret = append(ret, item)
+		}
+	}
+
+	return ret
+}
+
+// useColumns returns whether boards are laid out by renderColumns(), which
+// is also the only renderer that prints --labels
+func useColumns(opts *FenCatOpts) bool {
+	return opts.format == AsciiFormat &&
+		(opts.columns > 1 || len(opts.labels) != 0)
+}
+
 func Main(args []string) {
 	var opts FenCatOpts
 	err := parseArgs(args, &opts)
@@ -44,8 +219,18 @@ func Main(args []string) {
 		return
 	}
 
-	for _, fen := range opts.fens {
-		err = processOneFen(&opts, fen)
+	if useColumns(&opts) {
+		output, err := renderColumns(&opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Print(output)
+		return
+	}
+
+	for idx, fen := range opts.fens {
+		err = processOneFen(&opts, fen, idx+1)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%v\n", err)
 			os.Exit(1)
@@ -53,16 +238,100 @@ func Main(args []string) {
 	}
 }
 
-func processOneFen(opts *FenCatOpts, fen string) error {
-	fenCheck, err := chess.FEN(fen)
+func processOneFen(opts *FenCatOpts, fen string, fenNum int) error {
+	fenCheck, err := chesstools.LoadFEN(fen)
 	if err != nil {
-		return err
+		return chesstools.ExplainFENError(fen, err)
 	}
 	g := chess.NewGame(fenCheck)
 	p := g.Position()
-	b := p.Board()
 
+	if opts.format != AsciiFormat {
+		return writeDiagram(opts, p, fenNum)
+	}
+
+	b := p.Board()
 	fmt.Printf("%v", b.Draw2(p.Turn(), opts.dark))
 
 	return nil
 }
+
+func newDiagram(opts *FenCatOpts, p *chess.Position) *chesstools.Diagram {
+	return chesstools.NewDiagram(p).WithSize(opts.size).WithFlip(opts.flip).
+		WithCoordinates(opts.coords).WithPieceSet(opts.pieceSet).
+		WithTheme(opts.theme).WithHighlights(opts.highlights...).
+		WithArrows(opts.arrows...)
+}
+
+// outputFilename returns the file for the fenNum'th FEN; e.g. with
+// --output diag.svg the 2nd of several FENs is written to diag-2.svg
+func outputFilename(opts *FenCatOpts, fenNum int) string {
+	if len(opts.fens) <= 1 {
+		return opts.output
+	}
+	ext := filepath.Ext(opts.output)
+	base := strings.TrimSuffix(opts.output, ext)
+	if ext == "" {
+		ext = opts.format.ext()
+	}
+
+	return fmt.Sprintf("%v-%v%v", base, fenNum, ext)
+}
+
+func (format OutputFormat) ext() string {
+	if format == PngFormat {
+		return ".png"
+	}
+
+	return ".svg"
+}
+
+func writeOneDiagram(opts *FenCatOpts, out io.Writer,
+	diagram *chesstools.Diagram) error {
+
+	if opts.format == PngFormat {
+		return diagram.WritePNG(out)
+	}
+
+	return diagram.WriteSVG(out)
+}
+
+func writeDiagram(opts *FenCatOpts, p *chess.Position, fenNum int) error {
+	diagram := newDiagram(opts, p)
+	if opts.output == "" {
+		out := bufio.NewWriter(os.Stdout)
+		err := writeOneDiagram(opts, out, diagram)
+		if err != nil {
+			return err
+		}
+		return out.Flush()
+	}
+
+	filename := outputFilename(opts, fenNum)
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("Failed to create %v: %w", filename, err)
+	}
+	err = writeAndClose(opts, f, diagram)
+	if err != nil {
+		return fmt.Errorf("Failed to write %v: %w", filename, err)
+	}
+
+	return nil
+}
+
+func writeAndClose(opts *FenCatOpts, f io.WriteCloser,
+	diagram *chesstools.Diagram) error {
+
+	out := bufio.NewWriter(f)
+	err := writeOneDiagram(opts, out, diagram)
+	if err == nil {
+		err = out.Flush()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	return err
+}
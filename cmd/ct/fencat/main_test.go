@@ -0,0 +1,164 @@
+package fencat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/corentings/chess/v2"
+)
+
+const startFen = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+func TestParseArgs(t *testing.T) {
+	var opts FenCatOpts
+	err := parseArgs([]string{"--format", "svg", "--flip", "--theme", "blue",
+		"--darksq", "#112233", "--highlight", "e2, e4", "--arrow", "e2e4,g1f3",
+		startFen}, &opts)
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if opts.format != SvgFormat || !opts.flip || len(opts.fens) != 1 ||
+		len(opts.highlights) != 2 || opts.highlights[1] != chess.E4 ||
+		len(opts.arrows) != 2 || opts.arrows[1].To != chess.F3 {
+		t.Fatalf("unexpected opts %+v", opts)
+	}
+	if opts.theme.Dark.R != 0x11 || opts.theme.Light.R != 0xde {
+		t.Fatalf("unexpected theme %+v", opts.theme)
+	}
+
+	for _, bad := range [][]string{
+		{"--format", "jpeg", startFen},
+		{"--highlight", "e9", startFen},
+		{"--flip", startFen},
+		{"--highlight", "e4", startFen},
+		{"--arrow", "e2e4", startFen},
+		{"--theme", "purple", startFen},
+		{"--output", "a.svg", startFen},
+		{"--format", "svg", startFen, startFen},
+	} {
+		err = parseArgs(bad, &FenCatOpts{})
+		if err == nil {
+			t.Fatalf("expected an error for %v", bad)
+		}
+	}
+}
+
+func TestOutputFilename(t *testing.T) {
+	opts := FenCatOpts{output: "diag.svg", fens: []string{startFen}}
+	if outputFilename(&opts, 1) != "diag.svg" {
+		t.Fatalf("unexpected filename %v", outputFilename(&opts, 1))
+	}
+	opts.fens = append(opts.fens, startFen)
+	if outputFilename(&opts, 2) != "diag-2.svg" {
+		t.Fatalf("unexpected filename %v", outputFilename(&opts, 2))
+	}
+	opts.output = "diag"
+	opts.format = PngFormat
+	if outputFilename(&opts, 2) != "diag-2.png" {
+		t.Fatalf("unexpected filename %v", outputFilename(&opts, 2))
+	}
+}
+
+const (
+	e4Fen = "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1"
+	d4Fen = "rnbqkbnr/pppppppp/8/8/3P4/8/PPP1PPPP/RNBQKBNR b KQkq - 0 1"
+)
+
+func TestRenderColumns(t *testing.T) {
+	var opts FenCatOpts
+	err := parseArgs([]string{"--columns", "2", "--labels", "start,e4,d4",
+		startFen, e4Fen, d4Fen}, &opts)
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	output, err := renderColumns(&opts)
+	if err != nil {
+		t.Fatalf("renderColumns failed: %v", err)
+	}
+	lines := strings.Split(output, "\n")
+	// 2 rows of a label, a header, and 8 ranks separated by a blank line
+	if len(lines) != 22 || lines[0] != "start               e4" ||
+		lines[1] != " A B C D E F G H     H G F E D C B A" ||
+		lines[10] != "" || lines[11] != "d4" {
+		t.Fatalf("unexpected columns:\n%v", output)
+	}
+}
+
+func TestRenderLabels(t *testing.T) {
+	var opts FenCatOpts
+	err := parseArgs([]string{"--labels", "start", startFen}, &opts)
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if !useColumns(&opts) {
+		t.Fatalf("expected --labels to be rendered by renderColumns")
+	}
+	output, err := renderColumns(&opts)
+	if err != nil {
+		t.Fatalf("renderColumns failed: %v", err)
+	}
+	if !strings.HasPrefix(output, "start\n") {
+		t.Fatalf("expected the label first:\n%v", output)
+	}
+}
+
+func TestRenderDiff(t *testing.T) {
+	var opts FenCatOpts
+	err := parseArgs([]string{"--diff", "--plain", e4Fen, d4Fen}, &opts)
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	output, err := renderColumns(&opts)
+	if err != nil {
+		t.Fatalf("renderColumns failed: %v", err)
+	}
+	lines := strings.Split(output, "\n")
+	// both boards are drawn from black's side so d4 precedes e4 on rank 4
+	if lines[5] != "4- - - ♙*-*- - -    4- - - -*♙*- - -" ||
+		!strings.HasSuffix(output, "\n4 squares differ: d2 e2 d4 e4\n") {
+		t.Fatalf("unexpected diff:\n%v", output)
+	}
+
+	err = parseArgs([]string{"--diff", e4Fen}, &FenCatOpts{})
+	if err == nil {
+		t.Fatalf("expected an error for --diff with 1 FEN")
+	}
+	err = parseArgs([]string{"--columns", "2", "--format", "svg", "--output",
+		"a.svg", e4Fen, d4Fen}, &FenCatOpts{})
+	if err == nil {
+		t.Fatalf("expected an error for --columns with svg")
+	}
+}
+
+func TestDiffSummaryFields(t *testing.T) {
+	var opts FenCatOpts
+	err := parseArgs([]string{"--diff", startFen,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b Kq - 0 1"}, &opts)
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	output, err := renderColumns(&opts)
+	if err != nil {
+		t.Fatalf("renderColumns failed: %v", err)
+	}
+	if strings.Contains(output, highlightStart) ||
+		!strings.HasSuffix(output, "\nthe piece placement is identical\nside to move differs: w vs b\ncastling differs: KQkq vs Kq\n") {
+		t.Fatalf("unexpected diff:\n%v", output)
+	}
+}
+
+func TestDiffShredderFEN(t *testing.T) {
+	var opts FenCatOpts
+	err := parseArgs([]string{"--diff", startFen,
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w HAha - 0 1"}, &opts)
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	output, err := renderColumns(&opts)
+	if err != nil {
+		t.Fatalf("renderColumns failed: %v", err)
+	}
+	if !strings.HasSuffix(output, "\nthe piece placement is identical\n") {
+		t.Fatalf("unexpected diff:\n%v", output)
+	}
+}
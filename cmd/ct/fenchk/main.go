@@ -0,0 +1,143 @@
+/* Utility for explaining what is wrong with a FEN, e.g. a wrong field count,
+ * castling rights the piece placement cannot support, an impossible en
+ * passant square, or the side not to move being in check. With --repair,
+ * common mistakes are fixed and the repaired FEN is printed.
+ */
+
+package fenchk
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mikeb26/chesstools"
+)
+
+type FenChkOpts struct {
+	repair bool
+	quiet  bool
+	fens   []string
+}
+
+func parseArgs(args []string, opts *FenChkOpts) error {
+	f := flag.NewFlagSet("fenchk", flag.ExitOnError)
+
+	f.BoolVar(&opts.repair, "repair", false,
+		"fix common mistakes and print the repaired FEN")
+	f.BoolVar(&opts.quiet, "quiet", false,
+		"only print problems; with --repair only print the repaired FENs")
+
+	err := f.Parse(args)
+	if err != nil {
+		return err
+	}
+	opts.fens = f.Args()
+
+	return nil
+}
+
+func Main(args []string) {
+	var opts FenChkOpts
+	err := parseArgs(args, &opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse arguments: %v\n", err)
+		os.Exit(1)
+		return
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	var allOk bool
+	if len(opts.fens) == 0 {
+		allOk, err = checkReader(&opts, os.Stdin, out)
+	} else {
+		allOk = true
+		for _, fen := range opts.fens {
+			allOk = checkFen(&opts, fen, out) && allOk
+		}
+	}
+	flushErr := out.Flush()
+	if err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if !allOk {
+		os.Exit(1)
+	}
+}
+
+// checkReader checks each FEN in r, one per line, skipping blank lines and
+// # comments
+func checkReader(opts *FenChkOpts, r io.Reader, out io.Writer) (bool, error) {
+	allOk := true
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fen := strings.TrimSpace(scanner.Text())
+		if fen == "" || strings.HasPrefix(fen, "#") {
+			continue
+		}
+		allOk = checkFen(opts, fen, out) && allOk
+	}
+	err := scanner.Err()
+	if err != nil {
+		return false, fmt.Errorf("Failed to read FENs: %w", err)
+	}
+
+	return allOk, nil
+}
+
+// checkFen reports the issues with fen and returns whether it is valid, or
+// with --repair whether it could be repaired
+func checkFen(opts *FenChkOpts, fen string, out io.Writer) bool {
+	issues := chesstools.ValidateFEN(fen)
+	valid := !chesstools.HasFENErrors(issues)
+
+	if opts.repair && opts.quiet {
+		repaired, _, err := chesstools.RepairFEN(fen)
+		if err != nil {
+			fmt.Fprintf(out, "# %v: %v\n", fen, err)
+			return false
+		}
+		fmt.Fprintf(out, "%v\n", repaired)
+		return true
+	}
+
+	switch {
+	case len(issues) == 0:
+		if !opts.quiet {
+			fmt.Fprintf(out, "%v: ok\n", fen)
+		}
+		return true
+	case valid:
+		fmt.Fprintf(out, "%v: ok with warnings\n", fen)
+	default:
+		fmt.Fprintf(out, "%v: invalid\n", fen)
+	}
+	for _, issue := range issues {
+		fmt.Fprintf(out, "\t%v\n", issue)
+	}
+	if !opts.repair {
+		return valid
+	}
+
+	repaired, repairs, err := chesstools.RepairFEN(fen)
+	if err != nil {
+		fmt.Fprintf(out, "\t%v\n", err)
+		return false
+	}
+	if len(repairs) == 0 {
+		return true
+	}
+	fmt.Fprintf(out, "\trepaired: %v\n", repaired)
+	for _, repair := range repairs {
+		fmt.Fprintf(out, "\t\t%v\n", repair)
+	}
+
+	return true
+}
@@ -0,0 +1,51 @@
+package fenchk
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const badFen = "4k3/8/8/8/8/8/8/4K2R w Kq - 0"
+
+func TestCheckFen(t *testing.T) {
+	var buf bytes.Buffer
+	ok := checkFen(&FenChkOpts{}, badFen, &buf)
+	expected := badFen + `: invalid
+	error: fen: expected 6 space separated fields but found 5
+	error: castling: q requires a black rook queenside of the king on e8
+`
+	if ok || buf.String() != expected {
+		t.Fatalf("unexpected output ok:%v\n%v", ok, buf.String())
+	}
+
+	buf.Reset()
+	ok = checkFen(&FenChkOpts{repair: true}, badFen, &buf)
+	if !ok || !strings.HasSuffix(buf.String(),
+		"\trepaired: 4k3/8/8/8/8/8/8/4K2R w K - 0 1\n\t\tcastling rights Kq -> K\n\t\tassumed fullmove number 1\n") {
+		t.Fatalf("unexpected output ok:%v\n%v", ok, buf.String())
+	}
+
+	buf.Reset()
+	ok = checkFen(&FenChkOpts{repair: true, quiet: true}, badFen, &buf)
+	if !ok || buf.String() != "4k3/8/8/8/8/8/8/4K2R w K - 0 1\n" {
+		t.Fatalf("unexpected output ok:%v\n%v", ok, buf.String())
+	}
+}
+
+func TestCheckReader(t *testing.T) {
+	input := `# comment
+rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1
+
+P3k3/8/8/8/8/8/8/4K3 w - - 0 1
+`
+	var buf bytes.Buffer
+	ok, err := checkReader(&FenChkOpts{quiet: true}, strings.NewReader(input),
+		&buf)
+	if err != nil {
+		t.Fatalf("checkReader failed: %v", err)
+	}
+	if ok || buf.String() != "P3k3/8/8/8/8/8/8/4K3 w - - 0 1: invalid\n\terror: placement: white pawn on a8\n" {
+		t.Fatalf("unexpected output ok:%v\n%v", ok, buf.String())
+	}
+}
@@ -8,14 +8,22 @@ import (
 	"sort"
 
 	gen960 "github.com/mikeb26/chesstools/cmd/ct/960gen"
+	prep960 "github.com/mikeb26/chesstools/cmd/ct/960prep"
+	"github.com/mikeb26/chesstools/cmd/ct/eco"
 	"github.com/mikeb26/chesstools/cmd/ct/eval"
 	"github.com/mikeb26/chesstools/cmd/ct/fencat"
+	"github.com/mikeb26/chesstools/cmd/ct/fenchk"
+	"github.com/mikeb26/chesstools/cmd/ct/openings"
 	"github.com/mikeb26/chesstools/cmd/ct/pgn2fen"
+	"github.com/mikeb26/chesstools/cmd/ct/pgn2gif"
 	"github.com/mikeb26/chesstools/cmd/ct/pgnfilt"
+	"github.com/mikeb26/chesstools/cmd/ct/pgnmerge"
 	"github.com/mikeb26/chesstools/cmd/ct/pgnmk"
 	"github.com/mikeb26/chesstools/cmd/ct/repmk"
 	"github.com/mikeb26/chesstools/cmd/ct/repvld"
+	"github.com/mikeb26/chesstools/cmd/ct/scout"
 	"github.com/mikeb26/chesstools/cmd/ct/splunk"
+	"github.com/mikeb26/chesstools/cmd/ct/tree"
 )
 
 type command struct {
@@ -26,14 +34,22 @@ type command struct {
 
 var commands = []command{
 	{name: "960gen", description: "print Chess960 start FENs", run: gen960.Main},
+	{name: "960prep", description: "prepare the first moves of a Chess960 start position", run: prep960.Main},
+	{name: "eco", description: "print ECO codes and opening names of games", run: eco.Main},
 	{name: "eval", description: "evaluate a FEN or PGN position", run: eval.Main},
+	{name: "scout", description: "build an opening report for a Lichess player", run: scout.Main},
 	{name: "splunk", description: "find players who have had positions", run: splunk.Main},
-	{name: "fencat", description: "render FENs as ASCII boards", run: fencat.Main},
+	{name: "fencat", description: "render FENs as ASCII boards or SVG/PNG diagrams", run: fencat.Main},
+	{name: "fenchk", description: "explain and repair invalid FENs", run: fenchk.Main},
+	{name: "openings", description: "look up openings by name or ECO code", run: openings.Main},
 	{name: "pgn2fen", description: "convert PGNs to FENs", run: pgn2fen.Main},
+	{name: "pgn2gif", description: "render a game as an animated GIF", run: pgn2gif.Main},
 	{name: "pgnfilt", description: "filter PGN files", run: pgnfilt.Main},
+	{name: "pgnmerge", description: "merge PGN files into a single move tree", run: pgnmerge.Main},
 	{name: "pgnmk", description: "interactively create PGNs", run: pgnmk.Main},
 	{name: "repmk", description: "build opening repertoires", run: repmk.Main},
 	{name: "repvld", description: "validate opening repertoires", run: repvld.Main},
+	{name: "tree", description: "summarize PGN games as an opening tree", run: tree.Main},
 	{name: "version", description: "print ct version", run: versionMain},
 	{name: "upgrade", description: "upgrade ct to the latest release", run: upgradeMain},
 }
@@ -0,0 +1,116 @@
+/* Utility for looking up openings by name or ECO code */
+
+package openings
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/corentings/chess/v2"
+	"github.com/mikeb26/chesstools"
+)
+
+type OpeningsOpts struct {
+	dark    bool
+	noBoard bool
+	query   string
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: ct openings search [--dark] [--noboard] <name>")
+	fmt.Fprintln(w, "       ct openings eco [--dark] [--noboard] <ecoCode>")
+}
+
+func parseArgs(subCmd string, args []string, opts *OpeningsOpts) error {
+	f := flag.NewFlagSet("openings "+subCmd, flag.ExitOnError)
+
+	f.BoolVar(&opts.dark, "dark", false, "<true|false>")
+	f.BoolVar(&opts.noBoard, "noboard", false, "do not render a board for each opening")
+
+	err := f.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if len(f.Args()) == 0 {
+		return fmt.Errorf("please specify an opening name or ECO code")
+	}
+	opts.query = strings.Join(f.Args(), " ")
+
+	return nil
+}
+
+func Main(args []string) {
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		os.Exit(1)
+	}
+
+	var lookup func(string) []*chesstools.Opening
+	switch args[0] {
+	case "-h", "--help", "help":
+		printUsage(os.Stdout)
+		return
+	case "search":
+		lookup = chesstools.SearchOpenings
+	case "eco":
+		lookup = chesstools.GetOpeningsByEco
+	default:
+		fmt.Fprintf(os.Stderr, "openings: unknown subcommand %q\n", args[0])
+		printUsage(os.Stderr)
+		os.Exit(1)
+	}
+
+	var opts OpeningsOpts
+	err := parseArgs(args[0], args[1:], &opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse arguments: %v\n", err)
+		os.Exit(1)
+		return
+	}
+
+	matches := lookup(opts.query)
+	if len(matches) == 0 {
+		fmt.Fprintf(os.Stderr, "openings: no openings match '%v'\n", opts.query)
+		os.Exit(1)
+	}
+
+	for idx, opening := range matches {
+		if idx != 0 {
+			fmt.Printf("\n")
+		}
+		out, err := openingString(&opts, opening)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%v", out)
+	}
+}
+
+func openingString(opts *OpeningsOpts, opening *chesstools.Opening) (string, error) {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("%v %v\n", opening.Eco(), opening.Name()))
+	if opening.Moves() != "" {
+		sb.WriteString(fmt.Sprintf("  Moves: %v\n", opening.Moves()))
+	}
+	sb.WriteString(fmt.Sprintf("  FEN: \"%v\"\n", opening.FEN()))
+
+	if opts.noBoard {
+		return sb.String(), nil
+	}
+
+	fenCheck, err := chess.FEN(opening.FEN())
+	if err != nil {
+		return "", fmt.Errorf("Invalid FEN for opening %v: %w", opening.Name(),
+			err)
+	}
+	p := chess.NewGame(fenCheck).Position()
+	sb.WriteString(p.Board().Draw2(p.Turn(), opts.dark))
+
+	return sb.String(), nil
+}
@@ -0,0 +1,37 @@
+package openings
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mikeb26/chesstools"
+)
+
+func TestOpeningString(t *testing.T) {
+	matches := chesstools.SearchOpenings("Amar Opening: Paris Gambit, Gent Gambit")
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match but got %v", len(matches))
+	}
+
+	opts := &OpeningsOpts{noBoard: true}
+	got, err := openingString(opts, matches[0])
+	if err != nil {
+		t.Fatalf("openingString failed: %v", err)
+	}
+	expected := `A00 Amar Opening: Paris Gambit, Gent Gambit
+  Moves: 1. Nh3 d5 2. g3 e5 3. f4 Bxh3 4. Bxh3 exf4 5. O-O fxg3 6. hxg3
+  FEN: "rn1qkbnr/ppp2ppp/8/3p4/8/6PB/PPPPP3/RNBQ1RK1 b kq - 0 6"
+`
+	if got != expected {
+		t.Fatalf("Expected %v got %v", expected, got)
+	}
+
+	opts.noBoard = false
+	got, err = openingString(opts, matches[0])
+	if err != nil {
+		t.Fatalf("openingString failed: %v", err)
+	}
+	if !strings.HasPrefix(got, expected) || len(got) == len(expected) {
+		t.Fatalf("expected board to follow opening details: %v", got)
+	}
+}
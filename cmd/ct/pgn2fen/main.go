@@ -1,9 +1,13 @@
 package pgn2fen
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/corentings/chess/v2"
@@ -11,15 +15,26 @@ import (
 )
 
 const NoEndMove = 10000
+const NoEndPly = 2 * NoEndMove
 
 type Pgn2FenOpts struct {
 	all          bool
 	startMoveNum int
 	endMoveNum   int
+	startPly     int
+	endPly       int
+	afterMove    int
 	color        string
 	colorc       chess.Color
 	pgnFiles     []string
 	expandVar    bool
+	strict       bool
+	jobs         int
+	unordered    bool
+	stats        bool
+	format       OutputFormat
+	unique       bool
+	count        bool
 }
 
 func NewPgn2FenOpts() *Pgn2FenOpts {
@@ -27,10 +42,18 @@ func NewPgn2FenOpts() *Pgn2FenOpts {
 		all:          false,
 		startMoveNum: 0,
 		endMoveNum:   NoEndMove,
+		startPly:     0,
+		endPly:       NoEndPly,
+		afterMove:    0,
 		color:        "",
 		colorc:       chess.NoColor,
 		pgnFiles:     make([]string, 0),
 		expandVar:    false,
+		strict:       false,
+		jobs:         runtime.NumCPU(),
+		unordered:    false,
+		stats:        false,
+		format:       FenFormat,
 	}
 
 	return opts
@@ -42,19 +65,44 @@ func parseArgs(args []string, opts *Pgn2FenOpts) error {
 	f := flag.NewFlagSet("pgn2fen", flag.ExitOnError)
 
 	opts.colorc = chess.NoColor
+	var formatFlag string
+	f.StringVar(&formatFlag, "format", "fen", "<fen|epd|jsonl|csv>")
+	f.BoolVar(&opts.unique, "unique", opts.unique,
+		"emit each position only the first time it is reached")
+	f.BoolVar(&opts.count, "count", opts.count,
+		"emit each position once with the number and list of games reaching it, most frequent first")
 	f.BoolVar(&opts.all, "all", opts.all, "<true|false>")
 	f.BoolVar(&opts.expandVar, "includevar", opts.expandVar, "include variations in pgn <true|false>")
+	f.BoolVar(&opts.strict, "strict", opts.strict,
+		"abort on the first malformed game instead of skipping it")
+	f.IntVar(&opts.jobs, "jobs", opts.jobs,
+		"number of games to parse in parallel")
+	f.BoolVar(&opts.unordered, "unordered", opts.unordered,
+		"emit FENs as soon as each game is done rather than in input order")
+	f.BoolVar(&opts.stats, "stats", opts.stats, "report throughput on stderr")
 	f.StringVar(&opts.color, "color", opts.color, "<white|black>")
 	f.IntVar(&opts.startMoveNum, "startmove", opts.startMoveNum,
 		"start move number (defaults to 0)")
 	f.IntVar(&opts.endMoveNum, "endmove", opts.endMoveNum,
 		"ending move number")
+	f.IntVar(&opts.startPly, "startply", opts.startPly,
+		"first ply to include; ply 0 is the starting position")
+	f.IntVar(&opts.endPly, "endply", opts.endPly, "last ply to include")
+	f.IntVar(&opts.afterMove, "aftermove", opts.afterMove,
+		"only the position right after move N with --color (default white) to move")
 
 	err := f.Parse(args)
 	if err != nil {
 		return err
 	}
 
+	opts.format, err = parseFormat(formatFlag)
+	if err != nil {
+		return err
+	}
+	if opts.unique && opts.count {
+		return fmt.Errorf("--unique and --count are mutually exclusive")
+	}
 	if opts.color != "" && opts.all {
 		return fmt.Errorf("--all and --color are mutually exclusive")
 	}
@@ -64,6 +112,24 @@ func parseArgs(args []string, opts *Pgn2FenOpts) error {
 	if opts.all && opts.endMoveNum != NoEndMove {
 		return fmt.Errorf("--all and --endmove are mutually exclusive")
 	}
+	if opts.all && (opts.startPly != 0 || opts.endPly != NoEndPly) {
+		return fmt.Errorf("--all and --startply/--endply are mutually exclusive")
+	}
+	if opts.afterMove < 0 {
+		return fmt.Errorf("--aftermove must be >= 1")
+	}
+	if opts.afterMove > 0 && (opts.all || opts.startMoveNum != 0 ||
+		opts.endMoveNum != NoEndMove || opts.startPly != 0 ||
+		opts.endPly != NoEndPly) {
+		return fmt.Errorf("--aftermove is mutually exclusive with --all and the move and ply ranges")
+	}
+	if opts.startPly > opts.endPly {
+		return fmt.Errorf("--startply(%v) must be <= --endply(%v)",
+			opts.startPly, opts.endPly)
+	}
+	if opts.jobs < 1 {
+		return fmt.Errorf("--jobs must be >= 1")
+	}
 	if opts.startMoveNum > opts.endMoveNum {
 		return fmt.Errorf("--startmove(%v) must be <= --endmove(%v)",
 			opts.startMoveNum, opts.endMoveNum)
@@ -80,6 +146,9 @@ func parseArgs(args []string, opts *Pgn2FenOpts) error {
 	for _, pgnFile := range f.Args() {
 		opts.pgnFiles = append(opts.pgnFiles, pgnFile)
 	}
+	if len(opts.pgnFiles) == 0 {
+		opts.pgnFiles = append(opts.pgnFiles, chesstools.StdinPgn)
+	}
 
 	return nil
 }
@@ -94,78 +163,130 @@ func Main(args []string) {
 		return
 	}
 
-	if len(opts.pgnFiles) == 0 {
-		pgn, err := chess.PGN(os.Stdin)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "%v\n", err)
-			os.Exit(1)
+	out := bufio.NewWriter(os.Stdout)
+	var tally *positionTally
+	if opts.unique || opts.count {
+		tally = newPositionTally(opts, out)
+	}
+	if opts.format == CsvFormat {
+		if opts.count {
+			out.WriteString(tally.countsHeader())
+		} else {
+			out.WriteString(csvHeader())
 		}
-
-		g := chess.NewGame(pgn)
-
-		fens := game2FENs(opts, g)
-		fmt.Printf("%v", fens)
-
-		return
 	}
 
+	pipeline := chesstools.NewPgnPipeline(opts.jobs).WithStrict(opts.strict).
+		WithExpandVariations(opts.expandVar).WithOrdered(!opts.unordered)
+	if opts.stats {
+		pipeline.WithProgress(chesstools.DefaultProgressInterval)
+	}
 	for _, pgnFile := range opts.pgnFiles {
-		err = processOnePgn(opts, pgnFile)
+		err = processOnePgn(opts, pipeline, tally, pgnFile, out)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%v\n", err)
-			os.Exit(1)
+			break
 		}
 	}
+	if err == nil && opts.count {
+		err = tally.writeCounts()
+	}
+	out.Flush()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if opts.stats {
+		fmt.Fprintf(os.Stderr, "%v\n", pipeline.Stats())
+	}
 }
 
-func processOnePgn(opts *Pgn2FenOpts, pgnFile string) error {
+func processOnePgn(opts *Pgn2FenOpts, pipeline *chesstools.PgnPipeline,
+	tally *positionTally, pgnFile string, out io.Writer) error {
+
 	f, err := chesstools.OpenPgn(pgnFile)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	var scanner *chess.Scanner
-
-	if opts.expandVar {
-		scanner = chess.NewScanner(f, chess.WithExpandVariations())
-	} else {
-		scanner = chess.NewScanner(f)
+	if tally != nil {
+		// positions are compared in input order so the tally is kept by the
+		// emitting goroutine
+		return chesstools.RunPgnResults(pipeline, f, pgnFile,
+			tally.buildRecords, tally.addRecords)
 	}
 
-	ii := 1
-	for scanner.HasNext() {
-		g, err := scanner.ParseNext()
-		if err != nil {
-			return err
+	return pipeline.Run(f, pgnFile,
+		func(g *chess.Game, info chesstools.PgnGameInfo) (string, error) {
+			if len(g.Moves()) == 0 {
+				return "", nil
+			}
+			return formatGame(opts, g, info)
+		}, out)
+}
+
+func fenMoveNumber(pos *chess.Position) int {
+	fenFields := strings.Fields(pos.XFENString())
+	moveNum, _ := strconv.Atoi(fenFields[len(fenFields)-1])
+
+	return moveNum
+}
+
+// selectPlies returns the plies of the positions in g selected by opts,
+// where ply 0 is the starting position. move numbers are those of the
+// positions' FENs so games starting from a set up position are handled.
+func selectPlies(opts *Pgn2FenOpts, g *chess.Game) []int {
+	positions := g.Positions()
+
+	if opts.afterMove > 0 {
+		// after white's move N black is to move in move N; after black's
+		// move N white is to move in move N+1
+		color := opts.colorc
+		targetMoveNum := opts.afterMove
+		if color != chess.Black {
+			color = chess.White
+			targetMoveNum++
 		}
+		for idx, pos := range positions {
+			if pos.Turn() == color && fenMoveNumber(pos) == targetMoveNum {
+				return []int{idx}
+			}
+		}
+		return []int{}
+	}
+
+	if !opts.all && opts.colorc == chess.NoColor && opts.startMoveNum == 0 &&
+		opts.endMoveNum == NoEndMove && opts.startPly == 0 &&
+		opts.endPly == NoEndPly {
+
+		return []int{len(positions) - 1}
+	} // else
 
-		if len(g.Moves()) == 0 {
+	plies := make([]int, 0)
+	for idx, pos := range positions {
+		if opts.colorc != chess.NoColor && opts.colorc != pos.Turn() {
 			continue
 		}
-		fens := game2FENs(opts, g)
-		fmt.Printf("%v", fens)
-		ii++
+		if opts.all {
+			plies = append(plies, idx)
+			continue
+		}
+		moveNum := fenMoveNumber(pos)
+		if moveNum >= opts.startMoveNum && moveNum <= opts.endMoveNum &&
+			idx >= opts.startPly && idx <= opts.endPly {
+			plies = append(plies, idx)
+		}
 	}
 
-	return nil
+	return plies
 }
 
 func game2FENs(opts *Pgn2FenOpts, g *chess.Game) string {
-	if !opts.all && opts.colorc == chess.NoColor && opts.startMoveNum == 0 &&
-		opts.endMoveNum == NoEndMove {
-
-		return fmt.Sprintf("%v\n", g.Position().XFENString())
-	} // else
-
 	var sb strings.Builder
 
-	for idx, pos := range g.Positions() {
-		if (opts.colorc == chess.NoColor || opts.colorc == pos.Turn()) &&
-			(opts.all || ((idx/2+1) >= opts.startMoveNum &&
-				(idx/2+1) <= opts.endMoveNum)) {
-			sb.WriteString(fmt.Sprintf("%v\n", pos.XFENString()))
-		}
+	positions := g.Positions()
+	for _, ply := range selectPlies(opts, g) {
+		sb.WriteString(fmt.Sprintf("%v\n", positions[ply].XFENString()))
 	}
 
 	return sb.String()
@@ -1,10 +1,13 @@
 package pgn2fen
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"strings"
 	"testing"
 
 	"github.com/corentings/chess/v2"
+	"github.com/mikeb26/chesstools"
 )
 
 func loadPgn(t *testing.T) *chess.Game {
@@ -326,3 +329,190 @@ r1bqkb1r/1pp1nppp/p1np4/4p3/B3P3/2N2N2/PPPP1PPP/R1BQ1RK1 b kq - 1 6
 		t.Fatalf("Expected %v got %v", expectedFENs, fens)
 	}
 }
+
+func TestRecordFormats(t *testing.T) {
+	g := loadPgn(t)
+	g.AddTagPair("White", "alice")
+	opts := NewPgn2FenOpts()
+	opts.startMoveNum = 1
+	opts.endMoveNum = 1
+	info := chesstools.PgnGameInfo{Name: "games.pgn", GameNum: 3}
+
+	records := game2Records(opts, g, info)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records but got %v", len(records))
+	}
+	rec := records[1]
+	if rec.Game != 3 || rec.Source != "games.pgn" || rec.Ply != 1 ||
+		rec.MoveNumber != 1 || rec.MoveInSan != "e4" || rec.MoveInUci != "e2e4" ||
+		rec.MoveOutSan != "e5" || rec.MoveOutUci != "e7e5" ||
+		rec.Tags["White"] != "alice" || rec.Eco != "B00" ||
+		rec.Opening != "King's Pawn Game" ||
+		rec.NormalFen != "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1" {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	if records[0].MoveInSan != "" || records[0].MoveOutSan != "e4" {
+		t.Fatalf("unexpected starting position record %+v", records[0])
+	}
+
+	opts.format = EpdFormat
+	out, err := formatGame(opts, g, info)
+	if err != nil {
+		t.Fatalf("formatGame failed: %v", err)
+	}
+	expectedEpd := `rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - id "games.pgn#3"; ct_ply 1; fmvn 1; hmvc 0; ct_lm e4; ct_lmuci e2e4; sm e5; ct_smuci e7e5; eco "B00"; ct_opening "King's Pawn Game"; ct_white "alice";`
+	if strings.Split(out, "\n")[1] != expectedEpd {
+		t.Fatalf("unexpected epd:\n%v", out)
+	}
+
+	opts.format = JsonlFormat
+	out, err = formatGame(opts, g, info)
+	if err != nil {
+		t.Fatalf("formatGame failed: %v", err)
+	}
+	var decoded fenRecord
+	err = json.Unmarshal([]byte(strings.Split(out, "\n")[1]), &decoded)
+	if err != nil || decoded.Fen != rec.Fen || decoded.MoveOutUci != "e7e5" {
+		t.Fatalf("unexpected jsonl %v: %v", out, err)
+	}
+
+	opts.format = CsvFormat
+	out, err = formatGame(opts, g, info)
+	if err != nil {
+		t.Fatalf("formatGame failed: %v", err)
+	}
+	rows, err := csv.NewReader(strings.NewReader(csvHeader() + out)).ReadAll()
+	if err != nil || len(rows) != 3 || len(rows[0]) != len(rows[2]) {
+		t.Fatalf("unexpected csv %v: %v", out, err)
+	}
+	if rows[2][0] != "3" || rows[2][6] != "alice" || rows[2][len(rows[2])-1] != "King's Pawn Game" {
+		t.Fatalf("unexpected csv row %v", rows[2])
+	}
+}
+
+func TestUniqueAndCount(t *testing.T) {
+	pgns := []string{"1. e4 e5 2. Nf3 *", "1. Nf3 e5 2. e4 Nc6 *", "1. e4 c5 *"}
+	games := make([]*chess.Game, 0)
+	for _, pgn := range pgns {
+		pgnArgs, err := chess.PGN(strings.NewReader(pgn))
+		if err != nil {
+			t.Fatalf("Failed to read pgn: %v", err)
+		}
+		games = append(games, chess.NewGame(pgnArgs))
+	}
+
+	opts := NewPgn2FenOpts()
+	opts.all = true
+	opts.unique = true
+	var buf strings.Builder
+	tally := newPositionTally(opts, &buf)
+	for ii, g := range games {
+		info := chesstools.PgnGameInfo{Name: "a.pgn", GameNum: ii + 1}
+		records, err := tally.buildRecords(g, info)
+		if err != nil {
+			t.Fatalf("buildRecords failed: %v", err)
+		}
+		err = tally.addRecords(records, g, info)
+		if err != nil {
+			t.Fatalf("addRecords failed: %v", err)
+		}
+	}
+	// 4 from the first game, Nf3, Nf3 e5 and Nc6 from the second and c5
+	// from the third; 1. Nf3 e5 2. e4 transposes
+	if strings.Count(buf.String(), "\n") != 8 {
+		t.Fatalf("unexpected unique positions:\n%v", buf.String())
+	}
+
+	opts.unique = false
+	opts.count = true
+	buf.Reset()
+	tally = newPositionTally(opts, &buf)
+	for ii, g := range games {
+		info := chesstools.PgnGameInfo{Name: "a.pgn", GameNum: ii + 1}
+		records := game2Records(opts, g, info)
+		tally.addRecords(records, g, info)
+		// a variation of the same game reaching the same positions
+		tally.addRecords(records, g, info)
+	}
+	err := tally.writeCounts()
+	if err != nil {
+		t.Fatalf("writeCounts failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 8 {
+		t.Fatalf("unexpected counts:\n%v", buf.String())
+	}
+	if lines[0] != "3\trnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1\ta.pgn#1,a.pgn#2,a.pgn#3" {
+		t.Fatalf("unexpected most frequent position %v", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "2\t") || !strings.HasPrefix(lines[2], "2\t") ||
+		!strings.HasPrefix(lines[3], "1\t") {
+		t.Fatalf("expected positions sorted by frequency:\n%v", buf.String())
+	}
+}
+
+func TestPlyRangeAndAfterMove(t *testing.T) {
+	g := loadPgn(t)
+	opts := NewPgn2FenOpts()
+	opts.startPly = 2
+	opts.endPly = 3
+
+	expectedFENs := `rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2
+rnbqkbnr/pppp1ppp/8/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2
+`
+	fens := game2FENs(opts, g)
+	if fens != expectedFENs {
+		t.Fatalf("Expected %v got %v", expectedFENs, fens)
+	}
+
+	opts = NewPgn2FenOpts()
+	opts.afterMove = 3
+	opts.colorc = chess.Black
+	expectedFENs = "r1bqkbnr/pppp1ppp/2n5/1B2p3/4P3/5N2/PPPP1PPP/RNBQK2R b KQkq - 3 3\n"
+	fens = game2FENs(opts, g)
+	if fens != expectedFENs {
+		t.Fatalf("Expected %v got %v", expectedFENs, fens)
+	}
+
+	opts.colorc = chess.NoColor
+	expectedFENs = "r1bqkbnr/1ppp1ppp/p1n5/1B2p3/4P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 0 4\n"
+	fens = game2FENs(opts, g)
+	if fens != expectedFENs {
+		t.Fatalf("Expected %v got %v", expectedFENs, fens)
+	}
+
+	// move numbers come from the game's FEN when it starts mid game
+	pgn := `[SetUp "1"]
+[FEN "r1bqkbnr/pppp1ppp/2n5/1B2p3/4P3/5N2/PPPP1PPP/RNBQK2R b KQkq - 3 3"]
+
+3... a6 4. Ba4 Nf6 *`
+	pgnArgs, err := chess.PGN(strings.NewReader(pgn))
+	if err != nil {
+		t.Fatalf("Failed to read pgn: %v", err)
+	}
+	opts.afterMove = 4
+	opts.colorc = chess.Black
+	expectedFENs = "r1bqkbnr/1ppp1ppp/p1n5/4p3/B3P3/5N2/PPPP1PPP/RNBQK2R b KQkq - 1 4\n"
+	fens = game2FENs(opts, chess.NewGame(pgnArgs))
+	if fens != expectedFENs {
+		t.Fatalf("Expected %v got %v", expectedFENs, fens)
+	}
+}
+
+func TestParseArgsStdin(t *testing.T) {
+	opts := NewPgn2FenOpts()
+	err := parseArgs([]string{"--includevar"}, opts)
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if len(opts.pgnFiles) != 1 || opts.pgnFiles[0] != chesstools.StdinPgn {
+		t.Fatalf("expected stdin to be read without PGN files but got %v",
+			opts.pgnFiles)
+	}
+
+	err = parseArgs([]string{"--aftermove", "3", "--startply", "2"},
+		NewPgn2FenOpts())
+	if err == nil {
+		t.Fatalf("expected --aftermove and --startply to conflict")
+	}
+}
@@ -0,0 +1,220 @@
+package pgn2fen
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/corentings/chess/v2"
+	"github.com/mikeb26/chesstools"
+)
+
+type OutputFormat int
+
+const (
+	FenFormat OutputFormat = iota
+	EpdFormat
+	JsonlFormat
+	CsvFormat
+)
+
+// the tags carried by each record, in output order
+var recordTags = []string{"Event", "Site", "Date", "Round", "White", "Black",
+	"Result", "WhiteElo", "BlackElo", "TimeControl"}
+
+// fenRecord describes one selected position along with where it came from.
+// MoveIn is the move which reached the position and MoveOut the move played
+// from it; both are empty where there is no such move.
+type fenRecord struct {
+	Game       int               `json:"game"`
+	Source     string            `json:"source"`
+	Tags       map[string]string `json:"tags"`
+	Ply        int               `json:"ply"`
+	MoveNumber int               `json:"move_number"`
+	MoveInSan  string            `json:"move_in_san"`
+	MoveInUci  string            `json:"move_in_uci"`
+	MoveOutSan string            `json:"move_out_san"`
+	MoveOutUci string            `json:"move_out_uci"`
+	Fen        string            `json:"fen"`
+	NormalFen  string            `json:"normalized_fen"`
+	Eco        string            `json:"eco"`
+	Opening    string            `json:"opening"`
+}
+
+func parseFormat(format string) (OutputFormat, error) {
+	switch strings.ToLower(format) {
+	case "fen":
+		return FenFormat, nil
+	case "epd":
+		return EpdFormat, nil
+	case "jsonl":
+		return JsonlFormat, nil
+	case "csv":
+		return CsvFormat, nil
+	}
+
+	return FenFormat, fmt.Errorf("unknown --format %v; please choose fen, epd, jsonl, or csv",
+		format)
+}
+
+func game2Records(opts *Pgn2FenOpts, g *chess.Game,
+	info chesstools.PgnGameInfo) []fenRecord {
+
+	tags := make(map[string]string)
+	for _, tag := range recordTags {
+		val := g.GetTagPair(tag)
+		if val != "" {
+			tags[tag] = val
+		}
+	}
+
+	positions := g.Positions()
+	moves := g.Moves()
+	encoder := chess.AlgebraicNotation{}
+	records := make([]fenRecord, 0)
+
+	for _, ply := range selectPlies(opts, g) {
+		fen := positions[ply].XFENString()
+		normalFen, _ := chesstools.NormalizeFEN(fen)
+
+		rec := fenRecord{
+			Game:       info.GameNum,
+			Source:     info.Name,
+			Tags:       tags,
+			Ply:        ply,
+			MoveNumber: fenMoveNumber(positions[ply]),
+			Fen:        fen,
+			NormalFen:  normalFen,
+			Eco:        chesstools.GetOpeningEco(fen),
+			Opening:    chesstools.GetOpeningName(fen),
+		}
+		if ply > 0 {
+			rec.MoveInSan = encoder.Encode(positions[ply-1], moves[ply-1])
+			rec.MoveInUci = moves[ply-1].String()
+		}
+		if ply < len(moves) {
+			rec.MoveOutSan = encoder.Encode(positions[ply], moves[ply])
+			rec.MoveOutUci = moves[ply].String()
+		}
+		records = append(records, rec)
+	}
+
+	return records
+}
+
+func csvHeader() string {
+	header := []string{"game", "source"}
+	for _, tag := range recordTags {
+		header = append(header, strings.ToLower(tag))
+	}
+	header = append(header, "ply", "move_number", "move_in_san", "move_in_uci",
+		"move_out_san", "move_out_uci", "fen", "normalized_fen", "eco", "opening")
+
+	var sb strings.Builder
+	w := csv.NewWriter(&sb)
+	w.Write(header)
+	w.Flush()
+
+	return sb.String()
+}
+
+func (rec *fenRecord) csvFields() []string {
+	fields := []string{strconv.Itoa(rec.Game), rec.Source}
+	for _, tag := range recordTags {
+		fields = append(fields, rec.Tags[tag])
+	}
+
+	return append(fields, strconv.Itoa(rec.Ply), strconv.Itoa(rec.MoveNumber),
+		rec.MoveInSan, rec.MoveInUci, rec.MoveOutSan, rec.MoveOutUci, rec.Fen,
+		rec.NormalFen, rec.Eco, rec.Opening)
+}
+
+// privateOp prefixes the EPD opcodes pgn2fen invents; id, fmvn, hmvc, sm,
+// and eco are the standard ones from the PGN specification
+const privateOp = "ct_"
+
+func epdString(val string) string {
+	return strconv.Quote(val)
+}
+
+// e.g. rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - id "a.pgn#1";
+// ct_ply 1; fmvn 1; hmvc 0; ct_lm e4; ct_lmuci e2e4; sm e5; ...
+func (rec *fenRecord) epdLine() string {
+	fenFields := strings.Fields(rec.Fen)
+	ops := []string{
+		"id " + epdString(fmt.Sprintf("%v#%v", rec.Source, rec.Game)),
+		fmt.Sprintf("%vply %v", privateOp, rec.Ply),
+		fmt.Sprintf("fmvn %v", rec.MoveNumber),
+		fmt.Sprintf("hmvc %v", fenFields[4]),
+	}
+	if rec.MoveInSan != "" {
+		ops = append(ops, privateOp+"lm "+rec.MoveInSan,
+			privateOp+"lmuci "+rec.MoveInUci)
+	}
+	if rec.MoveOutSan != "" {
+		ops = append(ops, "sm "+rec.MoveOutSan,
+			privateOp+"smuci "+rec.MoveOutUci)
+	}
+	if rec.Eco != "" {
+		ops = append(ops, "eco "+epdString(rec.Eco),
+			privateOp+"opening "+epdString(rec.Opening))
+	}
+	for _, tag := range recordTags {
+		val, ok := rec.Tags[tag]
+		if ok {
+			ops = append(ops, privateOp+strings.ToLower(tag)+" "+
+				epdString(val))
+		}
+	}
+
+	return strings.Join(fenFields[:4], " ") + " " + strings.Join(ops, "; ") +
+		";"
+}
+
+// formatGame renders the selected positions of g in opts' output format
+func formatGame(opts *Pgn2FenOpts, g *chess.Game,
+	info chesstools.PgnGameInfo) (string, error) {
+
+	if opts.format == FenFormat {
+		return game2FENs(opts, g), nil
+	}
+
+	return formatRecords(opts.format, game2Records(opts, g, info))
+}
+
+func formatRecords(format OutputFormat, records []fenRecord) (string, error) {
+	var sb strings.Builder
+	var csvWriter *csv.Writer
+	if format == CsvFormat {
+		csvWriter = csv.NewWriter(&sb)
+	}
+	for _, rec := range records {
+		switch format {
+		case FenFormat:
+			sb.WriteString(rec.Fen)
+			sb.WriteString("\n")
+		case EpdFormat:
+			sb.WriteString(rec.epdLine())
+			sb.WriteString("\n")
+		case JsonlFormat:
+			encoded, err := json.Marshal(&rec)
+			if err != nil {
+				return "", err
+			}
+			sb.Write(encoded)
+			sb.WriteString("\n")
+		case CsvFormat:
+			csvWriter.Write(rec.csvFields())
+		}
+	}
+	if csvWriter != nil {
+		csvWriter.Flush()
+		if csvWriter.Error() != nil {
+			return "", csvWriter.Error()
+		}
+	}
+
+	return sb.String(), nil
+}
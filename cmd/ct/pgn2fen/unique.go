@@ -0,0 +1,165 @@
+package pgn2fen
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/corentings/chess/v2"
+	"github.com/mikeb26/chesstools"
+)
+
+// positionCount tallies the games reaching one normalized position
+type positionCount struct {
+	NormalFen string   `json:"normalized_fen"`
+	Count     int      `json:"count"`
+	Games     []string `json:"games"`
+	Eco       string   `json:"eco"`
+	Opening   string   `json:"opening"`
+
+	lastGame string
+}
+
+// positionTally implements --unique and --count. the pipeline's workers
+// build each game's records and hand them to the emitting goroutine, which
+// alone merges them into counts and order.
+type positionTally struct {
+	opts *Pgn2FenOpts
+	out  io.Writer
+
+	counts map[string]*positionCount
+	order  []*positionCount
+}
+
+func newPositionTally(opts *Pgn2FenOpts, out io.Writer) *positionTally {
+	return &positionTally{
+		opts:   opts,
+		out:    out,
+		counts: make(map[string]*positionCount),
+		order:  make([]*positionCount, 0),
+	}
+}
+
+// buildRecords is run by the pipeline's workers; it returns the records of
+// g for addRecords() to merge
+func (tally *positionTally) buildRecords(g *chess.Game,
+	info chesstools.PgnGameInfo) ([]fenRecord, error) {
+
+	if len(g.Moves()) == 0 {
+		return nil, nil
+	}
+
+	return game2Records(tally.opts, g, info), nil
+}
+
+// addRecords counts each of a game's records. with --unique the first
+// occurrence of each position is written immediately. a position is counted
+// once per game even when variations reach it more than once.
+func (tally *positionTally) addRecords(records []fenRecord, _ *chess.Game,
+	info chesstools.PgnGameInfo) error {
+
+	gameId := fmt.Sprintf("%v#%v", info.Name, info.GameNum)
+
+	for _, rec := range records {
+		pc, ok := tally.counts[rec.NormalFen]
+		if !ok {
+			pc = &positionCount{
+				NormalFen: rec.NormalFen,
+				Games:     make([]string, 0),
+				Eco:       rec.Eco,
+				Opening:   rec.Opening,
+			}
+			tally.counts[rec.NormalFen] = pc
+			tally.order = append(tally.order, pc)
+
+			if tally.opts.unique {
+				output, err := formatRecords(tally.opts.format,
+					[]fenRecord{rec})
+				if err != nil {
+					return err
+				}
+				_, err = io.WriteString(tally.out, output)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if pc.lastGame == gameId {
+			continue
+		}
+		pc.lastGame = gameId
+		pc.Count++
+		if tally.opts.count {
+			pc.Games = append(pc.Games, gameId)
+		}
+	}
+
+	return nil
+}
+
+func (tally *positionTally) countsHeader() string {
+	if tally.opts.format != CsvFormat {
+		return ""
+	}
+
+	return "count,normalized_fen,eco,opening,games\n"
+}
+
+// writeCounts writes every position, most frequent first
+func (tally *positionTally) writeCounts() error {
+	sort.SliceStable(tally.order, func(i, j int) bool {
+		return tally.order[i].Count > tally.order[j].Count
+	})
+
+	var csvWriter *csv.Writer
+	if tally.opts.format == CsvFormat {
+		csvWriter = csv.NewWriter(tally.out)
+	}
+	for _, pc := range tally.order {
+		var err error
+		switch tally.opts.format {
+		case FenFormat:
+			_, err = fmt.Fprintf(tally.out, "%v\t%v\t%v\n", pc.Count,
+				pc.NormalFen, strings.Join(pc.Games, ","))
+		case EpdFormat:
+			_, err = fmt.Fprintf(tally.out, "%v\n", pc.epdLine())
+		case JsonlFormat:
+			var encoded []byte
+			encoded, err = json.Marshal(pc)
+			if err == nil {
+				_, err = fmt.Fprintf(tally.out, "%s\n", encoded)
+			}
+		case CsvFormat:
+			err = csvWriter.Write([]string{strconv.Itoa(pc.Count), pc.NormalFen,
+				pc.Eco, pc.Opening, strings.Join(pc.Games, " ")})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if csvWriter != nil {
+		csvWriter.Flush()
+		return csvWriter.Error()
+	}
+
+	return nil
+}
+
+func (pc *positionCount) epdLine() string {
+	fenFields := strings.Fields(pc.NormalFen)
+	ops := []string{
+		fmt.Sprintf("%vcount %v", privateOp, pc.Count),
+		privateOp + "games " + epdString(strings.Join(pc.Games, " ")),
+	}
+	if pc.Eco != "" {
+		ops = append(ops, "eco "+epdString(pc.Eco),
+			privateOp+"opening "+epdString(pc.Opening))
+	}
+
+	return strings.Join(fenFields[:4], " ") + " " + strings.Join(ops, "; ") +
+		";"
+}
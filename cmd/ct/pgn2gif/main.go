@@ -0,0 +1,234 @@
+/* Utility for rendering a game, or one line of a repertoire, as an animated
+ * GIF. Each move's from and to squares are highlighted and with --eval an eval
+ * bar shows the cached engine evaluation of each position. Only the Go
+ * standard library image packages are used so no fonts or GUI are needed.
+ */
+
+package pgn2gif
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/corentings/chess/v2"
+	"github.com/mikeb26/chesstools"
+)
+
+type Pgn2GifOpts struct {
+	output   string
+	gameNum  int
+	lineNum  int
+	delay    int
+	size     int
+	flip     bool
+	coords   bool
+	pieceSet chesstools.PieceSet
+	theme    chesstools.DiagramTheme
+	eval     bool
+	pgnFile  string
+}
+
+func parseArgs(args []string, opts *Pgn2GifOpts) error {
+	f := flag.NewFlagSet("pgn2gif", flag.ExitOnError)
+	var piecesFlag, themeFlag string
+
+	f.StringVar(&opts.output, "output", "", "<gif file> (default stdout)")
+	f.IntVar(&opts.gameNum, "game", 1, "<N> render the Nth game of the PGN")
+	f.IntVar(&opts.lineNum, "line", 1,
+		"<N> render the Nth line of the game's variations; 1 is the main line")
+	f.IntVar(&opts.delay, "delay", chesstools.DefaultGIFDelay,
+		"<100ths of a second> to show each move")
+	f.IntVar(&opts.size, "size", chesstools.DefaultDiagramSize,
+		"<pixels> board width and height")
+	f.BoolVar(&opts.flip, "flip", false, "show the board from black's side")
+	f.BoolVar(&opts.coords, "coords", true, "<true|false> label files and ranks")
+	f.StringVar(&piecesFlag, "pieces", "simple", "<simple|letters>")
+	f.StringVar(&themeFlag, "theme", chesstools.DefaultDiagramTheme,
+		"<brown|blue|green|gray>")
+	f.BoolVar(&opts.eval, "eval", false,
+		"show an eval bar from locally cached engine evaluations")
+
+	err := f.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	switch len(f.Args()) {
+	case 0:
+		opts.pgnFile = chesstools.StdinPgn
+	case 1:
+		opts.pgnFile = f.Args()[0]
+	default:
+		return fmt.Errorf("please specify at most 1 PGN file")
+	}
+	if opts.gameNum < 1 || opts.lineNum < 1 {
+		return fmt.Errorf("--game and --line start at 1")
+	}
+	if opts.delay < 1 {
+		return fmt.Errorf("--delay must be positive")
+	}
+	if opts.size < 8 {
+		return fmt.Errorf("--size must be at least 8")
+	}
+	opts.pieceSet, err = chesstools.ParsePieceSet(piecesFlag)
+	if err != nil {
+		return err
+	}
+	theme, ok := chesstools.DiagramThemes[strings.ToLower(themeFlag)]
+	if !ok {
+		return fmt.Errorf("unknown --theme %v; please choose brown, blue, green, or gray",
+			themeFlag)
+	}
+	opts.theme = theme
+
+	return nil
+}
+
+func Main(args []string) {
+	var opts Pgn2GifOpts
+	err := parseArgs(args, &opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse arguments: %v\n", err)
+		os.Exit(1)
+		return
+	}
+
+	line, err := loadLine(&opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	var evalFunc func(fen string) *chesstools.EvalResult
+	if opts.eval {
+		evalCtx := newCacheEvalCtx(line)
+		defer evalCtx.Close()
+		evalFunc = func(fen string) *chesstools.EvalResult {
+			evalCtx.SetFEN(fen)
+			return evalCtx.Eval()
+		}
+	}
+	frames := lineFrames(&opts, line, evalFunc)
+
+	err = writeOutput(&opts, frames)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+// loadLine returns the requested line of the requested game
+func loadLine(opts *Pgn2GifOpts) (*chess.Game, error) {
+	f, err := chesstools.OpenPgn(opts.pgnFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return findLine(opts, f, opts.pgnFile)
+}
+
+func findLine(opts *Pgn2GifOpts, r io.Reader, name string) (*chess.Game,
+	error) {
+
+	scanner := chesstools.NewPgnStream(r, name)
+	for scanner.HasNext() {
+		g, err := scanner.ParseNext()
+		if err != nil {
+			return nil, err
+		}
+		if scanner.GameNum() != opts.gameNum {
+			continue
+		}
+
+		lines := g.Split()
+		if len(lines) == 0 {
+			if opts.lineNum == 1 {
+				return g, nil
+			}
+			lines = []*chess.Game{g}
+		}
+		if opts.lineNum > len(lines) {
+			return nil, fmt.Errorf("%v#%v has %v lines; cannot render line %v",
+				name, opts.gameNum, len(lines), opts.lineNum)
+		}
+		return lines[opts.lineNum-1], nil
+	}
+
+	return nil, fmt.Errorf("%v has fewer than %v games", name, opts.gameNum)
+}
+
+// newCacheEvalCtx looks up positions in the local eval cache without
+// starting stockfish
+func newCacheEvalCtx(line *chess.Game) *chesstools.EvalCtx {
+	startFen := line.GetRootMove().Position().XFENString()
+	evalCtx := chesstools.NewEvalCtx(true).WithoutEngine().WithFEN(startFen).
+		WithoutCloudCache().WithoutAtime()
+	evalCtx.InitEngine()
+
+	return evalCtx
+}
+
+// lineFrames returns one diagram for the start position and one after each
+// move. positions missing from the cache keep the previous eval.
+func lineFrames(opts *Pgn2GifOpts, line *chess.Game,
+	evalFunc func(fen string) *chesstools.EvalResult) []*chesstools.Diagram {
+
+	positions := line.Positions()
+	moves := line.Moves()
+	frames := make([]*chesstools.Diagram, 0, len(positions))
+	var lastEval *chesstools.EvalResult
+
+	for ii, pos := range positions {
+		diagram := chesstools.NewDiagram(pos).WithSize(opts.size).
+			WithFlip(opts.flip).WithCoordinates(opts.coords).
+			WithPieceSet(opts.pieceSet).WithTheme(opts.theme)
+		if ii > 0 {
+			diagram = diagram.WithHighlights(moves[ii-1].S1(), moves[ii-1].S2())
+		}
+		if evalFunc != nil {
+			er := evalFunc(pos.XFENString())
+			if er != nil {
+				lastEval = er
+			}
+			diagram = diagram.WithEvalBar(lastEval)
+		}
+		frames = append(frames, diagram)
+	}
+
+	return frames
+}
+
+func writeOutput(opts *Pgn2GifOpts, frames []*chesstools.Diagram) error {
+	if opts.output == "" {
+		out := bufio.NewWriter(os.Stdout)
+		err := chesstools.WriteGIF(out, frames, opts.delay)
+		if err != nil {
+			return err
+		}
+		return out.Flush()
+	}
+
+	f, err := os.Create(opts.output)
+	if err != nil {
+		return fmt.Errorf("Failed to create %v: %w", opts.output, err)
+	}
+	out := bufio.NewWriter(f)
+	err = chesstools.WriteGIF(out, frames, opts.delay)
+	if err == nil {
+		err = out.Flush()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to write %v: %w", opts.output, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package pgn2gif
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/corentings/chess/v2"
+	"github.com/mikeb26/chesstools"
+)
+
+const testPgn = `[Event "First"]
+
+1. d4 d5 *
+
+[Event "Repertoire"]
+
+1. e4 e5 (1... c5 2. Nf3) 2. Nf3 *
+`
+
+func TestParseArgs(t *testing.T) {
+	var opts Pgn2GifOpts
+	err := parseArgs([]string{"--game", "2", "--line", "3", "--pieces",
+		"letters", "rep.pgn"}, &opts)
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if opts.gameNum != 2 || opts.lineNum != 3 ||
+		opts.pieceSet != chesstools.LetterPieces || opts.pgnFile != "rep.pgn" {
+		t.Fatalf("unexpected opts %+v", opts)
+	}
+
+	err = parseArgs([]string{}, &opts)
+	if err != nil || opts.pgnFile != chesstools.StdinPgn {
+		t.Fatalf("expected stdin without a PGN file; err:%v", err)
+	}
+	err = parseArgs([]string{"--line", "0"}, &Pgn2GifOpts{})
+	if err == nil {
+		t.Fatalf("expected an error for --line 0")
+	}
+}
+
+func TestFindLine(t *testing.T) {
+	opts := Pgn2GifOpts{gameNum: 2, lineNum: 2}
+	line, err := findLine(&opts, strings.NewReader(testPgn), "rep.pgn")
+	if err != nil {
+		t.Fatalf("findLine failed: %v", err)
+	}
+	if len(line.Moves()) != 3 || line.Moves()[1].String() != "c7c5" {
+		t.Fatalf("unexpected line %v", line.Moves())
+	}
+
+	opts.lineNum = 3
+	_, err = findLine(&opts, strings.NewReader(testPgn), "rep.pgn")
+	if err == nil {
+		t.Fatalf("expected an error for a missing line")
+	}
+	opts = Pgn2GifOpts{gameNum: 3, lineNum: 1}
+	_, err = findLine(&opts, strings.NewReader(testPgn), "rep.pgn")
+	if err == nil {
+		t.Fatalf("expected an error for a missing game")
+	}
+}
+
+func TestLineFrames(t *testing.T) {
+	opts := Pgn2GifOpts{gameNum: 2, lineNum: 1, size: 80,
+		theme: chesstools.DiagramThemes[chesstools.DefaultDiagramTheme]}
+	line, err := findLine(&opts, strings.NewReader(testPgn), "rep.pgn")
+	if err != nil {
+		t.Fatalf("findLine failed: %v", err)
+	}
+
+	// only the position after 1. e4 is cached
+	afterE4 := line.Positions()[1].XFENString()
+	evalFunc := func(fen string) *chesstools.EvalResult {
+		if fen == afterE4 {
+			return &chesstools.EvalResult{CP: 400}
+		}
+		return nil
+	}
+	frames := lineFrames(&opts, line, evalFunc)
+	if len(frames) != 4 {
+		t.Fatalf("expected 4 frames but got %v", len(frames))
+	}
+
+	theme := opts.theme
+	// e2 and e4 are highlighted after 1. e4 but not before
+	img := frames[0].Image()
+	if img.RGBAAt(41, 61) != theme.Light {
+		t.Fatalf("unexpected e2 before 1. e4: %v", img.RGBAAt(41, 61))
+	}
+	img = frames[1].Image()
+	if img.RGBAAt(41, 61) == theme.Light {
+		t.Fatalf("expected e2 to be highlighted after 1. e4")
+	}
+	// the eval after 1. e4 carries over to the uncached position after 1... e5
+	if frames[2].Width() != 85 || frames[2].Image().RGBAAt(82, 30) !=
+		(chesstools.NewDiagram(chess.StartingPosition()).WithSize(80).
+			WithEvalBar(&chesstools.EvalResult{CP: 400}).Image().RGBAAt(82, 30)) {
+		t.Fatalf("expected the eval to carry over")
+	}
+	if frames[0].Image().RGBAAt(82, 30) == frames[2].Image().RGBAAt(82, 30) {
+		t.Fatalf("expected an even bar before any eval")
+	}
+}
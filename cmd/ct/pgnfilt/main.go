@@ -7,29 +7,51 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"runtime"
+	"strings"
 
 	"github.com/corentings/chess/v2"
 	"github.com/mikeb26/chesstools"
 )
 
 type FiltOpts struct {
-	fen   string
-	white string
+	fen      string
+	white    string
+	where    string
+	material string
+	pattern  string
+	pawns    string
+	persist  int
+
+	normalFen    string
+	whereExpr    whereNode
+	structFilter *structFilter
+}
+
+// ProcOpts controls how input PGNs are read rather than which games match
+type ProcOpts struct {
+	expandVar bool
+	strict    bool
+	jobs      int
+	unordered bool
+	stats     bool
 }
 
 type FiltCtx struct {
 	pgnFileList []string
 	fopts       FiltOpts
-	expandVar   bool
+	popts       ProcOpts
+	oopts       OutOpts
 }
 
-func NewFiltCtx(pgns []string, foptsIn FiltOpts,
-	expandVarIn bool) *FiltCtx {
+func NewFiltCtx(pgns []string, foptsIn FiltOpts, poptsIn ProcOpts,
+	ooptsIn OutOpts) *FiltCtx {
 
 	rv := &FiltCtx{
 		pgnFileList: make([]string, len(pgns)),
 		fopts:       foptsIn,
-		expandVar:   expandVarIn,
+		popts:       poptsIn,
+		oopts:       ooptsIn,
 	}
 	for ii, p := range pgns {
 		rv.pgnFileList[ii] = p
@@ -40,14 +62,15 @@ func NewFiltCtx(pgns []string, foptsIn FiltOpts,
 
 func Main(args []string) {
 	fopts := FiltOpts{}
-	expandVar := false
-	pgnList, err := parseArgs(args, &fopts, &expandVar)
+	popts := ProcOpts{}
+	oopts := OutOpts{}
+	pgnList, err := parseArgs(args, &fopts, &popts, &oopts)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to parse arguments: %v\n", err)
 		return
 	}
 
-	filtCtx := NewFiltCtx(pgnList, fopts, expandVar)
+	filtCtx := NewFiltCtx(pgnList, fopts, popts, oopts)
 	err = filtCtx.LoadAndFilter()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to load PGN files: %v\n", err)
@@ -55,89 +78,209 @@ func Main(args []string) {
 	}
 }
 
-func parseArgs(args []string, fopts *FiltOpts, expandVar *bool) ([]string, error) {
+func parseArgs(args []string, fopts *FiltOpts, popts *ProcOpts,
+	oopts *OutOpts) ([]string, error) {
+
 	f := flag.NewFlagSet("pgnfilt", flag.ExitOnError)
 
 	f.StringVar(&fopts.fen, "fen", "", "includes this specific position")
 	f.StringVar(&fopts.white, "white", "", "includes this player as white")
+	f.StringVar(&fopts.where, "where", "",
+		"includes games matching this expression, e.g. 'player=foo and eco>=B20 and eco<=B99 and result=0-1'")
+	f.StringVar(&fopts.material, "material", "",
+		"includes games reaching this material, e.g. KRPvKR or KBPPvKB,ocb (or opposite-colored-bishops) for opposite colored bishops")
+	f.StringVar(&fopts.pattern, "pattern", "",
+		"includes games reaching this FEN board pattern where ? matches any square")
+	f.StringVar(&fopts.pawns, "pawns", "",
+		"includes games reaching the pawn structure of this FEN")
+	f.IntVar(&fopts.persist, "persist", 1,
+		"minimum consecutive plies --material, --pattern and --pawns must hold")
+	f.BoolVar(&popts.strict, "strict", false,
+		"abort on the first malformed game instead of skipping it")
+	f.IntVar(&popts.jobs, "jobs", runtime.NumCPU(),
+		"number of games to parse and filter in parallel")
+	f.BoolVar(&popts.unordered, "unordered", false,
+		"emit matches as soon as they are found rather than in input order")
+	f.BoolVar(&popts.stats, "stats", false, "report throughput on stderr")
+	f.BoolVar(&popts.expandVar, "includevar", false,
+		"also search variations; a game matches if any of its lines does")
+	f.BoolVar(&oopts.varPaths, "varpaths", false,
+		"print the path of each matching variation instead of games (implies --includevar)")
+	f.BoolVar(&oopts.varOnly, "varonly", false,
+		"write only the matching variations, each as a standalone game (implies --includevar)")
+	f.StringVar(&oopts.output, "output", "",
+		"write matches to this file (or directory with --splitby) instead of stdout")
+	f.StringVar(&oopts.splitBy, "splitby", "",
+		"write matches to one file per value of this tag, e.g. ECO or White")
+	f.BoolVar(&oopts.count, "count", false, "print only the number of matches")
+	f.BoolVar(&oopts.summary, "summary", false,
+		"print only a table of games, matches and results per PGN")
+	f.BoolVar(&oopts.raw, "raw", false,
+		"write matches verbatim as they appear in the input")
+	f.BoolVar(&oopts.dedupe, "dedupe", false,
+		"drop games with the same players and moves as an earlier match")
 	f.Parse(args)
 
 	if len(f.Args()) == 0 {
 		return nil, fmt.Errorf("please specify 1 or more PGN files to filter")
 	}
+	if popts.jobs < 1 {
+		return nil, fmt.Errorf("--jobs must be >= 1")
+	}
+	if oopts.varPaths && oopts.varOnly {
+		return nil, fmt.Errorf("--varpaths and --varonly are mutually exclusive")
+	}
+	if oopts.raw && (oopts.varPaths || oopts.varOnly) {
+		return nil, fmt.Errorf("--raw cannot be combined with --varpaths or --varonly")
+	}
+	if oopts.varPaths || oopts.varOnly {
+		popts.expandVar = true
+	}
+	if oopts.count && oopts.summary {
+		return nil, fmt.Errorf("--count and --summary are mutually exclusive")
+	}
+	if oopts.dedupe && popts.unordered {
+		// which duplicate is kept would vary from run to run
+		return nil, fmt.Errorf("--dedupe and --unordered are mutually exclusive")
+	}
+	if fopts.fen != "" {
+		normalFen, err := chesstools.NormalizeFEN(fopts.fen)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --fen %v: %w", fopts.fen, err)
+		}
+		fopts.normalFen = normalFen
+	}
+	structFilter, err := newStructFilter(fopts.material, fopts.pattern,
+		fopts.pawns, fopts.persist)
+	if err != nil {
+		return nil, err
+	}
+	fopts.structFilter = structFilter
+	if fopts.where != "" {
+		whereExpr, err := parseWhere(fopts.where)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --where: %w", err)
+		}
+		fopts.whereExpr = whereExpr
+	}
 	return f.Args(), nil
 }
 
 func (filtCtx *FiltCtx) LoadAndFilter() error {
+	return filtCtx.loadAndFilter(os.Stdout)
+}
+
+func (filtCtx *FiltCtx) loadAndFilter(stdout io.Writer) error {
+	pipeline := chesstools.NewPgnPipeline(filtCtx.popts.jobs).
+		WithStrict(filtCtx.popts.strict).
+		WithOrdered(!filtCtx.popts.unordered)
+	if filtCtx.popts.stats {
+		pipeline.WithProgress(chesstools.DefaultProgressInterval)
+	}
+	fo, err := newFiltOutput(filtCtx.oopts, stdout)
+	if err != nil {
+		return err
+	}
+
 	for _, pgnFilename := range filtCtx.pgnFileList {
 		f, err := chesstools.OpenPgn(pgnFilename)
 		if err != nil {
+			fo.Close()
 			return err
 		}
 		defer f.Close()
 
-		err = filtCtx.processOnePGN(f)
+		err = filtCtx.processOnePGN(pipeline, f, pgnFilename, fo)
 		if err != nil {
+			fo.Close()
 			return err
 		}
 	}
+	err = fo.Close()
+	if err != nil {
+		return err
+	}
+	if filtCtx.popts.stats {
+		fmt.Fprintf(os.Stderr, "%v\n", pipeline.Stats())
+	}
 
 	return nil
 }
 
-func (filtCtx *FiltCtx) processOnePGN(f io.Reader) error {
-	var scanner *chess.Scanner
-	if filtCtx.expandVar {
-		scanner = chess.NewScanner(f, chess.WithExpandVariations())
-	} else {
-		scanner = chess.NewScanner(f)
-	}
+func (filtCtx *FiltCtx) processOnePGN(pipeline *chesstools.PgnPipeline,
+	f io.Reader, pgnFilename string, fo *filtOutput) error {
 
-	for scanner.HasNext() {
-		g, err := scanner.ParseNext()
-		if err != nil {
-			return err
+	skippedBefore := pipeline.Stats().Skipped
+	fo.startPgn(pgnFilename)
+	err := pipeline.RunEmit(f, pgnFilename, filtCtx.processOneGame, fo.emit)
+	fo.finishPgn(pipeline.Stats().Skipped - skippedBefore)
+
+	return err
+}
+
+func (filtCtx *FiltCtx) processOneGame(g *chess.Game,
+	info chesstools.PgnGameInfo) (string, error) {
+
+	if len(g.Moves()) == 0 {
+		return "", nil
+	}
+	if !filtCtx.popts.expandVar {
+		if !filtCtx.filterMatches(g) {
+			return "", nil
 		}
-		if len(g.Moves()) == 0 {
+		return filtCtx.formatGame(g, info), nil
+	}
+
+	// a game matches if any of its lines does
+	var sb strings.Builder
+	matched := false
+	for _, line := range gameLines(g) {
+		if !filtCtx.filterMatches(line.g) {
 			continue
 		}
-
-		err = filtCtx.processOneGame(g)
-		if err != nil {
-			return err
+		matched = true
+		if filtCtx.oopts.varPaths {
+			sb.WriteString(fmt.Sprintf("%v#%v %v: %v\n", info.Name,
+				info.GameNum, g.GetTagPair("Event"), line.path))
+		} else if filtCtx.oopts.varOnly {
+			lineGame := standaloneLine(line, info.Name, info.GameNum)
+			sb.WriteString(fmt.Sprintf("%v\n",
+				chesstools.NewPgnWriter().GameString(lineGame)))
 		}
 	}
+	if matched && !filtCtx.oopts.varPaths && !filtCtx.oopts.varOnly {
+		return filtCtx.formatGame(g, info), nil
+	}
 
-	return nil
+	return sb.String(), nil
 }
 
-func (filtCtx *FiltCtx) processOneGame(g *chess.Game) error {
-	if !filtCtx.filterMatches(g) {
-		return nil
-	}
+func (filtCtx *FiltCtx) formatGame(g *chess.Game,
+	info chesstools.PgnGameInfo) string {
 
-	fmt.Printf("%v\n\n\n", g.String())
+	if filtCtx.oopts.raw {
+		return fmt.Sprintf("%v\n\n", info.Raw)
+	}
 
-	return nil
+	return fmt.Sprintf("%v\n", chesstools.NewPgnWriter().GameString(g))
 }
 
+// all specified filters must match
 func (filtCtx *FiltCtx) filterMatches(g *chess.Game) bool {
-	isMatch := true
-
-	if filtCtx.fopts.fen != "" {
-		isMatch = false
-
-		for _, p := range g.Positions() {
-			foptsFen, _ := chesstools.NormalizeFEN(filtCtx.fopts.fen)
-			gameFen, _ := chesstools.NormalizeFEN(p.XFENString())
-			if foptsFen == gameFen {
-				isMatch = true
-				break
-			}
-		}
-	} else if filtCtx.fopts.white != "" {
-		isMatch = (g.GetTagPair("White") == filtCtx.fopts.white)
+	gv := newGameView(g)
+
+	if filtCtx.fopts.normalFen != "" && !gv.reachedFen(filtCtx.fopts.normalFen) {
+		return false
+	}
+	if filtCtx.fopts.white != "" && g.GetTagPair("White") != filtCtx.fopts.white {
+		return false
+	}
+	if filtCtx.fopts.whereExpr != nil && !filtCtx.fopts.whereExpr.eval(gv) {
+		return false
+	}
+	if filtCtx.fopts.structFilter != nil && !filtCtx.fopts.structFilter.matches(g) {
+		return false
 	}
 
-	return isMatch
+	return true
 }
@@ -0,0 +1,414 @@
+package pgnfilt
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/corentings/chess/v2"
+)
+
+const testPgn = `[Event "Club Championship"]
+[Date "2024.03.15"]
+[White "Alice"]
+[Black "bob"]
+[WhiteElo "2100"]
+[BlackElo "1950"]
+[Result "0-1"]
+[ECO "B22"]
+[TimeControl "300+3"]
+
+1. e4 c5 2. c3 Nf6 3. e5 Nd5 0-1
+
+[Event "Rapid Open"]
+[Date "2023.11.02"]
+[White "carol"]
+[Black "alice"]
+[WhiteElo "1800"]
+[BlackElo "2120"]
+[Result "1/2-1/2"]
+[ECO "C50"]
+[TimeControl "900+10"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bc4 Bc5 1/2-1/2
+`
+
+func loadTestGames(t *testing.T) []*chess.Game {
+	scanner := chess.NewScanner(strings.NewReader(testPgn))
+	games := make([]*chess.Game, 0)
+	for scanner.HasNext() {
+		g, err := scanner.ParseNext()
+		if err != nil {
+			t.Fatalf("failed to parse test pgn: %v", err)
+		}
+		games = append(games, g)
+	}
+
+	return games
+}
+
+func matchingEvents(t *testing.T, where string) string {
+	expr, err := parseWhere(where)
+	if err != nil {
+		t.Fatalf("parseWhere(%v) failed: %v", where, err)
+	}
+	events := make([]string, 0)
+	for _, g := range loadTestGames(t) {
+		if expr.eval(newGameView(g)) {
+			events = append(events, g.GetTagPair("Event"))
+		}
+	}
+
+	return strings.Join(events, ",")
+}
+
+func TestWhere(t *testing.T) {
+	tests := []struct {
+		where    string
+		expected string
+	}{
+		{"player=alice", "Club Championship,Rapid Open"},
+		{"white=alice", "Club Championship"},
+		{"player!=alice", ""},
+		{"player!=bob", "Rapid Open"},
+		{"player=alice and eco>=B20 and eco<=B99 and result=0-1", "Club Championship"},
+		{"result=1/2-1/2", "Rapid Open"},
+		{"date>=2024", "Club Championship"},
+		{"date<=2023.11 and date>=2023.11", "Rapid Open"},
+		{"whiteelo>=2000 or blackelo>=2000", "Club Championship,Rapid Open"},
+		{"whiteelo>=2000", "Club Championship"},
+		{"blackelo<1999.5", "Club Championship"},
+		{"timecontrol<600", "Club Championship"},
+		{"timecontrol=900+10", "Rapid Open"},
+		{"event~open", "Rapid Open"},
+		{"not (event~open)", "Club Championship"},
+		{"plies=6 and not player=dave", "Club Championship,Rapid Open"},
+		{"moves='1. e4 e5 2. Nf3'", "Rapid Open"},
+		{"moves!='1. e4 e5'", "Club Championship"},
+		{"fen='rnbqkb1r/pp1ppppp/5n2/2p5/4P3/2P5/PP1P1PPP/RNBQKBNR w KQkq - 1 3'", "Club Championship"},
+		{"eco=C50 or (player=bob and TimeControl='300+3')", "Club Championship,Rapid Open"},
+		{"termination=normal", ""},
+	}
+
+	for _, test := range tests {
+		events := matchingEvents(t, test.where)
+		if events != test.expected {
+			t.Errorf("%v: expected %v but got %v", test.where, test.expected,
+				events)
+		}
+	}
+}
+
+func TestWhereErrors(t *testing.T) {
+	for _, where := range []string{
+		"", "player", "player=", "(player=foo", "player=foo and", "eco ? B20",
+		"fen<'8/8/8/8/8/8/8/8 w - - 0 1'", "player='foo",
+	} {
+		_, err := parseWhere(where)
+		if err == nil {
+			t.Errorf("expected %v to fail to parse", where)
+		}
+	}
+}
+
+func TestFilterMatchesCombinesFilters(t *testing.T) {
+	games := loadTestGames(t)
+	fopts := FiltOpts{
+		white:     "carol",
+		normalFen: "",
+	}
+	expr, err := parseWhere("result=0-1")
+	if err != nil {
+		t.Fatalf("parseWhere failed: %v", err)
+	}
+	fopts.whereExpr = expr
+	filtCtx := NewFiltCtx(nil, fopts, ProcOpts{}, OutOpts{})
+
+	// previously --white was ignored whenever another filter was present
+	for _, g := range games {
+		if filtCtx.filterMatches(g) {
+			t.Fatalf("expected no match for %v", g.GetTagPair("Event"))
+		}
+	}
+}
+
+const endgamePgn = `[Event "rook ending"]
+[SetUp "1"]
+[FEN "8/8/4k3/8/4P3/4K3/4R3/r7 w - - 0 1"]
+[Result "*"]
+
+1. Kf3 Kf6 2. Kg3 Kg6 3. Re1 *
+
+[Event "bishop ending"]
+[SetUp "1"]
+[FEN "8/4k3/3b4/8/3P4/3B4/4K3/8 w - - 0 1"]
+[Result "*"]
+
+1. Ke3 Ke6 *
+`
+
+func loadPgnGames(t *testing.T, pgn string) []*chess.Game {
+	scanner := chess.NewScanner(strings.NewReader(pgn))
+	games := make([]*chess.Game, 0)
+	for scanner.HasNext() {
+		g, err := scanner.ParseNext()
+		if err != nil {
+			t.Fatalf("failed to parse test pgn: %v", err)
+		}
+		games = append(games, g)
+	}
+
+	return games
+}
+
+func structMatches(t *testing.T, pgn string, material string, pattern string,
+	pawns string, persist int) string {
+
+	sf, err := newStructFilter(material, pattern, pawns, persist)
+	if err != nil {
+		t.Fatalf("newStructFilter failed: %v", err)
+	}
+	events := make([]string, 0)
+	for _, g := range loadPgnGames(t, pgn) {
+		if sf.matches(g) {
+			events = append(events, g.GetTagPair("Event"))
+		}
+	}
+
+	return strings.Join(events, ",")
+}
+
+func TestStructFilter(t *testing.T) {
+	tests := []struct {
+		pgn      string
+		material string
+		pattern  string
+		pawns    string
+		persist  int
+		expected string
+	}{
+		{endgamePgn, "KRPvKR", "", "", 1, "rook ending"},
+		{endgamePgn, "krvkrp", "", "", 1, "rook ending"},
+		{endgamePgn, "KRPvKR", "", "", 6, "rook ending"},
+		{endgamePgn, "KRPvKR", "", "", 7, ""},
+		{endgamePgn, "ocb", "", "", 1, "bishop ending"},
+		{endgamePgn, "KBPvKB,ocb", "", "", 3, "bishop ending"},
+		{endgamePgn, "KBPvKB,opposite-colored-bishops", "", "", 3, "bishop ending"},
+		{endgamePgn, "KBvKB", "", "", 1, ""},
+		{testPgn, "", "????????/????????/????????/????????/????????/??P?????/PP?P?PPP/????????", "", 1, "Club Championship"},
+		{testPgn, "", "", "rnbqkbnr/pp1ppppp/8/2p5/4P3/2P5/PP1P1PPP/RNBQKBNR b KQkq - 0 2", 2, "Club Championship"},
+		{testPgn, "", "", "rnbqkbnr/pp1ppppp/8/2p5/4P3/2P5/PP1P1PPP/RNBQKBNR b KQkq - 0 2", 3, ""},
+		{testPgn, "KQRRBBNNPPPPPPPPvKQRRBBNNPPPPPPPP", "", "", 7, "Club Championship,Rapid Open"},
+	}
+
+	for _, test := range tests {
+		events := structMatches(t, test.pgn, test.material, test.pattern,
+			test.pawns, test.persist)
+		if events != test.expected {
+			t.Errorf("%+v: expected %v but got %v", test, test.expected, events)
+		}
+	}
+}
+
+func TestStructFilterErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"KRPKR", "", ""}, {"KRPvKX", "", ""}, {"RPvKR", "", ""},
+		{"KRPvKR,KRvKR", "", ""},
+		{"", "8/8/8", ""}, {"", "9/8/8/8/8/8/8/8", ""},
+		{"", "", "????????/8/8/8/8/8/8/8"},
+	} {
+		_, err := newStructFilter(args[0], args[1], args[2], 1)
+		if err == nil {
+			t.Errorf("expected %v to be rejected", args)
+		}
+	}
+}
+
+// a copy of the first game with different formatting and a comment
+const dupPgn = `[Event "Club Championship (replay)"]
+[White "alice"]
+[Black "Bob"]
+[Result "0-1"]
+[ECO "B22"]
+
+1.e4 {Alapin next} c5 2.c3 Nf6 3.e5 Nd5 0-1
+`
+
+func writeTestPgns(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	pgn1 := filepath.Join(dir, "one.pgn")
+	pgn2 := filepath.Join(dir, "two.pgn")
+	err := os.WriteFile(pgn1, []byte(testPgn), 0644)
+	if err == nil {
+		err = os.WriteFile(pgn2, []byte(dupPgn), 0644)
+	}
+	if err != nil {
+		t.Fatalf("failed to write test pgns: %v", err)
+	}
+
+	return pgn1, pgn2
+}
+
+func runFilter(t *testing.T, pgns []string, where string,
+	oopts OutOpts) string {
+
+	fopts := FiltOpts{}
+	if where != "" {
+		expr, err := parseWhere(where)
+		if err != nil {
+			t.Fatalf("parseWhere failed: %v", err)
+		}
+		fopts.whereExpr = expr
+	}
+	filtCtx := NewFiltCtx(pgns, fopts, ProcOpts{jobs: 2}, oopts)
+	var buf bytes.Buffer
+	err := filtCtx.loadAndFilter(&buf)
+	if err != nil {
+		t.Fatalf("loadAndFilter failed: %v", err)
+	}
+
+	return buf.String()
+}
+
+func TestOutputRawAndDedupe(t *testing.T) {
+	pgn1, pgn2 := writeTestPgns(t)
+
+	out := runFilter(t, []string{pgn2}, "", OutOpts{raw: true})
+	if out != dupPgn+"\n" {
+		t.Fatalf("expected the game verbatim but got:\n%v", out)
+	}
+
+	out = runFilter(t, []string{pgn1, pgn2}, "eco=B22", OutOpts{dedupe: true})
+	if strings.Count(out, "[Event ") != 1 || strings.Contains(out, "replay") {
+		t.Fatalf("expected the replayed game to be dropped:\n%v", out)
+	}
+}
+
+func TestOutputKeepsAnnotations(t *testing.T) {
+	_, pgn2 := writeTestPgns(t)
+
+	out := runFilter(t, []string{pgn2}, "", OutOpts{})
+	if !strings.Contains(out, "1. e4 { Alapin next } 1... c5 2. c3") ||
+		!strings.HasSuffix(out, "3. e5 Nd5 0-1\n\n") {
+		t.Fatalf("expected the comment to be written:\n%v", out)
+	}
+}
+
+func TestOutputCountAndSummary(t *testing.T) {
+	pgn1, pgn2 := writeTestPgns(t)
+
+	out := runFilter(t, []string{pgn1, pgn2}, "player=alice", OutOpts{count: true})
+	if out != pgn1+": 2\n"+pgn2+": 1\ntotal: 3\n" {
+		t.Fatalf("unexpected counts:\n%v", out)
+	}
+
+	out = runFilter(t, []string{pgn1, pgn2}, "player=alice",
+		OutOpts{summary: true, dedupe: true})
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[0], "Duplicates") {
+		t.Fatalf("unexpected summary:\n%v", out)
+	}
+	if strings.Join(strings.Fields(lines[3]), " ") != "total 3 2 0 1 1 1 0" {
+		t.Fatalf("unexpected summary totals %v", lines[3])
+	}
+}
+
+func TestOutputSplitBy(t *testing.T) {
+	pgn1, _ := writeTestPgns(t)
+	outDir := filepath.Join(t.TempDir(), "byeco")
+
+	out := runFilter(t, []string{pgn1}, "", OutOpts{output: outDir,
+		splitBy: "eco"})
+	if out != "" {
+		t.Fatalf("expected no output on stdout but got %v", out)
+	}
+	for eco, event := range map[string]string{"B22": "Club Championship",
+		"C50": "Rapid Open"} {
+
+		data, err := os.ReadFile(filepath.Join(outDir, eco+".pgn"))
+		if err != nil {
+			t.Fatalf("failed to read %v output: %v", eco, err)
+		}
+		if strings.Count(string(data), "[Event ") != 1 ||
+			!strings.Contains(string(data), event) {
+			t.Fatalf("unexpected %v output:\n%v", eco, string(data))
+		}
+	}
+}
+
+const studyPgn = `[Event "Sicilian study"]
+[White "?"]
+[Black "?"]
+[Result "1-0"]
+
+1. e4 c5 2. Nf3 (2. c3 Nf6 (2... d5 3. exd5) 3. e5) 2... d6 (2... Nc6 3. d4) 1-0
+`
+
+func TestGameLines(t *testing.T) {
+	games := loadPgnGames(t, studyPgn)
+	lines := gameLines(games[0])
+
+	paths := make([]string, 0)
+	for _, line := range lines {
+		paths = append(paths, line.path)
+	}
+	if strings.Join(paths, "|") != "main line|2... Nc6|2. c3|2. c3, 2... d5" {
+		t.Fatalf("unexpected paths %v", paths)
+	}
+}
+
+func TestVariationMatching(t *testing.T) {
+	dir := t.TempDir()
+	pgn := filepath.Join(dir, "study.pgn")
+	err := os.WriteFile(pgn, []byte(studyPgn), 0644)
+	if err != nil {
+		t.Fatalf("failed to write test pgn: %v", err)
+	}
+
+	// after 2. c3 Nf6
+	target := "rnbqkb1r/pp1ppppp/5n2/2p5/4P3/2P5/PP1P1PPP/RNBQKBNR w KQkq - 1 3"
+	where := "fen='" + target + "'"
+
+	out := runFilter(t, []string{pgn}, where, OutOpts{})
+	if out != "" {
+		t.Fatalf("expected no match without --includevar but got %v", out)
+	}
+
+	fopts := FiltOpts{}
+	fopts.whereExpr, _ = parseWhere(where)
+	runVar := func(oopts OutOpts) string {
+		filtCtx := NewFiltCtx([]string{pgn}, fopts,
+			ProcOpts{jobs: 1, expandVar: true}, oopts)
+		var buf bytes.Buffer
+		err := filtCtx.loadAndFilter(&buf)
+		if err != nil {
+			t.Fatalf("loadAndFilter failed: %v", err)
+		}
+		return buf.String()
+	}
+
+	out = runVar(OutOpts{})
+	if strings.Count(out, "[Event ") != 1 || !strings.Contains(out, "2... Nc6") {
+		t.Fatalf("expected the whole study but got:\n%v", out)
+	}
+
+	out = runVar(OutOpts{varPaths: true})
+	if out != pgn+"#1 Sicilian study: 2. c3\n" {
+		t.Fatalf("unexpected variation paths %v", out)
+	}
+
+	out = runVar(OutOpts{varOnly: true})
+	games := loadPgnGames(t, out)
+	if len(games) != 1 {
+		t.Fatalf("expected 1 standalone variation but got:\n%v", out)
+	}
+	g := games[0]
+	if len(g.Moves()) != 5 || g.GetTagPair("VariationPath") != "2. c3" ||
+		g.GetTagPair("Result") != "*" ||
+		g.GetTagPair("Event") != "Sicilian study" ||
+		g.GetTagPair("VariationOf") != pgn+"#1" {
+		t.Fatalf("unexpected standalone variation:\n%v", out)
+	}
+}
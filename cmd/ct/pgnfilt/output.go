@@ -0,0 +1,285 @@
+package pgnfilt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/corentings/chess/v2"
+	"github.com/mikeb26/chesstools"
+)
+
+// OutOpts controls where and how matching games are written
+type OutOpts struct {
+	output   string
+	splitBy  string
+	count    bool
+	summary  bool
+	raw      bool
+	dedupe   bool
+	varPaths bool
+	varOnly  bool
+}
+
+// keep at most this many --splitby files open at once
+const maxOpenSplitFiles = 128
+
+type splitFile struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+type fileSummary struct {
+	pgnFilename string
+	games       int
+	matches     int
+	whiteWins   int
+	blackWins   int
+	draws       int
+	duplicates  int
+	skipped     int64
+}
+
+// filtOutput receives every game from the pipeline, in order, and routes
+// matches. it is only ever invoked from the pipeline's emitting goroutine.
+type filtOutput struct {
+	opts OutOpts
+
+	outFile    *os.File
+	out        *bufio.Writer
+	splitFiles map[string]*splitFile
+	created    map[string]bool
+
+	seen       map[string]bool
+	summaries  []*fileSummary
+	curSummary *fileSummary
+}
+
+func newFiltOutput(opts OutOpts, stdout io.Writer) (*filtOutput, error) {
+	fo := &filtOutput{
+		opts:       opts,
+		splitFiles: make(map[string]*splitFile),
+		created:    make(map[string]bool),
+		seen:       make(map[string]bool),
+		summaries:  make([]*fileSummary, 0),
+	}
+
+	if opts.splitBy != "" {
+		if opts.output != "" {
+			err := os.MkdirAll(opts.output, 0755)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to create %v: %w", opts.output, err)
+			}
+		}
+	} else if opts.output != "" {
+		f, err := os.Create(opts.output)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create %v: %w", opts.output, err)
+		}
+		fo.outFile = f
+		fo.out = bufio.NewWriter(f)
+	}
+	if fo.out == nil {
+		fo.out = bufio.NewWriter(stdout)
+	}
+
+	return fo, nil
+}
+
+func (fo *filtOutput) startPgn(pgnFilename string) {
+	fo.curSummary = &fileSummary{pgnFilename: pgnFilename}
+	fo.summaries = append(fo.summaries, fo.curSummary)
+}
+
+func (fo *filtOutput) finishPgn(skipped int64) {
+	fo.curSummary.skipped = skipped
+}
+
+// gameKey identifies duplicate games: same players and same moves
+func gameKey(g *chess.Game) string {
+	var sb strings.Builder
+	sb.WriteString(strings.ToLower(g.GetTagPair("White")))
+	sb.WriteString("|")
+	sb.WriteString(strings.ToLower(g.GetTagPair("Black")))
+	sb.WriteString("|")
+	sb.WriteString(g.GetTagPair("FEN"))
+	for _, m := range g.Moves() {
+		sb.WriteString(" ")
+		sb.WriteString(m.String())
+	}
+
+	return sb.String()
+}
+
+func (fo *filtOutput) emit(output string, g *chess.Game,
+	info chesstools.PgnGameInfo) error {
+
+	fo.curSummary.games++
+	if output == "" {
+		return nil
+	}
+
+	if fo.opts.dedupe {
+		key := gameKey(g)
+		if fo.seen[key] {
+			fo.curSummary.duplicates++
+			return nil
+		}
+		fo.seen[key] = true
+	}
+
+	fo.curSummary.matches++
+	switch g.GetTagPair("Result") {
+	case "1-0":
+		fo.curSummary.whiteWins++
+	case "0-1":
+		fo.curSummary.blackWins++
+	case "1/2-1/2":
+		fo.curSummary.draws++
+	}
+	if fo.opts.count || fo.opts.summary {
+		return nil
+	}
+
+	w, err := fo.writerFor(g)
+	if err != nil {
+		return err
+	}
+	_, err = w.WriteString(output)
+
+	return err
+}
+
+func splitFilename(value string) string {
+	if value == "" || value == "?" {
+		return "unknown"
+	}
+
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, value)
+}
+
+func (fo *filtOutput) writerFor(g *chess.Game) (*bufio.Writer, error) {
+	if fo.opts.splitBy == "" {
+		return fo.out, nil
+	}
+
+	filename := filepath.Join(fo.opts.output,
+		splitFilename(tagValue(g, strings.ToLower(fo.opts.splitBy)))+".pgn")
+	sf, ok := fo.splitFiles[filename]
+	if ok {
+		return sf.w, nil
+	}
+
+	if len(fo.splitFiles) >= maxOpenSplitFiles {
+		err := fo.closeSplitFiles()
+		if err != nil {
+			return nil, err
+		}
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !fo.created[filename] {
+		flags |= os.O_TRUNC
+		fo.created[filename] = true
+	}
+	f, err := os.OpenFile(filename, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open %v: %w", filename, err)
+	}
+	sf = &splitFile{f: f, w: bufio.NewWriter(f)}
+	fo.splitFiles[filename] = sf
+
+	return sf.w, nil
+}
+
+func (fo *filtOutput) closeSplitFiles() error {
+	var firstErr error
+	for filename, sf := range fo.splitFiles {
+		err := sf.w.Flush()
+		if err == nil {
+			err = sf.f.Close()
+		} else {
+			sf.f.Close()
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("Failed to write %v: %w", filename, err)
+		}
+		delete(fo.splitFiles, filename)
+	}
+
+	return firstErr
+}
+
+// Close flushes matches and writes any counts or summary
+func (fo *filtOutput) Close() error {
+	if fo.opts.count {
+		fo.emitCounts()
+	} else if fo.opts.summary {
+		fo.emitSummary()
+	}
+
+	err := fo.closeSplitFiles()
+	flushErr := fo.out.Flush()
+	if err == nil {
+		err = flushErr
+	}
+	if fo.outFile != nil {
+		closeErr := fo.outFile.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+func (fo *filtOutput) emitCounts() {
+	total := 0
+	for _, s := range fo.summaries {
+		if len(fo.summaries) > 1 {
+			fmt.Fprintf(fo.out, "%v: %v\n", s.pgnFilename, s.matches)
+		}
+		total += s.matches
+	}
+	if len(fo.summaries) > 1 {
+		fmt.Fprintf(fo.out, "total: %v\n", total)
+	} else {
+		fmt.Fprintf(fo.out, "%v\n", total)
+	}
+}
+
+func (fo *filtOutput) emitSummary() {
+	tw := tabwriter.NewWriter(fo.out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "PGN\tGames\tMatches\tWhite wins\tDraws\tBlack wins\tDuplicates\tSkipped\t\n")
+
+	total := fileSummary{pgnFilename: "total"}
+	for _, s := range fo.summaries {
+		fo.emitSummaryRow(tw, s)
+		total.games += s.games
+		total.matches += s.matches
+		total.whiteWins += s.whiteWins
+		total.blackWins += s.blackWins
+		total.draws += s.draws
+		total.duplicates += s.duplicates
+		total.skipped += s.skipped
+	}
+	if len(fo.summaries) > 1 {
+		fo.emitSummaryRow(tw, &total)
+	}
+	tw.Flush()
+}
+
+func (fo *filtOutput) emitSummaryRow(w io.Writer, s *fileSummary) {
+	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t\n", s.pgnFilename,
+		s.games, s.matches, s.whiteWins, s.draws, s.blackWins, s.duplicates,
+		s.skipped)
+}
@@ -0,0 +1,302 @@
+package pgnfilt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/corentings/chess/v2"
+)
+
+/*
+ * structural filters match positions similar to, rather than identical to,
+ * a target:
+ *
+ *   --material KRPvKR       material signature; white's pieces before the v,
+ *                           black's after, matching either color
+ *   --material KBPPvKB,ocb  comma separated conditions must all hold; ocb
+ *                           requires each side to have a single bishop with
+ *                           the bishops on opposite colored squares
+ *   --pattern <board>       FEN board field where ? matches any square;
+ *                           every rank still needs 8 squares, e.g. white
+ *                           pawns on a2,b2,c2 and an empty 8th rank:
+ *                           8/????????/????????/????????/????????/????????/PPP?????/????????
+ *   --pawns <fen>           pawn placement must be exactly that of <fen>
+ *   --persist N             the above must all hold for at least N
+ *                           consecutive positions (plies)
+ */
+
+const (
+	emptySquare    = '.'
+	wildcardSquare = '?'
+)
+
+// expandedBoard holds one byte per square in FEN order (a8, b8 ... h1)
+type expandedBoard [64]byte
+
+func expandBoard(boardField string, allowWildcard bool) (expandedBoard, error) {
+	var eb expandedBoard
+
+	ranks := strings.Split(boardField, "/")
+	if len(ranks) != 8 {
+		return eb, fmt.Errorf("expected 8 ranks in %v", boardField)
+	}
+	for rankIdx, rank := range ranks {
+		fileIdx := 0
+		for _, ch := range rank {
+			switch {
+			case ch >= '1' && ch <= '8':
+				for ii := 0; ii < int(ch-'0'); ii++ {
+					if fileIdx < 8 {
+						eb[rankIdx*8+fileIdx] = emptySquare
+					}
+					fileIdx++
+				}
+				continue
+			case ch == wildcardSquare && allowWildcard:
+			case strings.ContainsRune("pnbrqkPNBRQK", ch):
+			default:
+				return eb, fmt.Errorf("unexpected %q in %v", ch, boardField)
+			}
+			if fileIdx < 8 {
+				eb[rankIdx*8+fileIdx] = byte(ch)
+			}
+			fileIdx++
+		}
+		if fileIdx != 8 {
+			return eb, fmt.Errorf("rank %v of %v does not have 8 squares",
+				8-rankIdx, boardField)
+		}
+	}
+
+	return eb, nil
+}
+
+func expandPosition(pos *chess.Position) expandedBoard {
+	eb, _ := expandBoard(pos.Board().String(), false)
+
+	return eb
+}
+
+func isLightSquare(idx int) bool {
+	return (idx/8+idx%8)%2 == 0
+}
+
+type materialFilter struct {
+	// sorted piece letters, e.g. KPR & KR for KRPvKR
+	white string
+	black string
+	ocb   bool
+}
+
+func sortedPieces(pieces string) string {
+	b := []byte(strings.ToUpper(pieces))
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+
+	return string(b)
+}
+
+func parseMaterial(material string) (*materialFilter, error) {
+	mf := &materialFilter{}
+
+	for _, cond := range strings.Split(material, ",") {
+		cond = strings.TrimSpace(cond)
+		switch strings.ToLower(cond) {
+		case "ocb", "opposite-colored-bishops", "opposite-coloured-bishops":
+			mf.ocb = true
+			continue
+		}
+		sides := strings.Split(strings.ToUpper(cond), "V")
+		if len(sides) != 2 {
+			return nil, fmt.Errorf("expected a signature such as KRPvKR or ocb (opposite-colored-bishops) but got %v",
+				cond)
+		}
+		for _, side := range sides {
+			if strings.Count(side, "K") != 1 ||
+				strings.Trim(side, "KQRBNP") != "" {
+				return nil, fmt.Errorf("invalid material signature %v", cond)
+			}
+		}
+		if mf.white != "" {
+			return nil, fmt.Errorf("expected one material signature but got %v",
+				material)
+		}
+		mf.white = sortedPieces(sides[0])
+		mf.black = sortedPieces(sides[1])
+	}
+
+	return mf, nil
+}
+
+func (mf *materialFilter) matches(eb *expandedBoard) bool {
+	var white, black []byte
+	lightBishops := [2]int{}
+	darkBishops := [2]int{}
+
+	for idx, ch := range eb {
+		if ch == emptySquare {
+			continue
+		}
+		side := 0
+		if ch >= 'a' && ch <= 'z' {
+			side = 1
+			black = append(black, ch-'a'+'A')
+		} else {
+			white = append(white, ch)
+		}
+		if ch == 'B' || ch == 'b' {
+			if isLightSquare(idx) {
+				lightBishops[side]++
+			} else {
+				darkBishops[side]++
+			}
+		}
+	}
+
+	if mf.white != "" {
+		w := sortedPieces(string(white))
+		b := sortedPieces(string(black))
+		if !(w == mf.white && b == mf.black) && !(w == mf.black && b == mf.white) {
+			return false
+		}
+	}
+	if mf.ocb {
+		if lightBishops[0]+darkBishops[0] != 1 || lightBishops[1]+darkBishops[1] != 1 {
+			return false
+		}
+		if lightBishops[0] == lightBishops[1] {
+			return false
+		}
+	}
+
+	return true
+}
+
+type patternFilter struct {
+	pattern expandedBoard
+}
+
+func parsePattern(pattern string) (*patternFilter, error) {
+	// accept a full FEN as well as just its board field
+	eb, err := expandBoard(strings.Fields(pattern)[0], true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &patternFilter{pattern: eb}, nil
+}
+
+func (pf *patternFilter) matches(eb *expandedBoard) bool {
+	for idx, ch := range pf.pattern {
+		if ch != wildcardSquare && ch != eb[idx] {
+			return false
+		}
+	}
+
+	return true
+}
+
+type pawnsFilter struct {
+	pawns expandedBoard
+}
+
+func parsePawns(fen string) (*pawnsFilter, error) {
+	eb, err := expandBoard(strings.Fields(fen)[0], false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pawnsFilter{pawns: pawnsOnly(&eb)}, nil
+}
+
+func pawnsOnly(eb *expandedBoard) expandedBoard {
+	var pawns expandedBoard
+	for idx, ch := range eb {
+		if ch == 'P' || ch == 'p' {
+			pawns[idx] = ch
+		} else {
+			pawns[idx] = emptySquare
+		}
+	}
+
+	return pawns
+}
+
+func (pf *pawnsFilter) matches(eb *expandedBoard) bool {
+	return pawnsOnly(eb) == pf.pawns
+}
+
+// structFilter requires every configured structural filter to hold for at
+// least persist consecutive plies
+type structFilter struct {
+	material *materialFilter
+	pattern  *patternFilter
+	pawns    *pawnsFilter
+	persist  int
+}
+
+func newStructFilter(material string, pattern string, pawns string,
+	persist int) (*structFilter, error) {
+
+	if material == "" && pattern == "" && pawns == "" {
+		return nil, nil
+	}
+	if persist < 1 {
+		return nil, fmt.Errorf("--persist must be >= 1")
+	}
+
+	sf := &structFilter{persist: persist}
+	var err error
+	if material != "" {
+		sf.material, err = parseMaterial(material)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --material: %w", err)
+		}
+	}
+	if strings.TrimSpace(pattern) != "" {
+		sf.pattern, err = parsePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --pattern: %w", err)
+		}
+	}
+	if strings.TrimSpace(pawns) != "" {
+		sf.pawns, err = parsePawns(pawns)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --pawns: %w", err)
+		}
+	}
+
+	return sf, nil
+}
+
+func (sf *structFilter) positionMatches(pos *chess.Position) bool {
+	eb := expandPosition(pos)
+
+	if sf.material != nil && !sf.material.matches(&eb) {
+		return false
+	}
+	if sf.pattern != nil && !sf.pattern.matches(&eb) {
+		return false
+	}
+	if sf.pawns != nil && !sf.pawns.matches(&eb) {
+		return false
+	}
+
+	return true
+}
+
+func (sf *structFilter) matches(g *chess.Game) bool {
+	run := 0
+	for _, pos := range g.Positions() {
+		if !sf.positionMatches(pos) {
+			run = 0
+			continue
+		}
+		run++
+		if run >= sf.persist {
+			return true
+		}
+	}
+
+	return false
+}
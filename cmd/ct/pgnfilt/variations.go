@@ -0,0 +1,86 @@
+package pgnfilt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/corentings/chess/v2"
+)
+
+const MainLinePath = "main line"
+
+// gameLine is one line of play through a game's variation tree along with
+// where it departs from the main line
+type gameLine struct {
+	g    *chess.Game
+	path string
+}
+
+// gameLines returns every line in g as a standalone game in the same order
+// as chess.Game.Split(). the path of each line lists the moves at which it
+// takes an alternative to the main line, e.g. "1... Nf6, 3. Nc3".
+func gameLines(g *chess.Game) []gameLine {
+	games := g.Split()
+	branches := make([][]string, 0, len(games))
+	for ii, m := range g.GetRootMove().Children() {
+		branches = append(branches, collectBranches(m, ii > 0, []string{})...)
+	}
+
+	lines := make([]gameLine, len(games))
+	for ii, lineGame := range games {
+		path := MainLinePath
+		if ii < len(branches) && len(branches[ii]) > 0 {
+			path = strings.Join(branches[ii], ", ")
+		}
+		lines[ii] = gameLine{g: lineGame, path: path}
+	}
+
+	return lines
+}
+
+func collectBranches(m *chess.Move, isAlternative bool,
+	branches []string) [][]string {
+
+	if isAlternative {
+		branches = append(branches[:len(branches):len(branches)],
+			moveLabel(m))
+	}
+	if len(m.Children()) == 0 {
+		return [][]string{branches}
+	}
+
+	ret := make([][]string, 0)
+	for ii, c := range m.Children() {
+		ret = append(ret, collectBranches(c, ii > 0, branches)...)
+	}
+
+	return ret
+}
+
+// e.g. "3. Nc3" or "1... Nf6"
+func moveLabel(m *chess.Move) string {
+	parentPos := m.Parent().Position()
+	san := chess.AlgebraicNotation{}.Encode(parentPos, m)
+	fenFields := strings.Fields(parentPos.XFENString())
+	moveNum := fenFields[len(fenFields)-1]
+
+	if parentPos.Turn() == chess.White {
+		return fmt.Sprintf("%v. %v", moveNum, san)
+	}
+
+	return fmt.Sprintf("%v... %v", moveNum, san)
+}
+
+// standaloneLine prepares a line for output on its own: a variation didn't
+// produce the game's result and records where it came from
+func standaloneLine(line gameLine, pgnName string, gameNum int) *chess.Game {
+	if line.path == MainLinePath {
+		return line.g
+	}
+
+	line.g.AddTagPair("Result", "*")
+	line.g.AddTagPair("VariationPath", line.path)
+	line.g.AddTagPair("VariationOf", fmt.Sprintf("%v#%v", pgnName, gameNum))
+
+	return line.g
+}
@@ -0,0 +1,466 @@
+package pgnfilt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/corentings/chess/v2"
+	"github.com/mikeb26/chesstools"
+)
+
+/*
+ * --where expressions look like:
+ *
+ *   player=foo and eco>=B20 and eco<=B99 and (result=0-1 or result=1/2-1/2)
+ *
+ * each comparison is <field> <op> <value> where op is one of
+ * = != < <= > >= ~ (~ is a case insensitive substring match). values
+ * containing spaces or parentheses must be quoted with ' or ". comparisons
+ * may be combined with and, or, not and parentheses.
+ *
+ * fields:
+ *   player       either White or Black
+ *   date         compares only as many characters as the value has, so
+ *                date>=2024.03 and date=2024 work as expected
+ *   plies        number of half moves in the game
+ *   fen          position reached at any point (=/!= only)
+ *   moves        game begins with this move sequence (=/!= only)
+ *   timecontrol  string compare for =/!=/~; base seconds for < <= > >=
+ *   <tag>        any other PGN tag, e.g. white, blackelo, eco, result;
+ *                compared numerically when both sides are numbers
+ */
+
+type whereNode interface {
+	eval(gv *gameView) bool
+}
+
+type andNode struct {
+	left, right whereNode
+}
+
+func (n *andNode) eval(gv *gameView) bool {
+	return n.left.eval(gv) && n.right.eval(gv)
+}
+
+type orNode struct {
+	left, right whereNode
+}
+
+func (n *orNode) eval(gv *gameView) bool {
+	return n.left.eval(gv) || n.right.eval(gv)
+}
+
+type notNode struct {
+	operand whereNode
+}
+
+func (n *notNode) eval(gv *gameView) bool {
+	return !n.operand.eval(gv)
+}
+
+type cmpNode struct {
+	field string
+	op    string
+	value string
+	// precomputed for fen & moves
+	normalFen string
+	moves     []string
+}
+
+// gameView caches per game values which are expensive to compute and may
+// be referenced by more than one comparison
+type gameView struct {
+	g          *chess.Game
+	normalFens map[string]bool
+	uciMoves   []string
+}
+
+func newGameView(g *chess.Game) *gameView {
+	return &gameView{g: g}
+}
+
+func (gv *gameView) reachedFen(normalFen string) bool {
+	if gv.normalFens == nil {
+		gv.normalFens = make(map[string]bool)
+		for _, p := range gv.g.Positions() {
+			fen, err := chesstools.NormalizeFEN(p.XFENString())
+			if err == nil {
+				gv.normalFens[fen] = true
+			}
+		}
+	}
+
+	return gv.normalFens[normalFen]
+}
+
+func (gv *gameView) moves() []string {
+	if gv.uciMoves == nil {
+		gv.uciMoves = make([]string, 0)
+		for _, m := range gv.g.Moves() {
+			gv.uciMoves = append(gv.uciMoves, m.String())
+		}
+	}
+
+	return gv.uciMoves
+}
+
+var canonicalTags = map[string]string{
+	"event":       "Event",
+	"site":        "Site",
+	"date":        "Date",
+	"round":       "Round",
+	"white":       "White",
+	"black":       "Black",
+	"result":      "Result",
+	"whiteelo":    "WhiteElo",
+	"blackelo":    "BlackElo",
+	"eco":         "ECO",
+	"opening":     "Opening",
+	"variation":   "Variation",
+	"timecontrol": "TimeControl",
+	"termination": "Termination",
+	"variant":     "Variant",
+	"whitetitle":  "WhiteTitle",
+	"blacktitle":  "BlackTitle",
+	"utcdate":     "UTCDate",
+}
+
+func tagValue(g *chess.Game, field string) string {
+	if tag, ok := canonicalTags[field]; ok {
+		return g.GetTagPair(tag)
+	}
+	// unknown tags are tried as given and then capitalized
+	v := g.GetTagPair(field)
+	if v == "" && field != "" {
+		v = g.GetTagPair(strings.ToUpper(field[:1]) + field[1:])
+	}
+
+	return v
+}
+
+func (n *cmpNode) eval(gv *gameView) bool {
+	switch n.field {
+	case "player":
+		// player!=x means x played neither side, not that 1 side isn't x
+		if n.op == "!=" {
+			positive := &cmpNode{field: n.field, op: "=", value: n.value}
+			return !positive.eval(gv)
+		}
+		return n.compare(gv.g.GetTagPair("White")) ||
+			n.compare(gv.g.GetTagPair("Black"))
+	case "plies", "ply":
+		return n.compare(strconv.Itoa(len(gv.g.Moves())))
+	case "fen":
+		return gv.reachedFen(n.normalFen) == (n.op == "=")
+	case "moves":
+		return hasPrefix(gv.moves(), n.moves) == (n.op == "=")
+	case "date":
+		date := strings.ReplaceAll(tagValue(gv.g, "date"), "-", ".")
+		if date == "" {
+			return false
+		}
+		if len(date) > len(n.value) {
+			date = date[:len(n.value)]
+		}
+		return compareStrings(date, n.op, n.value)
+	case "timecontrol":
+		tc := tagValue(gv.g, "timecontrol")
+		if n.op == "=" || n.op == "!=" || n.op == "~" {
+			return n.compare(tc)
+		}
+		base, ok := timeControlBase(tc)
+		if !ok {
+			return false
+		}
+		return n.compare(strconv.Itoa(base))
+	}
+
+	return n.compare(tagValue(gv.g, n.field))
+}
+
+func (n *cmpNode) compare(actual string) bool {
+	if actual == "" && n.op != "!=" {
+		return false
+	}
+
+	actualNum, err1 := strconv.ParseFloat(actual, 64)
+	valueNum, err2 := strconv.ParseFloat(n.value, 64)
+	if err1 == nil && err2 == nil && n.op != "~" {
+		return compareNumbers(actualNum, n.op, valueNum)
+	}
+
+	return compareStrings(strings.ToLower(actual), n.op, strings.ToLower(n.value))
+}
+
+func compareNumbers(a float64, op string, b float64) bool {
+	switch op {
+	case "=":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+
+	return false
+}
+
+func compareStrings(a string, op string, b string) bool {
+	switch op {
+	case "=":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "~":
+		return strings.Contains(a, b)
+	}
+
+	return false
+}
+
+// e.g. 300+3 -> 300, 40/7200:3600 -> 7200
+func timeControlBase(tc string) (int, bool) {
+	tc = strings.Split(tc, ":")[0]
+	if idx := strings.Index(tc, "/"); idx != -1 {
+		tc = tc[idx+1:]
+	}
+	tc = strings.Split(tc, "+")[0]
+	base, err := strconv.Atoi(tc)
+
+	return base, err == nil
+}
+
+func hasPrefix(moves []string, prefix []string) bool {
+	if len(prefix) > len(moves) {
+		return false
+	}
+	for ii := range prefix {
+		if moves[ii] != prefix[ii] {
+			return false
+		}
+	}
+
+	return true
+}
+
+type whereToken struct {
+	text   string
+	quoted bool
+}
+
+func tokenizeWhere(expr string) ([]whereToken, error) {
+	tokens := make([]whereToken, 0)
+	runes := []rune(expr)
+
+	for ii := 0; ii < len(runes); {
+		ch := runes[ii]
+		switch {
+		case unicode.IsSpace(ch):
+			ii++
+		case ch == '(' || ch == ')':
+			tokens = append(tokens, whereToken{text: string(ch)})
+			ii++
+		case ch == '\'' || ch == '"':
+			end := ii + 1
+			for end < len(runes) && runes[end] != ch {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated quote in %v", expr)
+			}
+			tokens = append(tokens, whereToken{text: string(runes[ii+1 : end]),
+				quoted: true})
+			ii = end + 1
+		case strings.ContainsRune("=!<>~", ch):
+			end := ii + 1
+			if end < len(runes) && runes[end] == '=' {
+				end++
+			}
+			tokens = append(tokens, whereToken{text: string(runes[ii:end])})
+			ii = end
+		default:
+			end := ii
+			for end < len(runes) && !unicode.IsSpace(runes[end]) &&
+				!strings.ContainsRune("()=!<>~'\"", runes[end]) {
+				end++
+			}
+			tokens = append(tokens, whereToken{text: string(runes[ii:end])})
+			ii = end
+		}
+	}
+
+	return tokens, nil
+}
+
+type whereParser struct {
+	tokens []whereToken
+	pos    int
+}
+
+// parseWhere compiles a --where expression
+func parseWhere(expr string) (whereNode, error) {
+	tokens, err := tokenizeWhere(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty --where expression")
+	}
+
+	p := &whereParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %v in --where expression",
+			p.tokens[p.pos].text)
+	}
+
+	return node, nil
+}
+
+func (p *whereParser) peekKeyword(keyword string) bool {
+	return p.pos < len(p.tokens) && !p.tokens[p.pos].quoted &&
+		strings.ToLower(p.tokens[p.pos].text) == keyword
+}
+
+func (p *whereParser) next() (whereToken, error) {
+	if p.pos >= len(p.tokens) {
+		return whereToken{}, fmt.Errorf("unexpected end of --where expression")
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+
+	return tok, nil
+}
+
+func (p *whereParser) parseOr() (whereNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *whereParser) parseAnd() (whereNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("and") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *whereParser) parseUnary() (whereNode, error) {
+	if p.peekKeyword("not") {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	if p.peekKeyword("(") {
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peekKeyword(")") {
+			return nil, fmt.Errorf("missing ) in --where expression")
+		}
+		p.pos++
+		return node, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *whereParser) parseComparison() (whereNode, error) {
+	field, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	value, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch op.text {
+	case "=", "!=", "<", "<=", ">", ">=", "~":
+	default:
+		return nil, fmt.Errorf("expected a comparison after %v but got %v",
+			field.text, op.text)
+	}
+
+	return newCmpNode(strings.ToLower(field.text), op.text, value.text)
+}
+
+func newCmpNode(field string, op string, value string) (*cmpNode, error) {
+	n := &cmpNode{field: field, op: op, value: value}
+
+	switch field {
+	case "fen":
+		if op != "=" && op != "!=" {
+			return nil, fmt.Errorf("fen only supports = and !=")
+		}
+		fen, err := chesstools.NormalizeFEN(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fen %v: %w", value, err)
+		}
+		n.normalFen = fen
+	case "moves":
+		if op != "=" && op != "!=" {
+			return nil, fmt.Errorf("moves only supports = and !=")
+		}
+		pgnReader, err := chess.PGN(strings.NewReader(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid moves %v: %w", value, err)
+		}
+		n.moves = make([]string, 0)
+		for _, m := range chess.NewGame(pgnReader).Moves() {
+			n.moves = append(n.moves, m.String())
+		}
+	case "date":
+		n.value = strings.ReplaceAll(value, "-", ".")
+	}
+
+	return n, nil
+}
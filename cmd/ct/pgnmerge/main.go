@@ -0,0 +1,401 @@
+/* Utility for merging PGN files, e.g. two opening repertoires, into a single
+ * move tree. Every line of every game, including its variations, is added to
+ * the tree; lines sharing a move prefix share the same branch and a line
+ * which transposes into a position already in the tree continues from that
+ * position rather than duplicating it. Moves from earlier files take
+ * precedence as the main line. When --color is given, positions where the
+ * repertoire side is given more than one move are reported as conflicts in
+ * the same form as repvld.
+ */
+
+package pgnmerge
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/corentings/chess/v2"
+	"github.com/mikeb26/chesstools"
+)
+
+type MergeOpts struct {
+	output   string
+	color    chess.Color
+	byEco    bool
+	strict   bool
+	pgnFiles []string
+}
+
+// mergeTree is one output game; there is one per distinct start position,
+// or per start position and ECO code with --eco
+type mergeTree struct {
+	g   *chess.Game
+	eco string
+	// indexed by normalized FEN
+	positions map[string]*chess.Move
+	sources   map[*chess.Move]chesstools.MoveSource
+	// transposing moves and the node each line through them continues from
+	transpositions map[*chess.Move]*chess.Move
+}
+
+type Merger struct {
+	opts *MergeOpts
+
+	trees   []*mergeTree
+	treeMap map[string]*mergeTree
+
+	gameCount          uint
+	lineCount          uint
+	uniquePosCount     uint
+	dupPosCount        uint
+	transpositionCount uint
+	conflictList       []chesstools.MoveConflict
+}
+
+func NewMerger(optsIn *MergeOpts) *Merger {
+	return &Merger{
+		opts:         optsIn,
+		trees:        make([]*mergeTree, 0),
+		treeMap:      make(map[string]*mergeTree),
+		conflictList: make([]chesstools.MoveConflict, 0),
+	}
+}
+
+func parseArgs(args []string, opts *MergeOpts) error {
+	f := flag.NewFlagSet("pgnmerge", flag.ExitOnError)
+	var colorFlag string
+
+	f.StringVar(&opts.output, "o", "", "<output PGN file> (default stdout)")
+	f.StringVar(&opts.output, "output", "", "<output PGN file> (default stdout)")
+	f.StringVar(&colorFlag, "color", "",
+		"<white|black> report conflicting moves for this repertoire color")
+	f.BoolVar(&opts.byEco, "eco", false,
+		"write one merged game per ECO code instead of a single tree")
+	f.BoolVar(&opts.strict, "strict", false,
+		"abort on the first malformed game instead of skipping it")
+
+	// allow flags after the PGN files, e.g. pgnmerge a.pgn b.pgn -o out.pgn
+	opts.pgnFiles = make([]string, 0)
+	for {
+		err := f.Parse(args)
+		if err != nil {
+			return err
+		}
+		args = f.Args()
+		if len(args) == 0 {
+			break
+		}
+		opts.pgnFiles = append(opts.pgnFiles, args[0])
+		args = args[1:]
+	}
+
+	switch strings.ToUpper(colorFlag) {
+	case "":
+		opts.color = chess.NoColor
+	case "WHITE", "W":
+		opts.color = chess.White
+	case "BLACK", "B":
+		opts.color = chess.Black
+	default:
+		return fmt.Errorf("unknown --color %v; please choose white or black",
+			colorFlag)
+	}
+	if len(opts.pgnFiles) == 0 {
+		return fmt.Errorf("please specify 1 or more PGN files to merge")
+	}
+
+	return nil
+}
+
+func Main(args []string) {
+	var opts MergeOpts
+	err := parseArgs(args, &opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse arguments: %v\n", err)
+		os.Exit(1)
+	}
+
+	merger := NewMerger(&opts)
+	err = merger.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	err = merger.writeOutput()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	merger.printStatsAndConflicts(os.Stderr)
+}
+
+func (merger *Merger) Load() error {
+	for _, pgnFilename := range merger.opts.pgnFiles {
+		f, err := chesstools.OpenPgn(pgnFilename)
+		if err != nil {
+			return err
+		}
+		err = merger.processOnePGN(f, pgnFilename)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (merger *Merger) processOnePGN(f io.Reader, pgnFilename string) error {
+	scanner := chesstools.NewPgnStream(f, pgnFilename).WithStrict(merger.opts.strict)
+
+	for scanner.HasNext() {
+		g, err := scanner.ParseNext()
+		if err != nil {
+			return err
+		}
+		if len(g.Moves()) == 0 {
+			continue
+		}
+		merger.gameCount++
+
+		src := chesstools.MoveSource{Game: g, GameNum: scanner.GameNum(),
+			PgnFilename: pgnFilename}
+		for _, line := range g.Split() {
+			err = merger.mergeLine(line, src)
+			if err != nil {
+				return fmt.Errorf("%v#%v: %w", pgnFilename, src.GameNum, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (merger *Merger) treeFor(line *chess.Game) (*mergeTree, error) {
+	startPos := line.GetRootMove().Position()
+	startFen, err := chesstools.NormalizeFEN(startPos.XFENString())
+	if err != nil {
+		return nil, err
+	}
+	eco := ""
+	if merger.opts.byEco {
+		eco, _, _ = chesstools.ClassifyGame(line)
+	}
+
+	key := startFen + "|" + eco
+	tree, ok := merger.treeMap[key]
+	if ok {
+		return tree, nil
+	}
+
+	fenOpt, err := chess.FEN(startPos.XFENString())
+	if err != nil {
+		return nil, err
+	}
+	tree = &mergeTree{
+		g:         chess.NewGame(fenOpt),
+		eco:       eco,
+		positions: make(map[string]*chess.Move),
+		sources:   make(map[*chess.Move]chesstools.MoveSource),
+
+		transpositions: make(map[*chess.Move]*chess.Move),
+	}
+	tree.positions[startFen] = tree.g.GetRootMove()
+	merger.trees = append(merger.trees, tree)
+	merger.treeMap[key] = tree
+
+	return tree, nil
+}
+
+func (merger *Merger) mergeLine(line *chess.Game,
+	src chesstools.MoveSource) error {
+
+	tree, err := merger.treeFor(line)
+	if err != nil {
+		return err
+	}
+	merger.lineCount++
+
+	cur := tree.g.GetRootMove()
+	for _, mv := range line.Moves() {
+		cur, err = merger.mergeMove(tree, cur, mv, src)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeMove adds mv as a child of cur unless cur already has it and returns
+// the node from which the line continues
+func (merger *Merger) mergeMove(tree *mergeTree, cur *chess.Move,
+	mv *chess.Move, src chesstools.MoveSource) (*chess.Move, error) {
+
+	for _, child := range cur.Children() {
+		if child.String() == mv.String() {
+			merger.dupPosCount++
+			target, ok := tree.transpositions[child]
+			if ok {
+				return target, nil
+			}
+			return child, nil
+		}
+	}
+
+	fen, err := chesstools.NormalizeFEN(mv.Position().XFENString())
+	if err != nil {
+		return nil, err
+	}
+	pos := cur.Position()
+	encoder := chess.AlgebraicNotation{}
+	src.Move = encoder.Encode(pos, mv)
+
+	if len(cur.Children()) > 0 && pos.Turn() == merger.opts.color {
+		existing := cur.Children()[0]
+		existingSrc := tree.sources[existing]
+		existingSrc.Move = encoder.Encode(pos, existing)
+		merger.conflictList = append(merger.conflictList,
+			chesstools.MoveConflict{Existing: existingSrc, Conflicting: src})
+	}
+
+	child := mv.Clone()
+	tree.g.AddVariation(cur, child)
+	tree.sources[child] = src
+
+	// a transposition continues from wherever the tree first reached the
+	// position so that its continuations are only listed once
+	target, ok := tree.positions[fen]
+	if ok {
+		merger.transpositionCount++
+		tree.transpositions[child] = target
+		return target, nil
+	}
+	tree.positions[fen] = child
+	merger.uniquePosCount++
+
+	return child, nil
+}
+
+func (merger *Merger) sortedTrees() []*mergeTree {
+	trees := append([]*mergeTree{}, merger.trees...)
+	if merger.opts.byEco {
+		// unclassified lines last
+		sort.SliceStable(trees, func(i, j int) bool {
+			if trees[i].eco == "" || trees[j].eco == "" {
+				return trees[j].eco == "" && trees[i].eco != ""
+			}
+			return trees[i].eco < trees[j].eco
+		})
+	}
+
+	return trees
+}
+
+func (merger *Merger) treeTags(tree *mergeTree) []chesstools.PgnTag {
+	event := "Merged repertoire"
+	if merger.opts.byEco {
+		if tree.eco == "" {
+			event = "Unclassified"
+		} else {
+			event = tree.eco
+			openings := chesstools.GetOpeningsByEco(tree.eco)
+			if len(openings) > 0 {
+				event += " " + openings[0].Name()
+			}
+		}
+	}
+	tags := []chesstools.PgnTag{
+		{Key: "Event", Value: event},
+		{Key: "Site", Value: "?"},
+		{Key: "Date", Value: "????.??.??"},
+		{Key: "Round", Value: "-"},
+		{Key: "White", Value: "?"},
+		{Key: "Black", Value: "?"},
+		{Key: "Result", Value: "*"},
+	}
+	if tree.eco != "" {
+		tags = append(tags, chesstools.PgnTag{Key: "ECO", Value: tree.eco})
+	}
+	startFen := tree.g.GetRootMove().Position().XFENString()
+	if startFen != chess.StartingPosition().XFENString() {
+		tags = append(tags, chesstools.PgnTag{Key: "SetUp", Value: "1"},
+			chesstools.PgnTag{Key: "FEN", Value: startFen})
+	}
+	tags = append(tags, chesstools.PgnTag{Key: "Annotator",
+		Value: "https://github.com/mikeb26/chesstools"})
+
+	return tags
+}
+
+func (merger *Merger) emit(output io.Writer) error {
+	pgnWriter := chesstools.NewPgnWriter()
+	for _, tree := range merger.sortedTrees() {
+		err := pgnWriter.WriteGameWithTags(output, merger.treeTags(tree),
+			tree.g)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(output, "\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (merger *Merger) writeOutput() error {
+	if merger.opts.output == "" {
+		out := bufio.NewWriter(os.Stdout)
+		err := merger.emit(out)
+		if err != nil {
+			return err
+		}
+		return out.Flush()
+	}
+
+	f, err := os.Create(merger.opts.output)
+	if err != nil {
+		return fmt.Errorf("Failed to create %v: %w", merger.opts.output, err)
+	}
+	out := bufio.NewWriter(f)
+	err = merger.emit(out)
+	if err == nil {
+		err = out.Flush()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to write %v: %w", merger.opts.output, err)
+	}
+
+	return nil
+}
+
+func (merger *Merger) printStatsAndConflicts(w io.Writer) {
+	fmt.Fprintf(w, "Merged %v games (%v lines) from %v pgn files into %v games.\n",
+		merger.gameCount, merger.lineCount, len(merger.opts.pgnFiles),
+		len(merger.trees))
+	fmt.Fprintf(w, "\tUnique Positions: %v\n\tDuplicate Positions: %v\n\tTranspositions: %v\n\tConflict Positions: %v\n",
+		merger.uniquePosCount, merger.dupPosCount, merger.transpositionCount,
+		len(merger.conflictList))
+
+	if len(merger.conflictList) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\tConflicts:\n")
+
+	for _, c := range merger.conflictList {
+		fmt.Fprintf(w, "\t\t%v\n", c)
+	}
+}
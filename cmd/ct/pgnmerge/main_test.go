@@ -0,0 +1,144 @@
+package pgnmerge
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/corentings/chess/v2"
+)
+
+const oursPgn = `[Event "Ruy Lopez"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 { the Spanish } *
+
+[Event "Sicilian"]
+
+1. e4 c5 2. Nf3 *
+`
+
+const theirsPgn = `[Event "Italian"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bc4 *
+
+[Event "Reti move order"]
+
+1. Nf3 e5 2. e4 Nc6 3. Bb5 a6 (3... Nf6) *
+`
+
+func writeTestPgns(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	ours := filepath.Join(dir, "ours.pgn")
+	theirs := filepath.Join(dir, "theirs.pgn")
+	err := os.WriteFile(ours, []byte(oursPgn), 0644)
+	if err == nil {
+		err = os.WriteFile(theirs, []byte(theirsPgn), 0644)
+	}
+	if err != nil {
+		t.Fatalf("failed to write test pgns: %v", err)
+	}
+
+	return ours, theirs
+}
+
+func TestParseArgs(t *testing.T) {
+	var opts MergeOpts
+	err := parseArgs([]string{"--color", "w", "a.pgn", "b.pgn", "-o", "out.pgn"},
+		&opts)
+	if err != nil {
+		t.Fatalf("parseArgs failed: %v", err)
+	}
+	if opts.output != "out.pgn" || opts.color != chess.White ||
+		strings.Join(opts.pgnFiles, ",") != "a.pgn,b.pgn" {
+		t.Fatalf("unexpected opts %+v", opts)
+	}
+
+	err = parseArgs([]string{"-o", "out.pgn"}, &MergeOpts{})
+	if err == nil {
+		t.Fatalf("expected an error without PGN files")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	ours, theirs := writeTestPgns(t)
+	merger := NewMerger(&MergeOpts{color: chess.White,
+		pgnFiles: []string{ours, theirs}})
+	err := merger.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = merger.emit(&buf)
+	if err != nil {
+		t.Fatalf("emit failed: %v", err)
+	}
+	// the Reti move order transposes into the Ruy Lopez after 2. e4, so the
+	// rest of that game continues from 2. Nf3
+	expected := `1. e4 (1. Nf3 e5 2. e4) 1... e5 (1... c5 2. Nf3) 2. Nf3 Nc6 3. Bb5 { the
+Spanish } (3. Bc4) 3... a6 (3... Nf6) *
+`
+	out := buf.String()
+	if !strings.HasPrefix(out, "[Event \"Merged repertoire\"]\n") ||
+		!strings.HasSuffix(out, "\n"+expected+"\n") {
+		t.Fatalf("unexpected merged PGN:\n%v", out)
+	}
+
+	if merger.gameCount != 4 || merger.lineCount != 5 ||
+		merger.transpositionCount != 1 {
+		t.Fatalf("unexpected counts games:%v lines:%v transpositions:%v",
+			merger.gameCount, merger.lineCount, merger.transpositionCount)
+	}
+	// 3. Bc4 vs 3. Bb5 and 1. Nf3 vs 1. e4
+	if len(merger.conflictList) != 2 {
+		t.Fatalf("expected 2 conflicts but got %v", len(merger.conflictList))
+	}
+	c := merger.conflictList[0]
+	if c.Existing.Move != "Bb5" || c.Existing.PgnFilename != ours ||
+		c.Existing.GameNum != 1 || c.Conflicting.Move != "Bc4" ||
+		c.Conflicting.PgnFilename != theirs || c.Conflicting.GameNum != 1 {
+		t.Fatalf("unexpected conflict %+v", c)
+	}
+
+	buf.Reset()
+	merger.printStatsAndConflicts(&buf)
+	if !strings.Contains(buf.String(), "Move Bc4 from game Italian("+theirs+
+		"#1) conflicts with move Bb5 from game Ruy Lopez("+ours+"#1)") {
+		t.Fatalf("unexpected conflict report:\n%v", buf.String())
+	}
+}
+
+func TestMergeByEco(t *testing.T) {
+	ours, theirs := writeTestPgns(t)
+	merger := NewMerger(&MergeOpts{color: chess.NoColor, byEco: true,
+		pgnFiles: []string{ours, theirs}})
+	err := merger.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(merger.conflictList) != 0 {
+		t.Fatalf("expected no conflicts without --color")
+	}
+
+	var buf bytes.Buffer
+	err = merger.emit(&buf)
+	if err != nil {
+		t.Fatalf("emit failed: %v", err)
+	}
+	ecos := make([]string, 0)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "[ECO ") {
+			ecos = append(ecos, line)
+		}
+	}
+	if len(ecos) != len(merger.trees) || len(ecos) < 3 {
+		t.Fatalf("expected one game per ECO code:\n%v", buf.String())
+	}
+	for ii := 1; ii < len(ecos); ii++ {
+		if ecos[ii-1] >= ecos[ii] {
+			t.Fatalf("expected games in ECO order but got %v", ecos)
+		}
+	}
+}
@@ -141,16 +141,11 @@ func (mkCtx *MkCtx) String() string {
 		"Variant", "TimeControl", "ECO", "Opening", "Termination", "Annotator"}
 
 	var sb strings.Builder
-	for _, key := range tagKeys {
-		val, ok := mkCtx.tags[key]
-		if !ok || val == "" {
-			continue
-		}
-		sb.WriteString(fmt.Sprintf("[%v \"%v\"]\n", key, val))
-	}
-
+	pgnWriter := chesstools.NewPgnWriter()
+	pgnWriter.WriteTags(&sb, chesstools.TagsFromMap(mkCtx.tags, tagKeys...))
 	sb.WriteString("\n")
 
+	var movetext strings.Builder
 	g := mkCtx.openingGame.G
 	mvs := g.Moves()
 	pos := g.Positions()
@@ -168,7 +163,7 @@ func (mkCtx *MkCtx) String() string {
 
 		mvDisp := notation.Encode(pos[idx], mvs[idx])
 
-		sb.WriteString(fmt.Sprintf("%v. %v { [%%clk %v] } ", mvNumStr, mvDisp,
+		movetext.WriteString(fmt.Sprintf("%v. %v { [%%clk %v] } ", mvNumStr, mvDisp,
 			mkCtx.moveClocks[idx]))
 
 		if idx%2 != 0 {
@@ -177,11 +172,11 @@ func (mkCtx *MkCtx) String() string {
 	}
 
 	if mkCtx.resultReason != "" {
-		sb.WriteString(fmt.Sprintf("{ %v } ", mkCtx.resultReason))
+		movetext.WriteString(fmt.Sprintf("{ %v } ", mkCtx.resultReason))
 	}
 
-	sb.WriteString(g.Outcome().String())
-	sb.WriteString("\n\n\n")
+	pgnWriter.WriteMovetext(&sb, movetext.String(), g.Outcome().String())
+	sb.WriteString("\n\n")
 
 	return sb.String()
 }
@@ -244,46 +244,50 @@ func (dag *Dag) emitGameHeadersToOutput(output io.Writer, node *DagNode,
 
 	currentTime := time.Now()
 
-	// https://en.wikipedia.org/wiki/Portable_Game_Notation
-	// "Seven Tag Roster" should be first
-	fmt.Fprintf(output, "[Event \"%v\"]\n", node.openingName)
-	fmt.Fprintf(output, "[Site \"%v\"]\n", "")
-	fmt.Fprintf(output, "[Date \"%v\"]\n", fmt.Sprintf("%v.%02v.%02v",
-		currentTime.Year(), int(currentTime.Month()),
-		currentTime.Day()))
-	fmt.Fprintf(output, "[Round \"%v\"]\n", "1")
-	fmt.Fprintf(output, "[White \"%v\"]\n", "")
-	fmt.Fprintf(output, "[Black \"%v\"]\n", "")
-	fmt.Fprintf(output, "[Result \"%v\"]\n", "*")
-
-	fmt.Fprintf(output, "[UTCDate \"%v\"]\n", fmt.Sprintf("%v.%02v.%02v",
-		currentTime.UTC().Year(), int(currentTime.UTC().Month()),
-		currentTime.UTC().Day()))
-	fmt.Fprintf(output, "[UTCTime \"%v\"]\n", fmt.Sprintf("%02v:%02v:%02v",
-		currentTime.UTC().Hour(), currentTime.UTC().Minute(),
-		currentTime.UTC().Second()))
-	fmt.Fprintf(output, "[Variant \"%v\"]\n", "Standard")
-	fmt.Fprintf(output, "[ECO \"%v\"]\n", node.openingEco)
-	fmt.Fprintf(output, "[Annotator \"%v\"]\n",
-		"https://github.com/mikeb26/chesstools")
+	tags := []chesstools.PgnTag{
+		{Key: "Event", Value: node.openingName},
+		{Key: "Site", Value: ""},
+		{Key: "Date", Value: fmt.Sprintf("%v.%02v.%02v", currentTime.Year(),
+			int(currentTime.Month()), currentTime.Day())},
+		{Key: "Round", Value: "1"},
+		{Key: "White", Value: ""},
+		{Key: "Black", Value: ""},
+		{Key: "Result", Value: "*"},
+		{Key: "UTCDate", Value: fmt.Sprintf("%v.%02v.%02v",
+			currentTime.UTC().Year(), int(currentTime.UTC().Month()),
+			currentTime.UTC().Day())},
+		{Key: "UTCTime", Value: fmt.Sprintf("%02v:%02v:%02v",
+			currentTime.UTC().Hour(), currentTime.UTC().Minute(),
+			currentTime.UTC().Second())},
+		{Key: "Variant", Value: "Standard"},
+		{Key: "ECO", Value: node.openingEco},
+		{Key: "Annotator", Value: "https://github.com/mikeb26/chesstools"},
+	}
 	if fen != "" {
-		fmt.Fprintf(output, "[FEN \"%v\"]\n", fen)
-		fmt.Fprintf(output, "[SetUp \"%v\"]\n", "1")
+		tags = append(tags, chesstools.PgnTag{Key: "FEN", Value: fen},
+			chesstools.PgnTag{Key: "SetUp", Value: "1"})
 	}
+
+	chesstools.NewPgnWriter().WriteTags(output, tags)
 }
 
 func (dag *Dag) emitGameToOutput(output io.Writer, node *DagNode) error {
+	pgnWriter := chesstools.NewPgnWriter()
 	if dag.outputMode == Consolidated &&
 		node.moveListSet.allMoveListsHaveSameFEN() {
 		dag.emitGameHeadersToOutput(output, node,
 			node.moveListSet.moveLists[0].fen)
-		fmt.Fprintf(output, "\n%v %v *\n\n\n", node.moveListSet.String(),
-			node.getEvalStr())
+		fmt.Fprintf(output, "\n")
+		pgnWriter.WriteMovetext(output, fmt.Sprintf("%v %v",
+			node.moveListSet.String(), node.getEvalStr()), "*")
+		fmt.Fprintf(output, "\n\n")
 	} else {
 		for _, moveList := range node.moveListSet.moveLists {
 			dag.emitGameHeadersToOutput(output, node, moveList.fen)
-			fmt.Fprintf(output, "\n%v %v *\n\n\n", moveList.String(),
-				node.getEvalStr())
+			fmt.Fprintf(output, "\n")
+			pgnWriter.WriteMovetext(output, fmt.Sprintf("%v %v",
+				moveList.String(), node.getEvalStr()), "*")
+			fmt.Fprintf(output, "\n\n")
 		}
 	}
 
@@ -34,6 +34,7 @@ type RepBldOpts struct {
 	expandVar    bool
 	noCloudCache bool
 	noAtime      bool
+	strict       bool
 }
 
 type MoveMapValue struct {
@@ -74,6 +75,7 @@ func parseArgs(args []string, opts *RepBldOpts) error {
 	f.IntVar(&opts.minGames, "mingames", DefaultMinGames, "<minimum games to consider from an opening book position>")
 	f.BoolVar(&opts.expandVar, "includevar", true, "include variations in input pgn <true|false>")
 	f.BoolVar(&opts.noCloudCache, "nocloudcache", false, "do not reference lichess APIs for cached evaluations")
+	f.BoolVar(&opts.strict, "strict", false, "abort on the first malformed game in the input pgn instead of skipping it")
 
 	f.Parse(args)
 	switch strings.ToUpper(colorFlag) {
@@ -345,13 +347,8 @@ func selectMoveViaEngine(openingGame *chesstools.OpeningGame,
 }
 
 func processOnePGN(repOpts *RepBldOpts, f io.Reader, dag *Dag) error {
-
-	var scanner *chess.Scanner
-	if repOpts.expandVar {
-		scanner = chess.NewScanner(f, chess.WithExpandVariations())
-	} else {
-		scanner = chess.NewScanner(f)
-	}
+	scanner := chesstools.NewPgnStream(f, repOpts.inputFile).
+		WithStrict(repOpts.strict).WithExpandVariations(repOpts.expandVar)
 
 	ii := 1
 	for scanner.HasNext() {
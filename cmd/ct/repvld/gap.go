@@ -21,7 +21,7 @@ func (rv *RepValidator) selectMove(openingGame *chesstools.OpeningGame,
 		return "", nil
 	}
 
-	return moveMapVal.move, nil
+	return moveMapVal.Move, nil
 }
 
 func (rv *RepValidator) buildRep(openingGame *chesstools.OpeningGame,
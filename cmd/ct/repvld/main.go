@@ -29,6 +29,7 @@ type RepValidatorOpts struct {
 	cacheOnly           bool
 	staleOk             bool
 	minMoveNum2Eval     uint
+	strict              bool
 }
 
 type RepValidator struct {
@@ -36,7 +37,7 @@ type RepValidator struct {
 
 	scoreExceptions map[string]string
 	pgnFileList     []string
-	moveMap         map[string]MoveMapValue
+	moveMap         map[string]chesstools.MoveSource
 	// positions counts do not include the final or "leaf" position in a
 	// repertoire. e.g. a white opening book consisting of just:
 	// 1. e4 d5 2. Nf3 Nc6 3. Bb5
@@ -49,35 +50,23 @@ type RepValidator struct {
 	dupPosCount       uint
 	conflictPosCount  uint
 	gameList          []*chess.Game
-	whiteConflictList []Conflict
-	blackConflictList []Conflict
+	whiteConflictList []chesstools.MoveConflict
+	blackConflictList []chesstools.MoveConflict
 	evalCtx           *chesstools.EvalCtx
 }
 
-type MoveMapValue struct {
-	move        string
-	game        *chess.Game
-	gameNum     int
-	pgnFilename string
-}
-
-type Conflict struct {
-	existingMove MoveMapValue
-	conflictMove MoveMapValue
-}
-
 func NewRepValidator(optsIn *RepValidatorOpts, pgns []string) *RepValidator {
 	rv := &RepValidator{
 		opts:              optsIn,
 		scoreExceptions:   make(map[string]string, 0),
 		pgnFileList:       make([]string, len(pgns)),
-		moveMap:           make(map[string]MoveMapValue),
+		moveMap:           make(map[string]chesstools.MoveSource),
 		uniquePosCount:    0,
 		dupPosCount:       0,
 		conflictPosCount:  0,
 		gameList:          make([]*chess.Game, 0),
-		whiteConflictList: make([]Conflict, 0),
-		blackConflictList: make([]Conflict, 0),
+		whiteConflictList: make([]chesstools.MoveConflict, 0),
+		blackConflictList: make([]chesstools.MoveConflict, 0),
 	}
 	for ii, p := range pgns {
 		rv.pgnFileList[ii] = p
@@ -131,6 +120,8 @@ func parseArgs(args []string, opts *RepValidatorOpts) ([]string, error) {
 	f.BoolVar(&opts.cacheOnly, "cacheonly", false, "only return cached evaluations")
 	f.BoolVar(&opts.staleOk, "staleok", true, "accept cached evals from older engine versions")
 	f.UintVar(&opts.minMoveNum2Eval, "minevalmovenum", 3, "<minevalmovenum>")
+	f.BoolVar(&opts.strict, "strict", false,
+		"abort on the first malformed game instead of skipping it")
 	f.Parse(args)
 	switch strings.ToUpper(colorFlag) {
 	case "WHITE":
@@ -159,7 +150,7 @@ func (rv *RepValidator) printStatsAndConflicts() {
 	fmt.Printf("Loaded %v games from %v pgn files.\n", len(rv.gameList), len(rv.pgnFileList))
 	fmt.Printf("\tUnique Posisitions: %v\n\tDuplicate Positions: %v\n\tConflict Posisitions: %v (white:%v black:%v)\n", rv.uniquePosCount, rv.dupPosCount, rv.conflictPosCount, len(rv.whiteConflictList), len(rv.blackConflictList))
 
-	var conflictList *[]Conflict
+	var conflictList *[]chesstools.MoveConflict
 	if rv.opts.color == chess.Black {
 		conflictList = &rv.blackConflictList
 	} else {
@@ -173,11 +164,7 @@ func (rv *RepValidator) printStatsAndConflicts() {
 	fmt.Printf("\tConflicts:\n")
 
 	for _, c := range *conflictList {
-		fmt.Printf("\t\tMove %v from game %v(%v#%v) conflicts with move %v from	game %v(%v#%v)\n",
-			c.conflictMove.move, getGameName(c.conflictMove.game),
-			c.conflictMove.pgnFilename, c.conflictMove.gameNum, c.existingMove.move,
-			getGameName(c.existingMove.game), c.existingMove.pgnFilename,
-			c.existingMove.gameNum)
+		fmt.Printf("\t\t%v\n", c)
 	}
 }
 
@@ -245,18 +232,9 @@ func (rv *RepValidator) Load() error {
 	return nil
 }
 
-func getGameName(g *chess.Game) string {
-	gn := "?"
-	tagPair := g.GetTagPair("Event")
-	if tagPair != "" {
-		gn = tagPair
-	}
-
-	return gn
-}
-
 func (rv *RepValidator) processOnePGN(f io.Reader, pgnFilename string) error {
-	scanner := chess.NewScanner(f, chess.WithExpandVariations())
+	scanner := chesstools.NewPgnStream(f, pgnFilename).
+		WithStrict(rv.opts.strict).WithExpandVariations(true)
 
 	ii := 1
 	for scanner.HasNext() {
@@ -338,7 +316,7 @@ func (rv *RepValidator) scoreMove(g *chess.Game, pgnFilename string,
 	er := rv.evalCtx.Eval()
 	if er == nil {
 		fmt.Printf("Skipping scoring move %v in game %v(%v#%v) FEN:%v without engine eval\n",
-			moveCount, getGameName(g), pgnFilename, gameNumLocal, fen)
+			moveCount, chesstools.GameName(g), pgnFilename, gameNumLocal, fen)
 		return true
 	}
 	// BestMove is occasionally missing the check+ symbol
@@ -354,7 +332,7 @@ func (rv *RepValidator) scoreMove(g *chess.Game, pgnFilename string,
 		if !ok {
 			fmt.Printf("** Engine recommends %v instead of %v in game %v(%v#%v) FEN:%v\n",
 				sprintMove(moveCount, er.BestMove, rv.opts.color),
-				sprintMove(moveCount, m, rv.opts.color), getGameName(g), pgnFilename,
+				sprintMove(moveCount, m, rv.opts.color), chesstools.GameName(g), pgnFilename,
 				gameNumLocal, fen)
 
 			return false
@@ -362,7 +340,7 @@ func (rv *RepValidator) scoreMove(g *chess.Game, pgnFilename string,
 		if exceptionsMove == m {
 			fmt.Printf("Ignoring engine recommended %v instead of %v in game %v(%v#%v) FEN:%v\n",
 				sprintMove(moveCount, er.BestMove, rv.opts.color),
-				sprintMove(moveCount, m, rv.opts.color), getGameName(g), pgnFilename,
+				sprintMove(moveCount, m, rv.opts.color), chesstools.GameName(g), pgnFilename,
 				gameNumLocal, fen)
 
 			return true
@@ -370,7 +348,7 @@ func (rv *RepValidator) scoreMove(g *chess.Game, pgnFilename string,
 
 		fmt.Printf("Exceptions move %v does not match repertoire move %v in game %v(%v#%v) FEN:%v\n",
 			sprintMove(moveCount, exceptionsMove, rv.opts.color),
-			sprintMove(moveCount, m, rv.opts.color), getGameName(g), pgnFilename,
+			sprintMove(moveCount, m, rv.opts.color), chesstools.GameName(g), pgnFilename,
 			gameNumLocal, fen)
 
 		return false
@@ -389,8 +367,8 @@ func (rv *RepValidator) processOneMove(g *chess.Game, pgnFilenameLocal string,
 
 	val, present := rv.moveMap[fen]
 	if !present {
-		rv.moveMap[fen] = MoveMapValue{move: m, game: g, gameNum: gameNumLocal,
-			pgnFilename: pgnFilenameLocal}
+		rv.moveMap[fen] = chesstools.MoveSource{Move: m, Game: g,
+			GameNum: gameNumLocal, PgnFilename: pgnFilenameLocal}
 		rv.uniquePosCount++
 		if p.Turn() == rv.opts.color && rv.shouldScoreMoves() &&
 			moveCount > int(rv.opts.minMoveNum2Eval) {
@@ -399,16 +377,16 @@ func (rv *RepValidator) processOneMove(g *chess.Game, pgnFilenameLocal string,
 					gameNumLocal, fen, moveCount, m)
 			} else {
 				fmt.Printf("Skipping scoring move %v in game %v(%v#%v) FEN:%v due to earlier move engine recommendation\n",
-					moveCount, getGameName(g), pgnFilenameLocal, gameNumLocal, fen)
+					moveCount, chesstools.GameName(g), pgnFilenameLocal, gameNumLocal, fen)
 			}
 		}
 		return nil
 	} // else
 
-	if val.move != m {
-		conflictVal := MoveMapValue{move: m, game: g, gameNum: gameNumLocal,
-			pgnFilename: pgnFilenameLocal}
-		c := Conflict{existingMove: val, conflictMove: conflictVal}
+	if val.Move != m {
+		conflictVal := chesstools.MoveSource{Move: m, Game: g,
+			GameNum: gameNumLocal, PgnFilename: pgnFilenameLocal}
+		c := chesstools.MoveConflict{Existing: val, Conflicting: conflictVal}
 		if p.Turn() == chess.Black {
 			rv.blackConflictList = append(rv.blackConflictList, c)
 		} else {
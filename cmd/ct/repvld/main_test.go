@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/corentings/chess/v2"
+	"github.com/mikeb26/chesstools"
 )
 
 func TestNewRepValidator(t *testing.T) {
@@ -70,21 +71,21 @@ func TestLoad(t *testing.T) {
 	if len(rv.blackConflictList) != 10 {
 		t.Fatalf("Expected 10 blackConflicts but got %v", len(rv.blackConflictList))
 	}
-	if rv.whiteConflictList[0].existingMove.move != "Qe2" ||
-		rv.whiteConflictList[0].conflictMove.move != "Bf4" {
+	if rv.whiteConflictList[0].Existing.Move != "Qe2" ||
+		rv.whiteConflictList[0].Conflicting.Move != "Bf4" {
 		t.Fatalf("1st conflict does not match")
 	}
-	if rv.whiteConflictList[1].existingMove.move != "f4" ||
-		rv.whiteConflictList[1].conflictMove.move != "Bd3" {
+	if rv.whiteConflictList[1].Existing.Move != "f4" ||
+		rv.whiteConflictList[1].Conflicting.Move != "Bd3" {
 		t.Fatalf("2nd conflict does not match existing:%v conflict:%v",
-			rv.whiteConflictList[1].existingMove.move,
-			rv.whiteConflictList[1].conflictMove.move)
+			rv.whiteConflictList[1].Existing.Move,
+			rv.whiteConflictList[1].Conflicting.Move)
 	}
-	if rv.whiteConflictList[2].existingMove.move != "O-O" ||
-		rv.whiteConflictList[2].conflictMove.move != "e5" {
+	if rv.whiteConflictList[2].Existing.Move != "O-O" ||
+		rv.whiteConflictList[2].Conflicting.Move != "e5" {
 		t.Fatalf("3rd conflict does not match existing:%v conflict:%v",
-			rv.whiteConflictList[2].existingMove.move,
-			rv.whiteConflictList[2].conflictMove.move)
+			rv.whiteConflictList[2].Existing.Move,
+			rv.whiteConflictList[2].Conflicting.Move)
 	}
 }
 
@@ -109,6 +110,7 @@ func TestCorruptFileLoad(t *testing.T) {
 		color:           chess.Black,
 		gapThreshold:    0.04,
 		minMoveNum2Eval: 3,
+		strict:          true,
 	}
 	rv := NewRepValidator(&opts, []string{"../../../assets/test2.pgn"})
 	err := rv.Load()
@@ -118,4 +120,8 @@ func TestCorruptFileLoad(t *testing.T) {
 	if errors.Is(err, os.ErrNotExist) {
 		t.Fatalf("rv.Load() failed as expected but not with correct error value: %v", err)
 	}
+	var parseErr *chesstools.PgnParseError
+	if !errors.As(err, &parseErr) || parseErr.GameNum != 1 {
+		t.Fatalf("rv.Load() failed as expected but not with a parse error: %v", err)
+	}
 }
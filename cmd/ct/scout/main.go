@@ -0,0 +1,608 @@
+/* Utility for preparing against a Lichess player. Walks the Lichess player
+ * explorer from the player's perspective and reports their most common
+ * lines, where they deviate from theory, their worst scoring lines, and
+ * optionally engine evaluations at the branch points along the way.
+ */
+
+package scout
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/corentings/chess/v2"
+	"github.com/mikeb26/chesstools"
+)
+
+type ScoutOpts struct {
+	player          string
+	color           chess.Color
+	maxDepth        int
+	minGames        int
+	theoryThreshold float64
+	startMoves      string
+	topN            int
+	pgnFile         string
+	allSpeeds       bool
+	eval            bool
+	evalTime        uint
+	noCloudCache    bool
+	maxRequests     int
+	requestDelay    time.Duration
+}
+
+type ScoutNode struct {
+	g       *chess.Game
+	san     string
+	parent  *ScoutNode
+	stats   chesstools.MoveStats
+	resp    *chesstools.OpeningResp
+	eco     string
+	opening string
+
+	// only set on the player's moves
+	deviation   bool
+	theoryMoves []string
+
+	// only set for moves made at a branch point when --eval is set
+	eval *chesstools.EvalResult
+
+	children []*ScoutNode
+}
+
+type Scout struct {
+	opts    *ScoutOpts
+	root    *ScoutNode
+	evalCtx *chesstools.EvalCtx
+
+	requests  int
+	truncated bool // stopped early after --maxrequests
+
+	// overridden by tests to avoid the network
+	fetchPlayer func(g *chess.Game) (*chesstools.OpeningResp, error)
+	fetchTheory func(g *chess.Game) (*chesstools.OpeningResp, error)
+}
+
+const DefaultMaxDepth = 12
+const DefaultMinGames = 3
+const DefaultMaxRequests = 500
+const DefaultRequestDelay = 500 * time.Millisecond
+
+func parseArgs(args []string, opts *ScoutOpts) error {
+	f := flag.NewFlagSet("scout", flag.ExitOnError)
+	var colorFlag string
+
+	f.StringVar(&colorFlag, "color", "", "<white|black> (color the player plays)")
+	f.IntVar(&opts.maxDepth, "maxdepth", DefaultMaxDepth, "<max depth in plies>")
+	f.IntVar(&opts.minGames, "mingames", DefaultMinGames, "<minimum games for a move to be followed>")
+	f.Float64Var(&opts.theoryThreshold, "theorythreshold", 0.05, "<minimum share of Lichess database games for a move to be theory>")
+	f.StringVar(&opts.startMoves, "start", "", "<pgnStart> (starting moves)")
+	f.IntVar(&opts.topN, "top", 10, "<number of lines to list per report section>")
+	f.StringVar(&opts.pgnFile, "pgn", "", "<outputFile> (also write the report as a PGN with variations)")
+	f.BoolVar(&opts.allSpeeds, "allspeeds", false, "include bullet and correspondence games")
+	f.BoolVar(&opts.eval, "eval", false, "evaluate positions at branch points")
+	f.UintVar(&opts.evalTime, "evaltime", 10, "<engine search time per position>")
+	f.BoolVar(&opts.noCloudCache, "nocloudcache", false, "do not reference lichess APIs for cached evaluations")
+	f.IntVar(&opts.maxRequests, "maxrequests", DefaultMaxRequests, "<maximum Lichess explorer requests before the walk stops>")
+	f.DurationVar(&opts.requestDelay, "requestdelay", DefaultRequestDelay, "<pause between Lichess explorer requests>")
+
+	// allow the username to precede the flags
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		opts.player = args[0]
+		args = args[1:]
+	}
+	err := f.Parse(args)
+	if err != nil {
+		return err
+	}
+	if opts.player == "" && len(f.Args()) > 0 {
+		opts.player = f.Args()[0]
+	}
+	if opts.player == "" {
+		return fmt.Errorf("please specify a lichess username")
+	}
+
+	switch strings.ToUpper(colorFlag) {
+	case "WHITE":
+		fallthrough
+	case "W":
+		opts.color = chess.White
+	case "BLACK":
+		fallthrough
+	case "B":
+		opts.color = chess.Black
+	default:
+		return fmt.Errorf("please specify --color <white|black>")
+	}
+	if opts.maxDepth < 1 {
+		return fmt.Errorf("--maxdepth must be at least 1")
+	}
+	if opts.minGames < 1 {
+		return fmt.Errorf("--mingames must be at least 1")
+	}
+	if opts.maxRequests < 1 {
+		return fmt.Errorf("--maxrequests must be at least 1")
+	}
+
+	return nil
+}
+
+func Main(args []string) {
+	var opts ScoutOpts
+	err := parseArgs(args, &opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse arguments: %v\n", err)
+		os.Exit(1)
+		return
+	}
+
+	scout, err := NewScout(&opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to init: %v\n", err)
+		os.Exit(1)
+	}
+	if opts.eval {
+		scout.evalCtx = chesstools.NewEvalCtx(false).WithEvalTime(opts.evalTime)
+		if opts.noCloudCache {
+			scout.evalCtx = scout.evalCtx.WithoutCloudCache()
+		}
+		defer scout.evalCtx.Close()
+		scout.evalCtx.InitEngine()
+	}
+
+	err = scout.Walk()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to scout %v: %v\n", opts.player, err)
+		os.Exit(1)
+	}
+	if scout.truncated {
+		fmt.Fprintf(os.Stderr, "Stopped after %v explorer requests; raise --maxrequests or lower --maxdepth to scout further\n",
+			scout.requests)
+	}
+
+	scout.emitReport(os.Stdout)
+
+	if opts.pgnFile != "" {
+		outFile, err := os.Create(opts.pgnFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open output '%v': %v\n",
+				opts.pgnFile, err)
+			os.Exit(1)
+		}
+		err = scout.emitPgn(outFile)
+		closeErr := outFile.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write '%v': %v\n", opts.pgnFile,
+				err)
+			os.Exit(1)
+		}
+	}
+}
+
+func NewScout(optsIn *ScoutOpts) (*Scout, error) {
+	g := chess.NewGame()
+	if optsIn.startMoves != "" {
+		pgnReader, err := chess.PGN(strings.NewReader(optsIn.startMoves))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse %v: %w", optsIn.startMoves,
+				err)
+		}
+		g = chess.NewGame(pgnReader)
+	}
+
+	scout := &Scout{
+		opts: optsIn,
+		root: &ScoutNode{
+			g:        g,
+			children: make([]*ScoutNode, 0),
+		},
+	}
+	scout.root.eco, scout.root.opening, _ = chesstools.ClassifyGame(g)
+	scout.fetchPlayer = func(g *chess.Game) (*chesstools.OpeningResp, error) {
+		return chesstools.GetPlayerReplies(g, optsIn.player, optsIn.color,
+			optsIn.allSpeeds)
+	}
+	scout.fetchTheory = func(g *chess.Game) (*chesstools.OpeningResp, error) {
+		return chesstools.GetLichessReplies(g, false, optsIn.allSpeeds)
+	}
+
+	return scout, nil
+}
+
+func (scout *Scout) Walk() error {
+	return scout.walkNode(scout.root, 0)
+}
+
+// fetch spaces out explorer requests and stops making them after
+// --maxrequests; it returns a nil response once the walk is truncated. the
+// explorer's 429s are retried by chesstools.
+func (scout *Scout) fetch(fetchFunc func(g *chess.Game) (*chesstools.OpeningResp, error),
+	g *chess.Game) (*chesstools.OpeningResp, error) {
+
+	if scout.requests >= scout.opts.maxRequests {
+		scout.truncated = true
+		return nil, nil
+	}
+	if scout.requests > 0 {
+		time.Sleep(scout.opts.requestDelay)
+	}
+	scout.requests++
+
+	return fetchFunc(g)
+}
+
+func (scout *Scout) walkNode(node *ScoutNode, depth int) error {
+	var err error
+	node.resp, err = scout.fetch(scout.fetchPlayer, node.g)
+	if err != nil {
+		return err
+	}
+	if node.resp == nil {
+		node.resp = &chesstools.OpeningResp{}
+		return nil
+	}
+	if depth >= scout.opts.maxDepth {
+		return nil
+	}
+
+	moves := make([]chesstools.MoveStats, 0)
+	for _, mv := range node.resp.Moves {
+		if mv.Total() >= scout.opts.minGames {
+			moves = append(moves, mv)
+		}
+	}
+	if len(moves) == 0 {
+		return nil
+	}
+
+	var theory map[string]bool
+	if node.g.Position().Turn() == scout.opts.color {
+		theory, err = scout.getTheory(node)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, mv := range moves {
+		child, err := scout.newChild(node, mv)
+		if err != nil {
+			return err
+		}
+		if theory != nil && len(theory) > 0 && !theory[mv.San] {
+			child.deviation = true
+			child.theoryMoves = sortedKeys(theory)
+		}
+		if scout.evalCtx != nil && len(moves) > 1 {
+			scout.evalCtx.SetFEN(child.g.Position().XFENString())
+			child.eval = scout.evalCtx.Eval()
+		}
+		node.children = append(node.children, child)
+
+		err = scout.walkNode(child, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// theory is every move with at least --theorythreshold of the Lichess
+// database games from the node's position
+func (scout *Scout) getTheory(node *ScoutNode) (map[string]bool, error) {
+	resp, err := scout.fetch(scout.fetchTheory, node.g)
+	if err != nil || resp == nil {
+		return nil, err
+	}
+
+	theory := make(map[string]bool)
+	total := resp.Total()
+	for _, mv := range resp.Moves {
+		if total > 0 && chesstools.Pct(mv.Total(), total) >= scout.opts.theoryThreshold {
+			theory[mv.San] = true
+		}
+	}
+
+	return theory, nil
+}
+
+func (scout *Scout) newChild(parent *ScoutNode,
+	mv chesstools.MoveStats) (*ScoutNode, error) {
+
+	g := parent.g.Clone()
+	err := g.PushNotationMove(mv.San, chess.AlgebraicNotation{}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse move %v after %v: %w", mv.San,
+			parent.g.String(), err)
+	}
+
+	child := &ScoutNode{
+		g:        g,
+		san:      mv.San,
+		parent:   parent,
+		stats:    mv,
+		eco:      parent.eco,
+		opening:  parent.opening,
+		children: make([]*ScoutNode, 0),
+	}
+	fen := g.Position().XFENString()
+	if eco := chesstools.GetOpeningEco(fen); eco != "" {
+		child.eco = eco
+		child.opening = chesstools.GetOpeningName(fen)
+	}
+
+	return child, nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+
+	return ret
+}
+
+// playerScore is the player's score in games through this node
+func (scout *Scout) playerScore(node *ScoutNode) float64 {
+	total := node.stats.Total()
+	if total == 0 {
+		return 0.0
+	}
+	wins := node.stats.WhiteWins
+	if scout.opts.color == chess.Black {
+		wins = node.stats.BlackWins
+	}
+
+	return (float64(wins) + 0.5*float64(node.stats.Draws)) / float64(total)
+}
+
+// moveText renders the moves from the game's start through node with move
+// numbers
+func (node *ScoutNode) moveText() string {
+	var sb strings.Builder
+
+	g := node.g
+	positions := g.Positions()
+	for ii, mv := range g.Moves() {
+		pos := positions[ii]
+		if ii != 0 {
+			sb.WriteString(" ")
+		}
+		if pos.Turn() == chess.White {
+			sb.WriteString(fmt.Sprintf("%v. ", ii/2+1))
+		} else if ii == 0 {
+			sb.WriteString(fmt.Sprintf("%v... ", ii/2+1))
+		}
+		sb.WriteString(chess.AlgebraicNotation{}.Encode(pos, mv))
+	}
+
+	return sb.String()
+}
+
+func (scout *Scout) collect(node *ScoutNode, filter func(*ScoutNode) bool,
+	out *[]*ScoutNode) {
+
+	if node != scout.root && filter(node) {
+		*out = append(*out, node)
+	}
+	for _, child := range node.children {
+		scout.collect(child, filter, out)
+	}
+}
+
+func isLeaf(node *ScoutNode) bool {
+	return len(node.children) == 0
+}
+
+func (scout *Scout) topLines(nodes []*ScoutNode) []*ScoutNode {
+	if len(nodes) > scout.opts.topN {
+		return nodes[:scout.opts.topN]
+	}
+
+	return nodes
+}
+
+func (scout *Scout) mostCommonLines() []*ScoutNode {
+	lines := make([]*ScoutNode, 0)
+	scout.collect(scout.root, isLeaf, &lines)
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].stats.Total() > lines[j].stats.Total()
+	})
+
+	return scout.topLines(lines)
+}
+
+func (scout *Scout) worstLines() []*ScoutNode {
+	lines := make([]*ScoutNode, 0)
+	scout.collect(scout.root, isLeaf, &lines)
+	sort.SliceStable(lines, func(i, j int) bool {
+		return scout.playerScore(lines[i]) < scout.playerScore(lines[j])
+	})
+
+	return scout.topLines(lines)
+}
+
+func (scout *Scout) deviations() []*ScoutNode {
+	devs := make([]*ScoutNode, 0)
+	scout.collect(scout.root, func(node *ScoutNode) bool {
+		return node.deviation
+	}, &devs)
+	sort.SliceStable(devs, func(i, j int) bool {
+		return devs[i].stats.Total() > devs[j].stats.Total()
+	})
+
+	return scout.topLines(devs)
+}
+
+func (scout *Scout) branchPoints() []*ScoutNode {
+	branches := make([]*ScoutNode, 0)
+	if len(scout.root.children) > 1 {
+		branches = append(branches, scout.root)
+	}
+	scout.collect(scout.root, func(node *ScoutNode) bool {
+		return len(node.children) > 1
+	}, &branches)
+
+	return branches
+}
+
+func (scout *Scout) statsString(node *ScoutNode) string {
+	return fmt.Sprintf("%v games, %v scores %v", node.stats.Total(),
+		scout.opts.player, chesstools.PctS2(scout.playerScore(node)))
+}
+
+func evalString(er *chesstools.EvalResult) string {
+	if er.Mate != 0 {
+		return fmt.Sprintf("#%v", er.Mate)
+	}
+
+	return strconv.FormatFloat(float64(er.CP)/100.0, 'f', 2, 64)
+}
+
+func openingString(node *ScoutNode) string {
+	if node.eco == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(" [%v %v]", node.eco, node.opening)
+}
+
+func (scout *Scout) emitReport(output io.Writer) {
+	fmt.Fprintf(output, "Scouting report for %v as %v (%v games)\n",
+		scout.opts.player, scout.opts.color.Name(), scout.root.resp.Total())
+
+	fmt.Fprintf(output, "\nMost common lines:\n")
+	for _, node := range scout.mostCommonLines() {
+		fmt.Fprintf(output, "  %v (%v)%v\n", node.moveText(),
+			scout.statsString(node), openingString(node))
+	}
+
+	fmt.Fprintf(output, "\nDeviations from theory:\n")
+	for _, node := range scout.deviations() {
+		fmt.Fprintf(output, "  %v (%v) instead of %v%v\n", node.moveText(),
+			scout.statsString(node), strings.Join(node.theoryMoves, ", "),
+			openingString(node.parent))
+	}
+
+	fmt.Fprintf(output, "\nWorst scoring lines:\n")
+	for _, node := range scout.worstLines() {
+		fmt.Fprintf(output, "  %v (%v)%v\n", node.moveText(),
+			scout.statsString(node), openingString(node))
+	}
+
+	if scout.evalCtx == nil {
+		return
+	}
+
+	fmt.Fprintf(output, "\nBranch points:\n")
+	for _, node := range scout.branchPoints() {
+		line := node.moveText()
+		if line == "" {
+			line = "Start"
+		}
+		fmt.Fprintf(output, "  %v%v\n", line, openingString(node))
+		for _, child := range node.children {
+			evalStr := "?"
+			if child.eval != nil {
+				evalStr = evalString(child.eval)
+			}
+			fmt.Fprintf(output, "    %v (%v) eval %v\n", child.san,
+				scout.statsString(child), evalStr)
+		}
+	}
+}
+
+func (scout *Scout) emitPgn(output io.Writer) error {
+	white, black := scout.opts.player, ""
+	if scout.opts.color == chess.Black {
+		white, black = "", scout.opts.player
+	}
+	tags := []chesstools.PgnTag{
+		{Key: "Event", Value: fmt.Sprintf("Scouting report: %v as %v",
+			scout.opts.player, scout.opts.color.Name())},
+		{Key: "Site", Value: ""},
+		{Key: "Date", Value: "????.??.??"},
+		{Key: "Round", Value: "-"},
+		{Key: "White", Value: white},
+		{Key: "Black", Value: black},
+		{Key: "Result", Value: "*"},
+		{Key: "Annotator", Value: "https://github.com/mikeb26/chesstools"},
+	}
+
+	var sb strings.Builder
+	startPly := len(scout.root.g.Moves())
+	if startPly != 0 {
+		fen := scout.root.g.Position().XFENString()
+		tags = append(tags, chesstools.PgnTag{Key: "FEN", Value: fen},
+			chesstools.PgnTag{Key: "SetUp", Value: "1"})
+	}
+	sb.WriteString(fmt.Sprintf("{ %v games }", scout.root.resp.Total()))
+	scout.pgnMoves(&sb, scout.root)
+
+	pgnWriter := chesstools.NewPgnWriter()
+	err := pgnWriter.WriteTags(output, tags)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(output, "\n")
+	if err != nil {
+		return err
+	}
+	err = pgnWriter.WriteMovetext(output, sb.String(), "*")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(output, "\n")
+
+	return err
+}
+
+// the most common move is the main line and the rest are variations
+func (scout *Scout) pgnMoves(sb *strings.Builder, node *ScoutNode) {
+	if len(node.children) == 0 {
+		return
+	}
+
+	scout.pgnMove(sb, node.children[0])
+	for _, child := range node.children[1:] {
+		sb.WriteString(" (")
+		scout.pgnMove(sb, child)
+		scout.pgnMoves(sb, child)
+		sb.WriteString(" )")
+	}
+	scout.pgnMoves(sb, node.children[0])
+}
+
+func (scout *Scout) pgnMove(sb *strings.Builder, node *ScoutNode) {
+	pos := node.parent.g.Position()
+	moveNum := len(node.g.Moves())/2 + len(node.g.Moves())%2
+	if pos.Turn() == chess.White {
+		sb.WriteString(fmt.Sprintf(" %v. %v", moveNum, node.san))
+	} else {
+		sb.WriteString(fmt.Sprintf(" %v... %v", moveNum, node.san))
+	}
+
+	sb.WriteString(fmt.Sprintf(" { %v", scout.statsString(node)))
+	if node.deviation {
+		sb.WriteString(fmt.Sprintf("; deviates from %v",
+			strings.Join(node.theoryMoves, ", ")))
+	}
+	if node.eco != node.parent.eco || node.opening != node.parent.opening {
+		sb.WriteString(fmt.Sprintf("; %v %v", node.eco, node.opening))
+	}
+	if node.eval != nil {
+		sb.WriteString(fmt.Sprintf(" [%%eval %v]", evalString(node.eval)))
+	}
+	sb.WriteString(" }")
+}
@@ -0,0 +1,182 @@
+package scout
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/corentings/chess/v2"
+	"github.com/mikeb26/chesstools"
+)
+
+func mv(san string, white int, black int, draws int) chesstools.MoveStats {
+	return chesstools.MoveStats{
+		San:       san,
+		WhiteWins: white,
+		BlackWins: black,
+		Draws:     draws,
+	}
+}
+
+func resp(moves ...chesstools.MoveStats) *chesstools.OpeningResp {
+	r := &chesstools.OpeningResp{Moves: moves}
+	for _, m := range moves {
+		r.WhiteWins += m.WhiteWins
+		r.BlackWins += m.BlackWins
+		r.Draws += m.Draws
+	}
+
+	return r
+}
+
+// stubs the explorer keyed by the moves played so far
+func stubFetch(replies map[string]*chesstools.OpeningResp) func(g *chess.Game) (*chesstools.OpeningResp, error) {
+	return func(g *chess.Game) (*chesstools.OpeningResp, error) {
+		key := strings.TrimSpace(strings.TrimSuffix(g.String(), "*"))
+		r, ok := replies[key]
+		if !ok {
+			return resp(), nil
+		}
+		return r, nil
+	}
+}
+
+func newTestScout(t *testing.T) *Scout {
+	return newTestScoutWithCap(t, DefaultMaxRequests)
+}
+
+func newTestScoutWithCap(t *testing.T, maxRequests int) *Scout {
+	opts := ScoutOpts{
+		player:          "someone",
+		color:           chess.Black,
+		maxDepth:        2,
+		minGames:        2,
+		theoryThreshold: 0.05,
+		topN:            10,
+		maxRequests:     maxRequests,
+	}
+	scout, err := NewScout(&opts)
+	if err != nil {
+		t.Fatalf("NewScout failed: %v", err)
+	}
+	scout.fetchPlayer = stubFetch(map[string]*chesstools.OpeningResp{
+		"":      resp(mv("e4", 3, 5, 2), mv("d4", 3, 1, 0), mv("c4", 1, 0, 0)),
+		"1. e4": resp(mv("c5", 1, 4, 2), mv("a6", 2, 1, 0)),
+		"1. d4": resp(mv("Nf6", 3, 1, 0)),
+	})
+	scout.fetchTheory = stubFetch(map[string]*chesstools.OpeningResp{
+		"1. e4": resp(mv("c5", 50, 50, 0), mv("e5", 40, 40, 0), mv("e6", 10, 10, 0)),
+		"1. d4": resp(mv("Nf6", 50, 50, 0), mv("d5", 40, 40, 0)),
+	})
+
+	err = scout.Walk()
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+
+	return scout
+}
+
+func TestWalk(t *testing.T) {
+	scout := newTestScout(t)
+
+	// c4 was played in fewer than --mingames games
+	if len(scout.root.children) != 2 {
+		t.Fatalf("expected 2 first moves but got %v", len(scout.root.children))
+	}
+	e4 := scout.root.children[0]
+	if e4.san != "e4" || len(e4.children) != 2 {
+		t.Fatalf("unexpected e4 node %+v", e4)
+	}
+	if e4.eco != "B00" {
+		t.Fatalf("expected B00 but got %v", e4.eco)
+	}
+	if scout.playerScore(e4) != 0.6 {
+		t.Fatalf("expected black to score 60%% after e4 but got %v",
+			scout.playerScore(e4))
+	}
+}
+
+func TestMaxRequests(t *testing.T) {
+	scout := newTestScout(t)
+	if scout.truncated || scout.requests != 8 {
+		t.Fatalf("expected 8 requests without truncation but got %v (%v)",
+			scout.requests, scout.truncated)
+	}
+
+	// the root's and 1. e4's player and theory requests
+	scout = newTestScoutWithCap(t, 3)
+	if !scout.truncated || scout.requests != 3 {
+		t.Fatalf("expected truncation after 3 requests but got %v (%v)",
+			scout.requests, scout.truncated)
+	}
+	if len(scout.root.children) != 2 {
+		t.Fatalf("expected 2 first moves but got %v", len(scout.root.children))
+	}
+	for _, child := range scout.root.children {
+		expected := 0
+		if child.san == "e4" {
+			expected = 2
+		}
+		if len(child.children) != expected {
+			t.Fatalf("expected %v replies after %v but got %v", expected,
+				child.san, len(child.children))
+		}
+	}
+}
+
+func TestDeviations(t *testing.T) {
+	scout := newTestScout(t)
+
+	devs := scout.deviations()
+	if len(devs) != 1 {
+		t.Fatalf("expected 1 deviation but got %v", len(devs))
+	}
+	if devs[0].moveText() != "1. e4 a6" {
+		t.Fatalf("unexpected deviation %v", devs[0].moveText())
+	}
+	if strings.Join(devs[0].theoryMoves, ",") != "c5,e5,e6" {
+		t.Fatalf("unexpected theory moves %v", devs[0].theoryMoves)
+	}
+}
+
+func TestReportLines(t *testing.T) {
+	scout := newTestScout(t)
+
+	common := scout.mostCommonLines()
+	if len(common) != 3 || common[0].moveText() != "1. e4 c5" {
+		t.Fatalf("unexpected most common lines")
+	}
+	worst := scout.worstLines()
+	if worst[0].moveText() != "1. d4 Nf6" {
+		t.Fatalf("expected 1. d4 Nf6 to score worst but got %v",
+			worst[0].moveText())
+	}
+
+	var buf bytes.Buffer
+	scout.emitReport(&buf)
+	if !strings.Contains(buf.String(), "1. e4 a6 (3 games, someone scores 33%) instead of c5, e5, e6") {
+		t.Fatalf("deviation missing from report:\n%v", buf.String())
+	}
+}
+
+func TestPgn(t *testing.T) {
+	scout := newTestScout(t)
+
+	var buf bytes.Buffer
+	err := scout.emitPgn(&buf)
+	if err != nil {
+		t.Fatalf("emitPgn failed: %v", err)
+	}
+	pgnReader, err := chess.PGN(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("failed to parse emitted pgn: %v\n%v", err, buf.String())
+	}
+	g := chess.NewGame(pgnReader)
+	if len(g.Moves()) != 2 {
+		t.Fatalf("expected a 2 ply main line but got %v", len(g.Moves()))
+	}
+	if len(g.GetRootMove().Children()) != 2 {
+		t.Fatalf("expected 1. d4 as a variation")
+	}
+}
@@ -0,0 +1,572 @@
+/* Utility for summarizing a PGN game collection as an opening tree.
+ * Positions are keyed by normalized FEN so transpositions share statistics,
+ * and every move carries its game count, score by color, and the average
+ * rating of the opponent who had to respond to it.
+ */
+
+package tree
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/corentings/chess/v2"
+	"github.com/mikeb26/chesstools"
+)
+
+type OutputFormat int
+
+const (
+	TextFormat OutputFormat = iota
+	JsonFormat
+	PgnFormat
+)
+
+type TreeOpts struct {
+	maxPly   int
+	minGames int
+	format   OutputFormat
+	pgnFiles []string
+}
+
+type Stats struct {
+	Games     int
+	WhiteWins int
+	BlackWins int
+	Draws     int
+
+	oppEloSum   int
+	oppEloCount int
+}
+
+type TreeNode struct {
+	position    *chess.Position
+	eco         string
+	openingName string
+	edges       []*TreeEdge
+	visited     bool
+
+	// games reaching this position by any move order
+	games int
+}
+
+type TreeEdge struct {
+	san   string
+	uci   string
+	stats Stats
+	child *TreeNode
+}
+
+type Tree struct {
+	opts  *TreeOpts
+	root  *TreeNode
+	stats Stats
+
+	// indexed by normalized FEN
+	nodeMap map[string]*TreeNode
+}
+
+func parseArgs(args []string, opts *TreeOpts) error {
+	f := flag.NewFlagSet("tree", flag.ExitOnError)
+	var formatFlag string
+
+	f.IntVar(&opts.maxPly, "maxply", 16, "<maximum tree depth in plies>")
+	f.IntVar(&opts.minGames, "mingames", 1, "<omit moves played in fewer games>")
+	f.StringVar(&formatFlag, "format", "text", "<text|json|pgn>")
+
+	err := f.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(formatFlag) {
+	case "text":
+		opts.format = TextFormat
+	case "json":
+		opts.format = JsonFormat
+	case "pgn":
+		opts.format = PgnFormat
+	default:
+		return fmt.Errorf("unknown --format %v; please choose text, json, or pgn",
+			formatFlag)
+	}
+	if opts.maxPly < 1 {
+		return fmt.Errorf("--maxply must be at least 1")
+	}
+	if opts.minGames < 1 {
+		return fmt.Errorf("--mingames must be at least 1")
+	}
+
+	opts.pgnFiles = f.Args()
+	if len(opts.pgnFiles) == 0 {
+		return fmt.Errorf("please specify 1 or more PGN files")
+	}
+
+	return nil
+}
+
+func Main(args []string) {
+	var opts TreeOpts
+	err := parseArgs(args, &opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse arguments: %v\n", err)
+		os.Exit(1)
+		return
+	}
+
+	tree := NewTree(&opts)
+	for _, pgnFile := range opts.pgnFiles {
+		f, err := chesstools.OpenPgn(pgnFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		err = tree.processOnePgn(f, pgnFile)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	switch opts.format {
+	case JsonFormat:
+		err = tree.emitJson(os.Stdout)
+	case PgnFormat:
+		err = tree.emitPgn(os.Stdout)
+	default:
+		err = tree.emitText(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func NewTree(optsIn *TreeOpts) *Tree {
+	tree := &Tree{
+		opts:    optsIn,
+		nodeMap: make(map[string]*TreeNode),
+	}
+	tree.root = tree.newNode(chess.StartingPosition())
+
+	return tree
+}
+
+func (tree *Tree) newNode(pos *chess.Position) *TreeNode {
+	node := &TreeNode{
+		position: pos,
+		edges:    make([]*TreeEdge, 0),
+	}
+	fen := pos.XFENString()
+	node.eco = chesstools.GetOpeningEco(fen)
+	node.openingName = chesstools.GetOpeningName(fen)
+
+	normalFen, _ := chesstools.NormalizeFEN(fen)
+	tree.nodeMap[normalFen] = node
+
+	return node
+}
+
+func (tree *Tree) processOnePgn(f io.Reader, pgnName string) error {
+	scanner := chess.NewScanner(f)
+
+	for ii := 1; scanner.HasNext(); ii++ {
+		g, err := scanner.ParseNext()
+		if err != nil {
+			return fmt.Errorf("%v#%v: %w", pgnName, ii, err)
+		}
+		if len(g.Moves()) == 0 {
+			continue
+		}
+		tree.addGame(g)
+	}
+
+	return nil
+}
+
+func getElo(g *chess.Game, tag string) (int, bool) {
+	elo, err := strconv.Atoi(g.GetTagPair(tag))
+	if err != nil || elo <= 0 {
+		return 0, false
+	}
+
+	return elo, true
+}
+
+// the scanner doesn't always set the outcome for draws, so prefer the
+// Result tag
+func getOutcome(g *chess.Game) chess.Outcome {
+	switch g.GetTagPair("Result") {
+	case string(chess.WhiteWon):
+		return chess.WhiteWon
+	case string(chess.BlackWon):
+		return chess.BlackWon
+	case string(chess.Draw):
+		return chess.Draw
+	}
+
+	return g.Outcome()
+}
+
+func (stats *Stats) add(outcome chess.Outcome, oppElo int, haveOppElo bool) {
+	stats.Games++
+	switch outcome {
+	case chess.WhiteWon:
+		stats.WhiteWins++
+	case chess.BlackWon:
+		stats.BlackWins++
+	case chess.Draw:
+		stats.Draws++
+	}
+	if haveOppElo {
+		stats.oppEloSum += oppElo
+		stats.oppEloCount++
+	}
+}
+
+func (tree *Tree) addGame(g *chess.Game) {
+	// games starting from a setup position can't share the tree's root
+	if g.GetTagPair("SetUp") == "1" || g.GetTagPair("FEN") != "" {
+		return
+	}
+
+	whiteElo, haveWhiteElo := getElo(g, "WhiteElo")
+	blackElo, haveBlackElo := getElo(g, "BlackElo")
+	outcome := getOutcome(g)
+
+	tree.stats.add(outcome, 0, false)
+	tree.root.games++
+
+	moves := g.Moves()
+	positions := g.Positions()
+	node := tree.root
+	for ply := 0; ply < len(moves) && ply < tree.opts.maxPly; ply++ {
+		pos := positions[ply]
+		mv := moves[ply]
+
+		// the opponent of the side making the move has to answer it
+		oppElo, haveOppElo := blackElo, haveBlackElo
+		if pos.Turn() == chess.Black {
+			oppElo, haveOppElo = whiteElo, haveWhiteElo
+		}
+
+		edge := node.findEdge(mv.String())
+		if edge == nil {
+			edge = &TreeEdge{
+				san:   chess.AlgebraicNotation{}.Encode(pos, mv),
+				uci:   mv.String(),
+				child: tree.upsertNode(positions[ply+1]),
+			}
+			node.edges = append(node.edges, edge)
+		}
+		edge.stats.add(outcome, oppElo, haveOppElo)
+		node = edge.child
+		node.games++
+	}
+}
+
+func (tree *Tree) upsertNode(pos *chess.Position) *TreeNode {
+	normalFen, _ := chesstools.NormalizeFEN(pos.XFENString())
+	node, ok := tree.nodeMap[normalFen]
+	if ok {
+		return node
+	}
+
+	return tree.newNode(pos)
+}
+
+func (node *TreeNode) findEdge(uci string) *TreeEdge {
+	for _, edge := range node.edges {
+		if edge.uci == uci {
+			return edge
+		}
+	}
+
+	return nil
+}
+
+// sortedEdges returns the node's moves played in at least --mingames games,
+// most popular first
+func (tree *Tree) sortedEdges(node *TreeNode) []*TreeEdge {
+	ret := make([]*TreeEdge, 0, len(node.edges))
+	for _, edge := range node.edges {
+		if edge.stats.Games >= tree.opts.minGames {
+			ret = append(ret, edge)
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].stats.Games != ret[j].stats.Games {
+			return ret[i].stats.Games > ret[j].stats.Games
+		}
+		return ret[i].san < ret[j].san
+	})
+
+	return ret
+}
+
+func (tree *Tree) resetVisited() {
+	for _, node := range tree.nodeMap {
+		node.visited = false
+	}
+}
+
+// scored games exclude unfinished games
+func (stats *Stats) scored() int {
+	return stats.WhiteWins + stats.BlackWins + stats.Draws
+}
+
+func (stats *Stats) WhiteScore() float64 {
+	if stats.scored() == 0 {
+		return 0.0
+	}
+
+	return (float64(stats.WhiteWins) + 0.5*float64(stats.Draws)) /
+		float64(stats.scored())
+}
+
+func (stats *Stats) BlackScore() float64 {
+	if stats.scored() == 0 {
+		return 0.0
+	}
+
+	return 1.0 - stats.WhiteScore()
+}
+
+func (stats *Stats) AvgOpponentElo() int {
+	if stats.oppEloCount == 0 {
+		return 0
+	}
+
+	return stats.oppEloSum / stats.oppEloCount
+}
+
+func moveNumStr(pos *chess.Position, ply int) string {
+	if pos.Turn() == chess.White {
+		return fmt.Sprintf("%v.", ply/2+1)
+	}
+
+	return fmt.Sprintf("%v...", ply/2+1)
+}
+
+func (stats *Stats) scoreString() string {
+	if stats.scored() == 0 {
+		return "White:- Black:-"
+	}
+
+	return fmt.Sprintf("White:%v Black:%v", chesstools.PctS2(stats.WhiteScore()),
+		chesstools.PctS2(stats.BlackScore()))
+}
+
+func gamesString(games int) string {
+	if games == 1 {
+		return "1 game"
+	}
+
+	return fmt.Sprintf("%v games", games)
+}
+
+// String summarizes the games playing a move; nodeGames is the number of
+// games reaching the position it is played from
+func (stats *Stats) String(nodeGames int) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("%v (%v) %v", gamesString(stats.Games),
+		chesstools.PctS(stats.Games, nodeGames), stats.scoreString()))
+	if stats.oppEloCount != 0 {
+		sb.WriteString(fmt.Sprintf(" AvgOpp:%v", stats.AvgOpponentElo()))
+	}
+
+	return sb.String()
+}
+
+func (tree *Tree) emitText(output io.Writer) error {
+	tree.resetVisited()
+
+	fmt.Fprintf(output, "%v %v\n", gamesString(tree.stats.Games),
+		tree.stats.scoreString())
+	tree.emitTextNode(output, tree.root, 0)
+
+	return nil
+}
+
+// a transposed position is only expanded the first time it is reached so
+// move numbers come from the depth of the current line, not the node. a
+// move's share is of every game reaching the position, whichever order of
+// moves they took to get there.
+func (tree *Tree) emitTextNode(output io.Writer, node *TreeNode, ply int) {
+
+	node.visited = true
+	indent := strings.Repeat("  ", ply)
+
+	for _, edge := range tree.sortedEdges(node) {
+		child := edge.child
+		line := fmt.Sprintf("%v%v %v %v", indent,
+			moveNumStr(node.position, ply), edge.san,
+			edge.stats.String(node.games))
+		if child.openingName != "" {
+			line += fmt.Sprintf(" [%v %v]", child.eco, child.openingName)
+		}
+		if child.visited {
+			fmt.Fprintf(output, "%v (transposition)\n", line)
+			continue
+		}
+		fmt.Fprintf(output, "%v\n", line)
+		tree.emitTextNode(output, child, ply+1)
+	}
+}
+
+type jsonNode struct {
+	San            string      `json:"san"`
+	Uci            string      `json:"uci"`
+	FEN            string      `json:"fen"`
+	Games          int         `json:"games"`
+	WhiteWins      int         `json:"whiteWins"`
+	BlackWins      int         `json:"blackWins"`
+	Draws          int         `json:"draws"`
+	WhiteScore     float64     `json:"whiteScore"`
+	BlackScore     float64     `json:"blackScore"`
+	AvgOpponentElo int         `json:"avgOpponentElo,omitempty"`
+	Eco            string      `json:"eco,omitempty"`
+	Opening        string      `json:"opening,omitempty"`
+	Transposition  bool        `json:"transposition,omitempty"`
+	Moves          []*jsonNode `json:"moves,omitempty"`
+}
+
+func (tree *Tree) emitJson(output io.Writer) error {
+	tree.resetVisited()
+
+	root := &jsonNode{
+		FEN:        tree.root.position.XFENString(),
+		Games:      tree.stats.Games,
+		WhiteWins:  tree.stats.WhiteWins,
+		BlackWins:  tree.stats.BlackWins,
+		Draws:      tree.stats.Draws,
+		WhiteScore: tree.stats.WhiteScore(),
+		BlackScore: tree.stats.BlackScore(),
+		Moves:      tree.jsonMoves(tree.root),
+	}
+
+	encoder := json.NewEncoder(output)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(root)
+	if err != nil {
+		return fmt.Errorf("Failed to encode tree: %w", err)
+	}
+
+	return nil
+}
+
+func (tree *Tree) jsonMoves(node *TreeNode) []*jsonNode {
+	node.visited = true
+
+	ret := make([]*jsonNode, 0)
+	for _, edge := range tree.sortedEdges(node) {
+		child := edge.child
+		jn := &jsonNode{
+			San:            edge.san,
+			Uci:            edge.uci,
+			FEN:            child.position.XFENString(),
+			Games:          edge.stats.Games,
+			WhiteWins:      edge.stats.WhiteWins,
+			BlackWins:      edge.stats.BlackWins,
+			Draws:          edge.stats.Draws,
+			WhiteScore:     edge.stats.WhiteScore(),
+			BlackScore:     edge.stats.BlackScore(),
+			AvgOpponentElo: edge.stats.AvgOpponentElo(),
+			Eco:            child.eco,
+			Opening:        child.openingName,
+			Transposition:  child.visited,
+		}
+		if !child.visited {
+			jn.Moves = tree.jsonMoves(child)
+		}
+		ret = append(ret, jn)
+	}
+
+	return ret
+}
+
+func (tree *Tree) emitPgn(output io.Writer) error {
+	tree.resetVisited()
+
+	tags := []chesstools.PgnTag{
+		{Key: "Event", Value: "Opening tree"},
+		{Key: "Site", Value: ""},
+		{Key: "Date", Value: "????.??.??"},
+		{Key: "Round", Value: "-"},
+		{Key: "White", Value: ""},
+		{Key: "Black", Value: ""},
+		{Key: "Result", Value: "*"},
+		{Key: "Annotator", Value: "https://github.com/mikeb26/chesstools"},
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("{ %v %v }", gamesString(tree.stats.Games),
+		tree.stats.scoreString()))
+	tree.pgnMoves(&sb, tree.root, 0)
+
+	pgnWriter := chesstools.NewPgnWriter()
+	err := pgnWriter.WriteTags(output, tags)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(output, "\n")
+	err = pgnWriter.WriteMovetext(output, sb.String(), "*")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(output, "\n")
+
+	return nil
+}
+
+// pgnMoves writes the most popular move as the main line and the rest as
+// variations, each with its statistics in a comment
+func (tree *Tree) pgnMoves(sb *strings.Builder, node *TreeNode, ply int) {
+
+	node.visited = true
+
+	edges := tree.sortedEdges(node)
+	if len(edges) == 0 {
+		return
+	}
+
+	mainEdge := edges[0]
+	tree.pgnMove(sb, node, mainEdge, ply)
+	// claim the main line's position before any variation transposes into it
+	expandMain := !mainEdge.child.visited
+	mainEdge.child.visited = true
+	for _, edge := range edges[1:] {
+		sb.WriteString(" (")
+		tree.pgnMove(sb, node, edge, ply)
+		if !edge.child.visited {
+			tree.pgnMoves(sb, edge.child, ply+1)
+		}
+		sb.WriteString(" )")
+	}
+	if expandMain {
+		tree.pgnMoves(sb, mainEdge.child, ply+1)
+	}
+}
+
+func (tree *Tree) pgnMove(sb *strings.Builder, node *TreeNode,
+	edge *TreeEdge, ply int) {
+
+	sb.WriteString(fmt.Sprintf(" %v %v { %v", moveNumStr(node.position, ply),
+		edge.san, edge.stats.String(node.games)))
+	if edge.child.openingName != "" {
+		sb.WriteString(fmt.Sprintf(" %v %v", edge.child.eco,
+			edge.child.openingName))
+	}
+	if edge.child.visited {
+		sb.WriteString(" (transposition)")
+	}
+	sb.WriteString(" }")
+}
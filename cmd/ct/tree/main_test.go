@@ -0,0 +1,213 @@
+package tree
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/corentings/chess/v2"
+)
+
+const testPgn = `[Event "a"]
+[White "alice"]
+[Black "bob"]
+[WhiteElo "2000"]
+[BlackElo "1800"]
+[Result "1-0"]
+
+1. e4 c5 2. Nf3 d6 1-0
+
+[Event "b"]
+[White "carol"]
+[Black "alice"]
+[WhiteElo "1900"]
+[BlackElo "2100"]
+[Result "1/2-1/2"]
+
+1. e4 e5 2. Nf3 Nc6 1/2-1/2
+
+[Event "c"]
+[White "alice"]
+[Black "dave"]
+[WhiteElo "2000"]
+[BlackElo "2200"]
+[Result "0-1"]
+
+1. Nf3 e5 2. e4 Nc6 0-1
+`
+
+func loadTestTree(t *testing.T, maxPly int) *Tree {
+	opts := TreeOpts{
+		maxPly:   maxPly,
+		minGames: 1,
+	}
+	tree := NewTree(&opts)
+	err := tree.processOnePgn(strings.NewReader(testPgn), "test.pgn")
+	if err != nil {
+		t.Fatalf("processOnePgn failed: %v", err)
+	}
+
+	return tree
+}
+
+func TestTreeStats(t *testing.T) {
+	tree := loadTestTree(t, 16)
+
+	if tree.stats.Games != 3 {
+		t.Fatalf("expected 3 games but got %v", tree.stats.Games)
+	}
+	edges := tree.sortedEdges(tree.root)
+	if len(edges) != 2 || edges[0].san != "e4" || edges[1].san != "Nf3" {
+		t.Fatalf("unexpected first moves %v", edges)
+	}
+	e4 := edges[0]
+	if e4.stats.Games != 2 || e4.stats.WhiteWins != 1 || e4.stats.Draws != 1 {
+		t.Fatalf("unexpected 1. e4 stats %+v", e4.stats)
+	}
+	if e4.stats.WhiteScore() != 0.75 {
+		t.Fatalf("expected white score 0.75 but got %v", e4.stats.WhiteScore())
+	}
+	// black's ratings are the ones facing 1. e4
+	if e4.stats.AvgOpponentElo() != 1950 {
+		t.Fatalf("expected avg opponent elo 1950 but got %v",
+			e4.stats.AvgOpponentElo())
+	}
+	if e4.child.eco != "B00" || e4.child.openingName != "King's Pawn Game" {
+		t.Fatalf("unexpected opening %v %v", e4.child.eco, e4.child.openingName)
+	}
+}
+
+func TestTreeTransposition(t *testing.T) {
+	tree := loadTestTree(t, 16)
+
+	// games b and c reach the same position after 2... Nc6
+	var buf bytes.Buffer
+	err := tree.emitText(&buf)
+	if err != nil {
+		t.Fatalf("emitText failed: %v", err)
+	}
+	if strings.Count(buf.String(), "(transposition)") != 1 {
+		t.Fatalf("expected 1 transposition in:\n%v", buf.String())
+	}
+	if len(tree.nodeMap) != 10 {
+		t.Fatalf("expected 10 unique positions but got %v", len(tree.nodeMap))
+	}
+}
+
+func TestTreeTranspositionShares(t *testing.T) {
+	pgn := `[Event "?"]
+[Result "*"]
+
+1. d4 Nf6 2. c4 e6 3. Nc3 *
+
+[Event "?"]
+[Result "*"]
+
+1. c4 e6 2. d4 Nf6 3. Nf3 *
+
+[Event "?"]
+[Result "*"]
+
+1. c4 e6 2. d4 Nf6 3. Nc3 *
+`
+	opts := TreeOpts{maxPly: 16, minGames: 1}
+	tree := NewTree(&opts)
+	err := tree.processOnePgn(strings.NewReader(pgn), "test.pgn")
+	if err != nil {
+		t.Fatalf("processOnePgn failed: %v", err)
+	}
+
+	// all 3 games reach the position after 2... Nf6, not just the 2 of the
+	// 1. c4 line it is expanded under
+	var buf bytes.Buffer
+	err = tree.emitText(&buf)
+	if err != nil {
+		t.Fatalf("emitText failed: %v", err)
+	}
+	for _, expected := range []string{"3 games", "1. d4 1 game (33%)",
+		"3. Nc3 2 games (66%)", "3. Nf3 1 game (33%)"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Fatalf("expected %v in:\n%v", expected, buf.String())
+		}
+	}
+
+	buf.Reset()
+	err = tree.emitPgn(&buf)
+	if err != nil {
+		t.Fatalf("emitPgn failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "3. Nc3 { 2 games (66%)") {
+		t.Fatalf("unexpected pgn shares:\n%v", buf.String())
+	}
+}
+
+func TestTreeMaxPly(t *testing.T) {
+	tree := loadTestTree(t, 1)
+
+	for _, edge := range tree.root.edges {
+		if len(edge.child.edges) != 0 {
+			t.Fatalf("expected tree to stop after 1 ply")
+		}
+	}
+}
+
+func TestTreeJson(t *testing.T) {
+	tree := loadTestTree(t, 16)
+
+	var buf bytes.Buffer
+	err := tree.emitJson(&buf)
+	if err != nil {
+		t.Fatalf("emitJson failed: %v", err)
+	}
+	var root jsonNode
+	err = json.Unmarshal(buf.Bytes(), &root)
+	if err != nil {
+		t.Fatalf("failed to decode json: %v", err)
+	}
+	if root.Games != 3 || len(root.Moves) != 2 {
+		t.Fatalf("unexpected root %+v", root)
+	}
+	if root.Moves[0].Uci != "e2e4" || root.Moves[0].Games != 2 {
+		t.Fatalf("unexpected first move %+v", root.Moves[0])
+	}
+}
+
+func TestTreePgn(t *testing.T) {
+	tree := loadTestTree(t, 16)
+
+	var buf bytes.Buffer
+	err := tree.emitPgn(&buf)
+	if err != nil {
+		t.Fatalf("emitPgn failed: %v", err)
+	}
+	pgnReader, err := chess.PGN(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("failed to parse emitted pgn: %v\n%v", err, buf.String())
+	}
+	g := chess.NewGame(pgnReader)
+	if len(g.Moves()) != 4 {
+		t.Fatalf("expected a 4 ply main line but got %v", len(g.Moves()))
+	}
+	if len(g.GetRootMove().Children()) != 2 {
+		t.Fatalf("expected 1. Nf3 as a variation")
+	}
+}
+
+func TestTreeGameNumbers(t *testing.T) {
+	pgn := `[Event "empty"]
+[Result "*"]
+
+*
+
+[Event "bad"]
+[Result "*"]
+
+1. e4 e4 *
+`
+	opts := TreeOpts{maxPly: 16, minGames: 1}
+	err := NewTree(&opts).processOnePgn(strings.NewReader(pgn), "test.pgn")
+	if err == nil || !strings.Contains(err.Error(), "test.pgn#2") {
+		t.Fatalf("expected an error for test.pgn#2 but got %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+/* Copyright © 2026 Mike Brown. All Rights Reserved.
+ *
+ * See LICENSE file at the root of this package for license terms
+ */
+package chesstools
+
+import (
+	"fmt"
+
+	"github.com/corentings/chess/v2"
+)
+
+// MoveSource identifies the game a repertoire move was read from
+type MoveSource struct {
+	Move        string
+	Game        *chess.Game
+	GameNum     int
+	PgnFilename string
+}
+
+// MoveConflict is a repertoire position given a different move by a later
+// game than the one that first reached it
+type MoveConflict struct {
+	Existing    MoveSource
+	Conflicting MoveSource
+}
+
+// GameName returns g's Event tag, or ? if it has none
+func GameName(g *chess.Game) string {
+	gn := "?"
+	tagPair := g.GetTagPair("Event")
+	if tagPair != "" {
+		gn = tagPair
+	}
+
+	return gn
+}
+
+func (c MoveConflict) String() string {
+	return fmt.Sprintf("Move %v from game %v(%v#%v) conflicts with move %v from game %v(%v#%v)",
+		c.Conflicting.Move, GameName(c.Conflicting.Game),
+		c.Conflicting.PgnFilename, c.Conflicting.GameNum, c.Existing.Move,
+		GameName(c.Existing.Game), c.Existing.PgnFilename, c.Existing.GameNum)
+}
@@ -0,0 +1,23 @@
+package chesstools
+
+import (
+	"testing"
+
+	"github.com/corentings/chess/v2"
+)
+
+func TestMoveConflictString(t *testing.T) {
+	named := chess.NewGame()
+	named.AddTagPair("Event", "Ruy Lopez")
+	c := MoveConflict{
+		Existing: MoveSource{Move: "Bb5", Game: named, GameNum: 1,
+			PgnFilename: "ours.pgn"},
+		Conflicting: MoveSource{Move: "Bc4", Game: chess.NewGame(), GameNum: 3,
+			PgnFilename: "theirs.pgn"},
+	}
+
+	expected := "Move Bc4 from game ?(theirs.pgn#3) conflicts with move Bb5 from game Ruy Lopez(ours.pgn#1)"
+	if c.String() != expected {
+		t.Fatalf("expected %v but got %v", expected, c.String())
+	}
+}
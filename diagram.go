@@ -0,0 +1,573 @@
+package chesstools
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/corentings/chess/v2"
+)
+
+const DefaultDiagramSize = 360
+
+type PieceSet int
+
+const (
+	// geometric silhouettes which need no fonts
+	SimplePieces PieceSet = iota
+	// chess symbols from the viewer's fonts
+	UnicodePieces
+	// K, Q, R, B, N & P in discs
+	LetterPieces
+)
+
+var pieceSetNames = map[string]PieceSet{
+	"simple":  SimplePieces,
+	"unicode": UnicodePieces,
+	"letters": LetterPieces,
+}
+
+func ParsePieceSet(name string) (PieceSet, error) {
+	pieceSet, ok := pieceSetNames[strings.ToLower(name)]
+	if !ok {
+		return SimplePieces, fmt.Errorf("unknown piece set %v; please choose simple, unicode, or letters",
+			name)
+	}
+
+	return pieceSet, nil
+}
+
+// DiagramTheme holds the colors of a diagram's squares and markup
+type DiagramTheme struct {
+	Light     color.RGBA
+	Dark      color.RGBA
+	Highlight color.RGBA
+	Arrow     color.RGBA
+}
+
+var DiagramThemes = map[string]DiagramTheme{
+	"brown": {
+		Light:     color.RGBA{0xf0, 0xd9, 0xb5, 0xff},
+		Dark:      color.RGBA{0xb5, 0x88, 0x63, 0xff},
+		Highlight: color.RGBA{0x9b, 0xc7, 0x00, 0x69},
+		Arrow:     color.RGBA{0x15, 0x78, 0x1b, 0xcc},
+	},
+	"blue": {
+		Light:     color.RGBA{0xde, 0xe3, 0xe6, 0xff},
+		Dark:      color.RGBA{0x8c, 0xa2, 0xad, 0xff},
+		Highlight: color.RGBA{0x9b, 0xc7, 0x00, 0x69},
+		Arrow:     color.RGBA{0x00, 0x30, 0x88, 0xcc},
+	},
+	"green": {
+		Light:     color.RGBA{0xff, 0xff, 0xdd, 0xff},
+		Dark:      color.RGBA{0x86, 0xa6, 0x66, 0xff},
+		Highlight: color.RGBA{0xff, 0xd0, 0x00, 0x69},
+		Arrow:     color.RGBA{0x88, 0x20, 0x20, 0xcc},
+	},
+	"gray": {
+		Light:     color.RGBA{0xe0, 0xe0, 0xe0, 0xff},
+		Dark:      color.RGBA{0xa0, 0xa0, 0xa0, 0xff},
+		Highlight: color.RGBA{0xff, 0xd0, 0x00, 0x69},
+		Arrow:     color.RGBA{0x15, 0x78, 0x1b, 0xcc},
+	},
+}
+
+const DefaultDiagramTheme = "brown"
+
+// ParseHexColor parses #rrggbb or #rrggbbaa
+func ParseHexColor(hex string) (color.RGBA, error) {
+	var c color.RGBA
+	c.A = 0xff
+
+	var err error
+	switch len(hex) {
+	case 7:
+		_, err = fmt.Sscanf(hex, "#%02x%02x%02x", &c.R, &c.G, &c.B)
+	case 9:
+		_, err = fmt.Sscanf(hex, "#%02x%02x%02x%02x", &c.R, &c.G, &c.B, &c.A)
+	default:
+		err = fmt.Errorf("wrong length")
+	}
+	if err != nil {
+		return c, fmt.Errorf("invalid color %v; expected #rrggbb or #rrggbbaa",
+			hex)
+	}
+
+	return c, nil
+}
+
+func ParseSquare(name string) (chess.Square, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) != 2 || name[0] < 'a' || name[0] > 'h' || name[1] < '1' ||
+		name[1] > '8' {
+		return chess.NoSquare, fmt.Errorf("invalid square %v", name)
+	}
+
+	return chess.NewSquare(chess.File(name[0]-'a'), chess.Rank(name[1]-'1')), nil
+}
+
+type DiagramArrow struct {
+	From chess.Square
+	To   chess.Square
+}
+
+// ParseArrow parses an arrow in UCI form, e.g. e2e4
+func ParseArrow(arrow string) (DiagramArrow, error) {
+	arrow = strings.TrimSpace(arrow)
+	if len(arrow) != 4 {
+		return DiagramArrow{}, fmt.Errorf("invalid arrow %v; expected e.g. e2e4",
+			arrow)
+	}
+	from, err := ParseSquare(arrow[:2])
+	if err != nil {
+		return DiagramArrow{}, err
+	}
+	to, err := ParseSquare(arrow[2:])
+	if err != nil {
+		return DiagramArrow{}, err
+	}
+	if from == to {
+		return DiagramArrow{}, fmt.Errorf("invalid arrow %v; squares must differ",
+			arrow)
+	}
+
+	return DiagramArrow{From: from, To: to}, nil
+}
+
+// Diagram renders a position as a board diagram
+type Diagram struct {
+	pos        *chess.Position
+	size       int
+	flip       bool
+	coords     bool
+	pieceSet   PieceSet
+	theme      DiagramTheme
+	highlights []chess.Square
+	arrows     []DiagramArrow
+	evalBar    bool
+	eval       *EvalResult
+}
+
+func NewDiagram(pos *chess.Position) *Diagram {
+	return &Diagram{
+		pos:        pos,
+		size:       DefaultDiagramSize,
+		flip:       false,
+		coords:     true,
+		pieceSet:   SimplePieces,
+		theme:      DiagramThemes[DefaultDiagramTheme],
+		highlights: make([]chess.Square, 0),
+		arrows:     make([]DiagramArrow, 0),
+	}
+}
+
+// WithSize sets the width and height of the board in pixels
+func (d *Diagram) WithSize(sizeIn int) *Diagram {
+	d.size = sizeIn
+
+	return d
+}
+
+// WithFlip shows the board from black's side
+func (d *Diagram) WithFlip(flipIn bool) *Diagram {
+	d.flip = flipIn
+
+	return d
+}
+
+func (d *Diagram) WithCoordinates(coordsIn bool) *Diagram {
+	d.coords = coordsIn
+
+	return d
+}
+
+func (d *Diagram) WithPieceSet(pieceSetIn PieceSet) *Diagram {
+	d.pieceSet = pieceSetIn
+
+	return d
+}
+
+func (d *Diagram) WithTheme(themeIn DiagramTheme) *Diagram {
+	d.theme = themeIn
+
+	return d
+}
+
+func (d *Diagram) WithHighlights(squares ...chess.Square) *Diagram {
+	d.highlights = append(d.highlights, squares...)
+
+	return d
+}
+
+func (d *Diagram) WithArrows(arrows ...DiagramArrow) *Diagram {
+	d.arrows = append(d.arrows, arrows...)
+
+	return d
+}
+
+// WithEvalBar adds a bar to the right of the board showing er from white's
+// point of view; a nil er shows an even bar
+func (d *Diagram) WithEvalBar(er *EvalResult) *Diagram {
+	d.evalBar = true
+	d.eval = er
+
+	return d
+}
+
+// Width returns the width in pixels including any eval bar
+func (d *Diagram) Width() int {
+	return d.size + d.evalBarWidth()
+}
+
+func (d *Diagram) Height() int {
+	return d.size
+}
+
+func (d *Diagram) evalBarWidth() int {
+	if !d.evalBar {
+		return 0
+	}
+
+	return max(d.size/16, 4)
+}
+
+// whiteShare returns the fraction of the eval bar filled by white; the
+// expected score from a centipawn eval follows lichess' win% curve
+func (d *Diagram) whiteShare() float64 {
+	switch {
+	case d.eval == nil:
+		return 0.5
+	case d.eval.Mate > 0:
+		return 1.0
+	case d.eval.Mate < 0:
+		return 0.0
+	}
+
+	return 1 / (1 + math.Exp(-0.00368208*float64(d.eval.CP)))
+}
+
+// evalBarSplit returns the y coordinate at which the eval bar changes from
+// the top color to the bottom color
+func (d *Diagram) evalBarSplit() float64 {
+	topShare := 1 - d.whiteShare()
+	if d.flip {
+		topShare = d.whiteShare()
+	}
+
+	return math.Round(topShare * float64(d.size))
+}
+
+func (d *Diagram) evalBarColors() (color.RGBA, color.RGBA) {
+	if d.flip {
+		return whitePieceColor, blackPieceColor
+	}
+
+	return blackPieceColor, whitePieceColor
+}
+
+func (d *Diagram) squareSize() float64 {
+	return float64(d.size) / 8
+}
+
+// squareOrigin returns the top left corner of sq
+func (d *Diagram) squareOrigin(sq chess.Square) (float64, float64) {
+	col := int(sq.File())
+	row := 7 - int(sq.Rank())
+	if d.flip {
+		col = 7 - col
+		row = 7 - row
+	}
+
+	return float64(col) * d.squareSize(), float64(row) * d.squareSize()
+}
+
+func (d *Diagram) squareCenter(sq chess.Square) (float64, float64) {
+	x, y := d.squareOrigin(sq)
+
+	return x + d.squareSize()/2, y + d.squareSize()/2
+}
+
+func isLightSquare(sq chess.Square) bool {
+	return (int(sq.File())+int(sq.Rank()))%2 == 1
+}
+
+type diagramPoint struct {
+	x, y float64
+}
+
+// arrowPolygon outlines an arrow from the center of one square to the center
+// of another
+func (d *Diagram) arrowPolygon(arrow DiagramArrow) []diagramPoint {
+	sqSize := d.squareSize()
+	fromX, fromY := d.squareCenter(arrow.From)
+	toX, toY := d.squareCenter(arrow.To)
+
+	length := math.Hypot(toX-fromX, toY-fromY)
+	ux, uy := (toX-fromX)/length, (toY-fromY)/length
+	nx, ny := -uy, ux
+	shaft := sqSize * 0.075
+	head := sqSize * 0.2
+	headLen := math.Min(sqSize*0.4, length)
+	baseX, baseY := toX-ux*headLen, toY-uy*headLen
+
+	return []diagramPoint{
+		{fromX + nx*shaft, fromY + ny*shaft},
+		{baseX + nx*shaft, baseY + ny*shaft},
+		{baseX + nx*head, baseY + ny*head},
+		{toX, toY},
+		{baseX - nx*head, baseY - ny*head},
+		{baseX - nx*shaft, baseY - ny*shaft},
+		{fromX - nx*shaft, fromY - ny*shaft},
+	}
+}
+
+// pieceShape is part of a simple piece drawn in a unit square with y down;
+// either a polygon or, when r > 0, a circle
+type pieceShape struct {
+	points []diagramPoint
+	cx, cy float64
+	r      float64
+}
+
+func polygonShape(coords ...float64) pieceShape {
+	points := make([]diagramPoint, 0, len(coords)/2)
+	for ii := 0; ii+1 < len(coords); ii += 2 {
+		points = append(points, diagramPoint{coords[ii], coords[ii+1]})
+	}
+
+	return pieceShape{points: points}
+}
+
+func circleShape(cx, cy, r float64) pieceShape {
+	return pieceShape{cx: cx, cy: cy, r: r}
+}
+
+var simplePieceShapes = map[chess.PieceType][]pieceShape{
+	chess.Pawn: {
+		polygonShape(0.35, 0.8, 0.65, 0.8, 0.57, 0.45, 0.43, 0.45),
+		circleShape(0.5, 0.36, 0.12),
+		polygonShape(0.26, 0.88, 0.74, 0.88, 0.74, 0.8, 0.26, 0.8),
+	},
+	chess.Knight: {
+		polygonShape(0.28, 0.8, 0.72, 0.8, 0.7, 0.5, 0.62, 0.28, 0.52, 0.2,
+			0.47, 0.12, 0.42, 0.2, 0.3, 0.3, 0.2, 0.46, 0.26, 0.53, 0.34, 0.5,
+			0.44, 0.44, 0.34, 0.62),
+		polygonShape(0.22, 0.88, 0.78, 0.88, 0.78, 0.8, 0.22, 0.8),
+	},
+	chess.Bishop: {
+		polygonShape(0.5, 0.2, 0.62, 0.32, 0.66, 0.45, 0.58, 0.58, 0.62, 0.8,
+			0.38, 0.8, 0.42, 0.58, 0.34, 0.45, 0.38, 0.32),
+		circleShape(0.5, 0.16, 0.05),
+		polygonShape(0.22, 0.88, 0.78, 0.88, 0.78, 0.8, 0.22, 0.8),
+	},
+	chess.Rook: {
+		polygonShape(0.32, 0.8, 0.68, 0.8, 0.65, 0.38, 0.35, 0.38),
+		polygonShape(0.28, 0.38, 0.72, 0.38, 0.72, 0.18, 0.63, 0.18, 0.63,
+			0.25, 0.545, 0.25, 0.545, 0.18, 0.455, 0.18, 0.455, 0.25, 0.37,
+			0.25, 0.37, 0.18, 0.28, 0.18),
+		polygonShape(0.22, 0.88, 0.78, 0.88, 0.78, 0.8, 0.22, 0.8),
+	},
+	chess.Queen: {
+		polygonShape(0.28, 0.8, 0.72, 0.8, 0.8, 0.3, 0.7, 0.55, 0.65, 0.24,
+			0.57, 0.5, 0.5, 0.2, 0.43, 0.5, 0.35, 0.24, 0.3, 0.55, 0.2, 0.3),
+		circleShape(0.2, 0.27, 0.045),
+		circleShape(0.35, 0.21, 0.045),
+		circleShape(0.5, 0.17, 0.045),
+		circleShape(0.65, 0.21, 0.045),
+		circleShape(0.8, 0.27, 0.045),
+		polygonShape(0.22, 0.88, 0.78, 0.88, 0.78, 0.8, 0.22, 0.8),
+	},
+	chess.King: {
+		polygonShape(0.28, 0.8, 0.72, 0.8, 0.77, 0.45, 0.6, 0.38, 0.5, 0.43,
+			0.4, 0.38, 0.23, 0.45),
+		polygonShape(0.46, 0.1, 0.54, 0.1, 0.54, 0.17, 0.61, 0.17, 0.61, 0.24,
+			0.54, 0.24, 0.54, 0.4, 0.46, 0.4, 0.46, 0.24, 0.39, 0.24, 0.39,
+			0.17, 0.46, 0.17),
+		polygonShape(0.22, 0.88, 0.78, 0.88, 0.78, 0.8, 0.22, 0.8),
+	},
+}
+
+var unicodePieces = map[chess.PieceType]string{
+	chess.King:   "♚",
+	chess.Queen:  "♛",
+	chess.Rook:   "♜",
+	chess.Bishop: "♝",
+	chess.Knight: "♞",
+	chess.Pawn:   "♟",
+}
+
+var (
+	whitePieceColor = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	blackPieceColor = color.RGBA{0x22, 0x22, 0x22, 0xff}
+	outlineColor    = color.RGBA{0x00, 0x00, 0x00, 0xff}
+)
+
+func pieceColors(c chess.Color) (color.RGBA, color.RGBA) {
+	if c == chess.White {
+		return whitePieceColor, blackPieceColor
+	}
+
+	return blackPieceColor, whitePieceColor
+}
+
+// svgColor returns a fill or stroke value and its opacity
+func svgColor(c color.RGBA) (string, string) {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B),
+		strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.3f", float64(c.A)/255),
+			"0"), ".")
+}
+
+func svgFill(c color.RGBA) string {
+	hex, opacity := svgColor(c)
+	if c.A == 0xff {
+		return fmt.Sprintf("fill=\"%v\"", hex)
+	}
+
+	return fmt.Sprintf("fill=\"%v\" fill-opacity=\"%v\"", hex, opacity)
+}
+
+func svgNum(val float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", val), "0"),
+		".")
+}
+
+func svgPoints(points []diagramPoint) string {
+	coords := make([]string, 0, len(points))
+	for _, pt := range points {
+		coords = append(coords, svgNum(pt.x)+","+svgNum(pt.y))
+	}
+
+	return strings.Join(coords, " ")
+}
+
+// WriteSVG writes the diagram as a standalone SVG document
+func (d *Diagram) WriteSVG(out io.Writer) error {
+	var sb strings.Builder
+	sqSize := d.squareSize()
+
+	fmt.Fprintf(&sb, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%v\" height=\"%v\" viewBox=\"0 0 %v %v\">\n",
+		d.Width(), d.Height(), d.Width(), d.Height())
+
+	for sqIdx := 0; sqIdx < 64; sqIdx++ {
+		sq := chess.Square(sqIdx)
+		x, y := d.squareOrigin(sq)
+		c := d.theme.Dark
+		if isLightSquare(sq) {
+			c = d.theme.Light
+		}
+		fmt.Fprintf(&sb, "<rect x=\"%v\" y=\"%v\" width=\"%v\" height=\"%v\" %v/>\n",
+			svgNum(x), svgNum(y), svgNum(sqSize), svgNum(sqSize), svgFill(c))
+	}
+	for _, sq := range d.highlights {
+		x, y := d.squareOrigin(sq)
+		fmt.Fprintf(&sb, "<rect x=\"%v\" y=\"%v\" width=\"%v\" height=\"%v\" %v/>\n",
+			svgNum(x), svgNum(y), svgNum(sqSize), svgNum(sqSize),
+			svgFill(d.theme.Highlight))
+	}
+	if d.coords {
+		d.writeSVGCoordinates(&sb)
+	}
+
+	squareMap := d.pos.Board().SquareMap()
+	for sqIdx := 0; sqIdx < 64; sqIdx++ {
+		piece, ok := squareMap[chess.Square(sqIdx)]
+		if !ok || piece == chess.NoPiece {
+			continue
+		}
+		d.writeSVGPiece(&sb, chess.Square(sqIdx), piece)
+	}
+
+	for _, arrow := range d.arrows {
+		fmt.Fprintf(&sb, "<polygon points=\"%v\" %v/>\n",
+			svgPoints(d.arrowPolygon(arrow)), svgFill(d.theme.Arrow))
+	}
+	if d.evalBar {
+		top, bottom := d.evalBarColors()
+		split := d.evalBarSplit()
+		fmt.Fprintf(&sb, "<rect x=\"%v\" y=\"0\" width=\"%v\" height=\"%v\" %v/>\n",
+			d.size, d.evalBarWidth(), svgNum(split), svgFill(top))
+		fmt.Fprintf(&sb, "<rect x=\"%v\" y=\"%v\" width=\"%v\" height=\"%v\" %v/>\n",
+			d.size, svgNum(split), d.evalBarWidth(),
+			svgNum(float64(d.size)-split), svgFill(bottom))
+	}
+	sb.WriteString("</svg>\n")
+
+	_, err := io.WriteString(out, sb.String())
+	return err
+}
+
+// rank numbers along the left edge and file letters along the bottom edge,
+// each in the color of the opposite square
+func (d *Diagram) writeSVGCoordinates(sb *strings.Builder) {
+	sqSize := d.squareSize()
+	fontSize := sqSize * 0.2
+
+	for ii := 0; ii < 8; ii++ {
+		rankSq := chess.NewSquare(chess.FileA, chess.Rank(ii))
+		fileSq := chess.NewSquare(chess.File(ii), chess.Rank1)
+		if d.flip {
+			rankSq = chess.NewSquare(chess.FileH, chess.Rank(ii))
+			fileSq = chess.NewSquare(chess.File(ii), chess.Rank8)
+		}
+
+		x, y := d.squareOrigin(rankSq)
+		fmt.Fprintf(sb, "<text x=\"%v\" y=\"%v\" font-family=\"sans-serif\" font-size=\"%v\" %v>%v</text>\n",
+			svgNum(x+sqSize*0.05), svgNum(y+fontSize), svgNum(fontSize),
+			svgFill(d.coordinateColor(rankSq)), ii+1)
+
+		x, y = d.squareOrigin(fileSq)
+		fmt.Fprintf(sb, "<text x=\"%v\" y=\"%v\" font-family=\"sans-serif\" font-size=\"%v\" text-anchor=\"end\" %v>%c</text>\n",
+			svgNum(x+sqSize*0.95), svgNum(y+sqSize*0.95), svgNum(fontSize),
+			svgFill(d.coordinateColor(fileSq)), 'a'+ii)
+	}
+}
+
+func (d *Diagram) coordinateColor(sq chess.Square) color.RGBA {
+	if isLightSquare(sq) {
+		return d.theme.Dark
+	}
+
+	return d.theme.Light
+}
+
+func (d *Diagram) writeSVGPiece(sb *strings.Builder, sq chess.Square,
+	piece chess.Piece) {
+
+	sqSize := d.squareSize()
+	x, y := d.squareOrigin(sq)
+	fill, contrast := pieceColors(piece.Color())
+	outline, _ := svgColor(outlineColor)
+
+	switch d.pieceSet {
+	case UnicodePieces:
+		fmt.Fprintf(sb, "<text x=\"%v\" y=\"%v\" font-size=\"%v\" text-anchor=\"middle\" %v stroke=\"%v\" stroke-width=\"%v\">%v</text>\n",
+			svgNum(x+sqSize/2), svgNum(y+sqSize*0.82), svgNum(sqSize*0.85),
+			svgFill(fill), outline, svgNum(sqSize*0.02),
+			unicodePieces[piece.Type()])
+	case LetterPieces:
+		fmt.Fprintf(sb, "<circle cx=\"%v\" cy=\"%v\" r=\"%v\" %v stroke=\"%v\" stroke-width=\"%v\"/>\n",
+			svgNum(x+sqSize/2), svgNum(y+sqSize/2), svgNum(sqSize*0.38),
+			svgFill(fill), outline, svgNum(sqSize*0.03))
+		fmt.Fprintf(sb, "<text x=\"%v\" y=\"%v\" font-family=\"sans-serif\" font-weight=\"bold\" font-size=\"%v\" text-anchor=\"middle\" %v>%v</text>\n",
+			svgNum(x+sqSize/2), svgNum(y+sqSize*0.66), svgNum(sqSize*0.45),
+			svgFill(contrast), strings.ToUpper(piece.Type().String()))
+	default:
+		for _, shape := range simplePieceShapes[piece.Type()] {
+			if shape.r > 0 {
+				fmt.Fprintf(sb, "<circle cx=\"%v\" cy=\"%v\" r=\"%v\"",
+					svgNum(x+shape.cx*sqSize), svgNum(y+shape.cy*sqSize),
+					svgNum(shape.r*sqSize))
+			} else {
+				points := make([]diagramPoint, len(shape.points))
+				for ii, pt := range shape.points {
+					points[ii] = diagramPoint{x + pt.x*sqSize, y + pt.y*sqSize}
+				}
+				fmt.Fprintf(sb, "<polygon points=\"%v\"", svgPoints(points))
+			}
+			fmt.Fprintf(sb, " %v stroke=\"%v\" stroke-width=\"%v\" stroke-linejoin=\"round\"/>\n",
+				svgFill(fill), outline, svgNum(sqSize*0.03))
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package chesstools
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/corentings/chess/v2"
+)
+
+// DefaultGIFDelay is the time each frame of an animation is shown in 100ths
+// of a second
+const DefaultGIFDelay = 100
+
+// Image rasterizes the diagram. rasters need no fonts, so unicode pieces are
+// drawn as simple pieces and text uses a built in bitmap font.
+func (d *Diagram) Image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, d.Width(), d.Height()))
+	sqSize := d.squareSize()
+
+	for sqIdx := 0; sqIdx < 64; sqIdx++ {
+		sq := chess.Square(sqIdx)
+		c := d.theme.Dark
+		if isLightSquare(sq) {
+			c = d.theme.Light
+		}
+		x, y := d.squareOrigin(sq)
+		fillRect(img, x, y, sqSize, sqSize, c)
+	}
+	for _, sq := range d.highlights {
+		x, y := d.squareOrigin(sq)
+		fillRect(img, x, y, sqSize, sqSize, d.theme.Highlight)
+	}
+	if d.coords {
+		d.drawCoordinates(img)
+	}
+
+	squareMap := d.pos.Board().SquareMap()
+	for sqIdx := 0; sqIdx < 64; sqIdx++ {
+		piece, ok := squareMap[chess.Square(sqIdx)]
+		if !ok || piece == chess.NoPiece {
+			continue
+		}
+		d.drawPiece(img, chess.Square(sqIdx), piece)
+	}
+
+	for _, arrow := range d.arrows {
+		fillPolygon(img, d.arrowPolygon(arrow), d.theme.Arrow)
+	}
+
+	if d.evalBar {
+		top, bottom := d.evalBarColors()
+		split := d.evalBarSplit()
+		barX := float64(d.size)
+		barWidth := float64(d.evalBarWidth())
+		fillRect(img, barX, 0, barWidth, split, top)
+		fillRect(img, barX, split, barWidth, float64(d.size)-split, bottom)
+	}
+
+	return img
+}
+
+func (d *Diagram) WritePNG(out io.Writer) error {
+	return png.Encode(out, d.Image())
+}
+
+// WriteGIF writes frames as an animated GIF which loops forever, showing each
+// frame for delay 100ths of a second and the last frame for 3 times as long
+func WriteGIF(out io.Writer, frames []*Diagram, delay int) error {
+	if len(frames) == 0 {
+		return fmt.Errorf("cannot write a GIF without frames")
+	}
+
+	images := make([]*image.RGBA, 0, len(frames))
+	for _, frame := range frames {
+		images = append(images, frame.Image())
+	}
+	pal, exact := gifPalette(images)
+
+	anim := gif.GIF{
+		Image:     make([]*image.Paletted, 0, len(images)),
+		Delay:     make([]int, 0, len(images)),
+		LoopCount: 0,
+	}
+	for ii, img := range images {
+		paletted := image.NewPaletted(img.Bounds(), pal)
+		if exact {
+			draw.Draw(paletted, img.Bounds(), img, image.Point{}, draw.Src)
+		} else {
+			draw.FloydSteinberg.Draw(paletted, img.Bounds(), img, image.Point{})
+		}
+		anim.Image = append(anim.Image, paletted)
+		if ii == len(images)-1 {
+			anim.Delay = append(anim.Delay, delay*3)
+		} else {
+			anim.Delay = append(anim.Delay, delay)
+		}
+	}
+
+	return gif.EncodeAll(out, &anim)
+}
+
+// gifPalette returns the exact colors of images when there are at most 256
+// of them, which is the norm as diagrams are drawn without anti-aliasing;
+// otherwise a general purpose palette for dithering
+func gifPalette(images []*image.RGBA) (color.Palette, bool) {
+	seen := make(map[color.RGBA]bool)
+	colors := make([]color.RGBA, 0)
+	for _, img := range images {
+		for ii := 0; ii+3 < len(img.Pix); ii += 4 {
+			c := color.RGBA{img.Pix[ii], img.Pix[ii+1], img.Pix[ii+2],
+				img.Pix[ii+3]}
+			if seen[c] {
+				continue
+			}
+			if len(colors) == 256 {
+				return palette.Plan9, false
+			}
+			seen[c] = true
+			colors = append(colors, c)
+		}
+	}
+	// deterministic output for identical input
+	sort.Slice(colors, func(i, j int) bool {
+		ci, cj := colors[i], colors[j]
+		return uint32(ci.R)<<24|uint32(ci.G)<<16|uint32(ci.B)<<8|uint32(ci.A) <
+			uint32(cj.R)<<24|uint32(cj.G)<<16|uint32(cj.B)<<8|uint32(cj.A)
+	})
+
+	pal := make(color.Palette, 0, len(colors))
+	for _, c := range colors {
+		pal = append(pal, c)
+	}
+
+	return pal, true
+}
+
+func (d *Diagram) drawCoordinates(img *image.RGBA) {
+	sqSize := d.squareSize()
+	scale := max(1, int(sqSize*0.2/bitmapGlyphHeight))
+	margin := sqSize * 0.05
+
+	for ii := 0; ii < 8; ii++ {
+		rankSq := chess.NewSquare(chess.FileA, chess.Rank(ii))
+		fileSq := chess.NewSquare(chess.File(ii), chess.Rank1)
+		if d.flip {
+			rankSq = chess.NewSquare(chess.FileH, chess.Rank(ii))
+			fileSq = chess.NewSquare(chess.File(ii), chess.Rank8)
+		}
+
+		x, y := d.squareOrigin(rankSq)
+		drawText(img, string(rune('1'+ii)), int(x+margin), int(y+margin), scale,
+			d.coordinateColor(rankSq))
+
+		x, y = d.squareOrigin(fileSq)
+		label := string(rune('a' + ii))
+		drawText(img, label, int(x+sqSize-margin)-textWidth(label, scale),
+			int(y+sqSize-margin)-bitmapGlyphHeight*scale, scale,
+			d.coordinateColor(fileSq))
+	}
+}
+
+func (d *Diagram) drawPiece(img *image.RGBA, sq chess.Square,
+	piece chess.Piece) {
+
+	sqSize := d.squareSize()
+	x, y := d.squareOrigin(sq)
+	fill, contrast := pieceColors(piece.Color())
+	stroke := math.Max(1, sqSize*0.03)
+
+	if d.pieceSet == LetterPieces {
+		cx, cy, r := x+sqSize/2, y+sqSize/2, sqSize*0.38
+		fillCircle(img, cx, cy, r, outlineColor)
+		fillCircle(img, cx, cy, r-stroke, fill)
+		label := strings.ToUpper(piece.Type().String())
+		scale := max(1, int(sqSize*0.45/bitmapGlyphHeight))
+		drawText(img, label, int(cx)-textWidth(label, scale)/2,
+			int(cy)-bitmapGlyphHeight*scale/2, scale, contrast)
+		return
+	}
+
+	for _, shape := range simplePieceShapes[piece.Type()] {
+		if shape.r > 0 {
+			cx, cy, r := x+shape.cx*sqSize, y+shape.cy*sqSize, shape.r*sqSize
+			fillCircle(img, cx, cy, r+stroke/2, outlineColor)
+			fillCircle(img, cx, cy, r-stroke/2, fill)
+			continue
+		}
+		points := make([]diagramPoint, len(shape.points))
+		for ii, pt := range shape.points {
+			points[ii] = diagramPoint{x + pt.x*sqSize, y + pt.y*sqSize}
+		}
+		fillPolygon(img, points, fill)
+		strokePolygon(img, points, stroke, outlineColor)
+	}
+}
+
+// blendPixel composites c over the pixel at x, y
+func blendPixel(img *image.RGBA, x, y int, c color.RGBA) {
+	if !(image.Point{x, y}.In(img.Rect)) {
+		return
+	}
+	off := img.PixOffset(x, y)
+	if c.A == 0xff {
+		img.Pix[off], img.Pix[off+1], img.Pix[off+2], img.Pix[off+3] =
+			c.R, c.G, c.B, c.A
+		return
+	}
+	alpha := uint32(c.A)
+	blend := func(dst, src uint8) uint8 {
+		return uint8((uint32(src)*alpha + uint32(dst)*(0xff-alpha) + 0x7f) / 0xff)
+	}
+	img.Pix[off] = blend(img.Pix[off], c.R)
+	img.Pix[off+1] = blend(img.Pix[off+1], c.G)
+	img.Pix[off+2] = blend(img.Pix[off+2], c.B)
+	img.Pix[off+3] = 0xff
+}
+
+// the fill functions cover the pixels whose centers lie inside the shape
+func fillRect(img *image.RGBA, x, y, w, h float64, c color.RGBA) {
+	for py := int(math.Round(y)); py < int(math.Round(y+h)); py++ {
+		for px := int(math.Round(x)); px < int(math.Round(x+w)); px++ {
+			blendPixel(img, px, py, c)
+		}
+	}
+}
+
+func fillCircle(img *image.RGBA, cx, cy, r float64, c color.RGBA) {
+	if r <= 0 {
+		return
+	}
+	for py := int(math.Floor(cy - r)); py <= int(math.Ceil(cy+r)); py++ {
+		for px := int(math.Floor(cx - r)); px <= int(math.Ceil(cx+r)); px++ {
+			if math.Hypot(float64(px)+0.5-cx, float64(py)+0.5-cy) <= r {
+				blendPixel(img, px, py, c)
+			}
+		}
+	}
+}
+
+// fillPolygon fills points using the even-odd rule
+func fillPolygon(img *image.RGBA, points []diagramPoint, c color.RGBA) {
+	if len(points) < 3 {
+		return
+	}
+	minY, maxY := points[0].y, points[0].y
+	for _, pt := range points {
+		minY = math.Min(minY, pt.y)
+		maxY = math.Max(maxY, pt.y)
+	}
+
+	crossings := make([]float64, 0, len(points))
+	for py := int(math.Floor(minY)); py <= int(math.Ceil(maxY)); py++ {
+		scanY := float64(py) + 0.5
+		crossings = crossings[:0]
+		for ii := range points {
+			a, b := points[ii], points[(ii+1)%len(points)]
+			if (a.y <= scanY) == (b.y <= scanY) {
+				continue
+			}
+			crossings = append(crossings,
+				a.x+(scanY-a.y)*(b.x-a.x)/(b.y-a.y))
+		}
+		sort.Float64s(crossings)
+		for ii := 0; ii+1 < len(crossings); ii += 2 {
+			startX := int(math.Ceil(crossings[ii] - 0.5))
+			endX := int(math.Floor(crossings[ii+1] - 0.5))
+			for px := startX; px <= endX; px++ {
+				blendPixel(img, px, py, c)
+			}
+		}
+	}
+}
+
+// strokePolygon outlines points with round joins
+func strokePolygon(img *image.RGBA, points []diagramPoint, width float64,
+	c color.RGBA) {
+
+	half := width / 2
+	for ii := range points {
+		a, b := points[ii], points[(ii+1)%len(points)]
+		length := math.Hypot(b.x-a.x, b.y-a.y)
+		if length == 0 {
+			continue
+		}
+		nx, ny := -(b.y-a.y)/length*half, (b.x-a.x)/length*half
+		fillPolygon(img, []diagramPoint{
+			{a.x + nx, a.y + ny}, {b.x + nx, b.y + ny},
+			{b.x - nx, b.y - ny}, {a.x - nx, a.y - ny},
+		}, c)
+		fillCircle(img, a.x, a.y, half, c)
+	}
+}
+
+const (
+	bitmapGlyphWidth  = 5
+	bitmapGlyphHeight = 7
+)
+
+// just the characters diagrams need: coordinates and piece letters
+var bitmapGlyphs = map[rune][bitmapGlyphHeight]string{
+	'a': {".....", ".....", ".###.", "....#", ".####", "#...#", ".####"},
+	'b': {"#....", "#....", "####.", "#...#", "#...#", "#...#", "####."},
+	'c': {".....", ".....", ".###.", "#....", "#....", "#....", ".###."},
+	'd': {"....#", "....#", ".####", "#...#", "#...#", "#...#", ".####"},
+	'e': {".....", ".....", ".###.", "#...#", "#####", "#....", ".###."},
+	'f': {"..##.", ".#...", "####.", ".#...", ".#...", ".#...", ".#..."},
+	'g': {".....", ".####", "#...#", "#...#", ".####", "....#", ".###."},
+	'h': {"#....", "#....", "####.", "#...#", "#...#", "#...#", "#...#"},
+	'1': {"..#..", ".##..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'2': {".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####"},
+	'3': {"####.", "....#", "....#", ".###.", "....#", "....#", "####."},
+	'4': {"...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#."},
+	'5': {"#####", "#....", "####.", "....#", "....#", "#...#", ".###."},
+	'6': {".###.", "#....", "#....", "####.", "#...#", "#...#", ".###."},
+	'7': {"#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..."},
+	'8': {".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###."},
+	'B': {"####.", "#...#", "#...#", "####.", "#...#", "#...#", "####."},
+	'K': {"#...#", "#..#.", "#.#..", "##...", "#.#..", "#..#.", "#...#"},
+	'N': {"#...#", "##..#", "#.#.#", "#..##", "#...#", "#...#", "#...#"},
+	'P': {"####.", "#...#", "#...#", "####.", "#....", "#....", "#...."},
+	'Q': {".###.", "#...#", "#...#", "#...#", "#.#.#", "#..#.", ".##.#"},
+	'R': {"####.", "#...#", "#...#", "####.", "#.#..", "#..#.", "#...#"},
+}
+
+func textWidth(text string, scale int) int {
+	n := len([]rune(text))
+	if n == 0 {
+		return 0
+	}
+
+	return (n*(bitmapGlyphWidth+1) - 1) * scale
+}
+
+// drawText draws text with its top left corner at x, y
+func drawText(img *image.RGBA, text string, x, y, scale int, c color.RGBA) {
+	for _, r := range text {
+		glyph, ok := bitmapGlyphs[r]
+		if ok {
+			for row, bits := range glyph {
+				for col, bit := range bits {
+					if bit != '#' {
+						continue
+					}
+					for dy := 0; dy < scale; dy++ {
+						for dx := 0; dx < scale; dx++ {
+							blendPixel(img, x+col*scale+dx, y+row*scale+dy, c)
+						}
+					}
+				}
+			}
+		}
+		x += (bitmapGlyphWidth + 1) * scale
+	}
+}
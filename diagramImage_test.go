@@ -0,0 +1,84 @@
+package chesstools
+
+import (
+	"bytes"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+
+	"github.com/corentings/chess/v2"
+)
+
+func TestDiagramImage(t *testing.T) {
+	pos := chess.StartingPosition()
+	d := NewDiagram(pos).WithSize(160).WithCoordinates(false).
+		WithEvalBar(&EvalResult{Mate: 3})
+	img := d.Image()
+	if img.Bounds().Dx() != 170 || img.Bounds().Dy() != 160 {
+		t.Fatalf("unexpected bounds %v", img.Bounds())
+	}
+
+	theme := DiagramThemes[DefaultDiagramTheme]
+	// a3 is dark and d3 is light; both are empty
+	if img.RGBAAt(2, 101) != theme.Dark || img.RGBAAt(61, 101) != theme.Light {
+		t.Fatalf("unexpected square colors %v %v", img.RGBAAt(2, 101),
+			img.RGBAAt(61, 101))
+	}
+	// white is mating so the eval bar is all white
+	if img.RGBAAt(165, 2) != whitePieceColor {
+		t.Fatalf("unexpected eval bar color %v", img.RGBAAt(165, 2))
+	}
+	// the middle of the e1 king's body
+	if img.RGBAAt(90, 152) != whitePieceColor {
+		t.Fatalf("expected a white king on e1 but got %v", img.RGBAAt(90, 152))
+	}
+
+	var buf bytes.Buffer
+	err := d.WritePNG(&buf)
+	if err != nil {
+		t.Fatalf("WritePNG failed: %v", err)
+	}
+	decoded, err := png.Decode(&buf)
+	if err != nil || decoded.Bounds() != img.Bounds() {
+		t.Fatalf("failed to decode png: %v", err)
+	}
+}
+
+func TestWriteGIF(t *testing.T) {
+	g := chess.NewGame()
+	frames := []*Diagram{NewDiagram(g.Position()).WithSize(80)}
+	for _, mv := range []string{"e4", "e5"} {
+		err := g.PushMove(mv, nil)
+		if err != nil {
+			t.Fatalf("failed to push %v: %v", mv, err)
+		}
+		last := g.Moves()[len(g.Moves())-1]
+		frames = append(frames, NewDiagram(g.Position()).WithSize(80).
+			WithHighlights(last.S1(), last.S2()))
+	}
+
+	var buf bytes.Buffer
+	err := WriteGIF(&buf, frames, 50)
+	if err != nil {
+		t.Fatalf("WriteGIF failed: %v", err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatalf("failed to decode gif: %v", err)
+	}
+	if len(anim.Image) != 3 || anim.Delay[0] != 50 || anim.Delay[2] != 150 {
+		t.Fatalf("unexpected animation frames:%v delays:%v", len(anim.Image),
+			anim.Delay)
+	}
+	// colors are reproduced exactly rather than dithered
+	theme := DiagramThemes[DefaultDiagramTheme]
+	if color.RGBAModel.Convert(anim.Image[0].At(2, 52)) != theme.Dark {
+		t.Fatalf("unexpected a3 color %v", anim.Image[0].At(2, 52))
+	}
+
+	err = WriteGIF(&buf, nil, 50)
+	if err == nil {
+		t.Fatalf("expected an error without frames")
+	}
+}
@@ -0,0 +1,106 @@
+package chesstools
+
+import (
+	"encoding/xml"
+	"image/color"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/corentings/chess/v2"
+)
+
+func TestParseDiagramArgs(t *testing.T) {
+	c, err := ParseHexColor("#15781bcc")
+	if err != nil || c != (color.RGBA{0x15, 0x78, 0x1b, 0xcc}) {
+		t.Fatalf("unexpected color %v err:%v", c, err)
+	}
+	c, err = ParseHexColor("#f0d9b5")
+	if err != nil || c != (color.RGBA{0xf0, 0xd9, 0xb5, 0xff}) {
+		t.Fatalf("unexpected color %v err:%v", c, err)
+	}
+	_, err = ParseHexColor("f0d9b5")
+	if err == nil {
+		t.Fatalf("expected an error without #")
+	}
+
+	arrow, err := ParseArrow("g1f3")
+	if err != nil || arrow.From != chess.G1 || arrow.To != chess.F3 {
+		t.Fatalf("unexpected arrow %v err:%v", arrow, err)
+	}
+	for _, bad := range []string{"e2", "e2e9", "i1e4", "e4e4"} {
+		_, err = ParseArrow(bad)
+		if err == nil {
+			t.Fatalf("expected an error parsing arrow %v", bad)
+		}
+	}
+
+	_, err = ParsePieceSet("unicode")
+	if err != nil {
+		t.Fatalf("ParsePieceSet failed: %v", err)
+	}
+	_, err = ParsePieceSet("staunton")
+	if err == nil {
+		t.Fatalf("expected an error for an unknown piece set")
+	}
+}
+
+func countSVGElements(t *testing.T, svg string) map[string]int {
+	counts := make(map[string]int)
+	decoder := xml.NewDecoder(strings.NewReader(svg))
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid svg: %v\n%v", err, svg)
+		}
+		start, ok := tok.(xml.StartElement)
+		if ok {
+			counts[start.Name.Local]++
+		}
+	}
+
+	return counts
+}
+
+func TestDiagramSVG(t *testing.T) {
+	pos := chess.StartingPosition()
+
+	var sb strings.Builder
+	err := NewDiagram(pos).WriteSVG(&sb)
+	if err != nil {
+		t.Fatalf("WriteSVG failed: %v", err)
+	}
+	counts := countSVGElements(t, sb.String())
+	if counts["svg"] != 1 || counts["rect"] != 64 || counts["text"] != 16 {
+		t.Fatalf("unexpected elements %v", counts)
+	}
+	// a1 is dark and at the bottom left
+	if !strings.Contains(sb.String(),
+		"<rect x=\"0\" y=\"315\" width=\"45\" height=\"45\" fill=\"#b58863\"/>") {
+		t.Fatalf("unexpected a1:\n%v", sb.String())
+	}
+
+	sb.Reset()
+	err = NewDiagram(pos).WithFlip(true).WithCoordinates(false).
+		WithPieceSet(LetterPieces).WithHighlights(chess.E2, chess.E4).
+		WithArrows(DiagramArrow{From: chess.E2, To: chess.E4}).WriteSVG(&sb)
+	if err != nil {
+		t.Fatalf("WriteSVG failed: %v", err)
+	}
+	counts = countSVGElements(t, sb.String())
+	if counts["rect"] != 66 || counts["polygon"] != 1 || counts["circle"] != 32 ||
+		counts["text"] != 32 {
+		t.Fatalf("unexpected elements %v", counts)
+	}
+	// flipped, a1 is at the top right
+	if !strings.Contains(sb.String(),
+		"<rect x=\"315\" y=\"0\" width=\"45\" height=\"45\" fill=\"#b58863\"/>") {
+		t.Fatalf("unexpected flipped a1:\n%v", sb.String())
+	}
+	if !strings.Contains(sb.String(), "fill=\"#15781b\" fill-opacity=\"0.8\"") {
+		t.Fatalf("expected a translucent arrow:\n%v", sb.String())
+	}
+}
@@ -0,0 +1,257 @@
+/* Generator for the embedded opening table.
+ *
+ * Parses the lichess chess-openings tables (a.tsv through e.tsv) along with
+ * extra_fen.tsv, computes each opening's FEN, normalized FEN and Polyglot
+ * hash, and emits them as a Go table so the chesstools package does not
+ * need to parse anything at startup. Invoked via go generate from the
+ * repository root.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/corentings/chess/v2"
+	"github.com/mikeb26/chesstools"
+)
+
+var lichessTables = []string{"a.tsv", "b.tsv", "c.tsv", "d.tsv", "e.tsv"}
+
+const ExtraTable = "extra_fen.tsv"
+
+type openingRow struct {
+	eco          string
+	name         string
+	moves        string
+	fen          string
+	normalFen    string
+	polyglotHash uint64
+	source       string
+}
+
+type tableBuilder struct {
+	rows        []*openingRow
+	byFen       map[string]*openingRow
+	byNormalFen map[string]*openingRow
+	dupCount    int
+}
+
+func main() {
+	var dir string
+	var out string
+
+	f := flag.NewFlagSet("ecogen", flag.ExitOnError)
+	f.StringVar(&dir, "dir", "eco", "<directory containing opening tsv files>")
+	f.StringVar(&out, "out", "openings_table.go", "<generated go file>")
+	f.Parse(os.Args[1:])
+
+	tb := &tableBuilder{
+		rows:        make([]*openingRow, 0),
+		byFen:       make(map[string]*openingRow),
+		byNormalFen: make(map[string]*openingRow),
+	}
+
+	for _, table := range lichessTables {
+		err := tb.loadLichessTable(filepath.Join(dir, table))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ecogen: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	err := tb.loadExtraTable(filepath.Join(dir, ExtraTable))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ecogen: %v\n", err)
+		os.Exit(1)
+	}
+
+	src, err := tb.generate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ecogen: %v\n", err)
+		os.Exit(1)
+	}
+	err = os.WriteFile(out, src, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ecogen: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "ecogen: wrote %v openings to %v (%v duplicates skipped)\n",
+		len(tb.rows), out, tb.dupCount)
+}
+
+func readTsv(filename string, sep string, numFields int,
+	rowFunc func(fields []string, source string) error) error {
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, sep)
+		if len(fields) != numFields {
+			return fmt.Errorf("%v:%v expecting %v fields but found %v",
+				filename, lineNum, numFields, len(fields))
+		}
+		err = rowFunc(fields, fmt.Sprintf("%v:%v", filename, lineNum))
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// lichess tables are eco<TAB>name<TAB>pgn with a header row
+func (tb *tableBuilder) loadLichessTable(filename string) error {
+	return readTsv(filename, "\t", 3, func(fields []string, source string) error {
+		if fields[0] == "eco" {
+			return nil
+		}
+
+		pgnReader, err := chess.PGN(strings.NewReader(fields[2]))
+		if err != nil {
+			return fmt.Errorf("%v failed to parse '%v': %w", source, fields[2],
+				err)
+		}
+		g := chess.NewGame(pgnReader)
+
+		row := &openingRow{
+			eco:    fields[0],
+			name:   fields[1],
+			moves:  fields[2],
+			source: source,
+		}
+		err = row.setPosition(g.Position())
+		if err != nil {
+			return err
+		}
+
+		existing, ok := tb.byFen[row.fen]
+		if ok {
+			if existing.eco == row.eco && existing.name == row.name {
+				tb.dupCount++
+				return nil
+			}
+			return fmt.Errorf("%v %v (%v) conflicts with %v %v (%v) for fen %v",
+				source, row.eco, row.name, existing.source, existing.eco,
+				existing.name, row.fen)
+		}
+		existing, ok = tb.byNormalFen[row.normalFen]
+		if ok && (existing.eco != row.eco || existing.name != row.name) {
+			return fmt.Errorf("%v %v (%v) conflicts with %v %v (%v) for normalized fen %v",
+				source, row.eco, row.name, existing.source, existing.eco,
+				existing.name, row.normalFen)
+		}
+
+		tb.add(row)
+		return nil
+	})
+}
+
+// extra_fen.tsv is fen;eco;name with no header row. it supplements
+// the lichess tables and deliberately renames some of their positions, so
+// an extra row replaces any lichess row for the same position while
+// keeping that row's moves.
+func (tb *tableBuilder) loadExtraTable(filename string) error {
+	return readTsv(filename, ";", 3, func(fields []string, source string) error {
+		fenArgs, err := chess.FEN(fields[0])
+		if err != nil {
+			return fmt.Errorf("%v invalid fen '%v': %w", source, fields[0], err)
+		}
+
+		row := &openingRow{
+			eco:    fields[1],
+			name:   fields[2],
+			moves:  "",
+			source: source,
+		}
+		err = row.setPosition(chess.NewGame(fenArgs).Position())
+		if err != nil {
+			return err
+		}
+		if row.fen != fields[0] {
+			return fmt.Errorf("%v fen '%v' is not in canonical form '%v'",
+				source, fields[0], row.fen)
+		}
+
+		existing, ok := tb.byFen[row.fen]
+		if !ok {
+			existing, ok = tb.byNormalFen[row.normalFen]
+			if ok && existing.fen != row.fen {
+				// a transposition with different move counters; keep both
+				ok = false
+			}
+		}
+		if !ok {
+			tb.add(row)
+			return nil
+		}
+		if existing.eco == row.eco && existing.name == row.name {
+			tb.dupCount++
+			return nil
+		}
+
+		fmt.Fprintf(os.Stderr, "ecogen: %v renames %v %v (%v) to %v %v\n",
+			source, existing.source, existing.eco, existing.name, row.eco,
+			row.name)
+		existing.eco = row.eco
+		existing.name = row.name
+		existing.source = row.source
+
+		return nil
+	})
+}
+
+func (row *openingRow) setPosition(pos *chess.Position) error {
+	row.fen = pos.XFENString()
+	row.polyglotHash = pos.ZobristHash()
+
+	normalFen, err := chesstools.NormalizeFEN(row.fen)
+	if err != nil {
+		return fmt.Errorf("%v: %w", row.source, err)
+	}
+	row.normalFen = normalFen
+
+	return nil
+}
+
+func (tb *tableBuilder) add(row *openingRow) {
+	tb.rows = append(tb.rows, row)
+	tb.byFen[row.fen] = row
+	if _, ok := tb.byNormalFen[row.normalFen]; !ok {
+		tb.byNormalFen[row.normalFen] = row
+	}
+}
+
+func (tb *tableBuilder) generate() ([]byte, error) {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// Code generated by eco/gen from eco/*.tsv; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package chesstools\n\n")
+	fmt.Fprintf(&buf, "// eco, name, moves, fen, normalized fen, polyglot hash\n")
+	fmt.Fprintf(&buf, "var openingTable = [...]Opening{\n")
+	for _, row := range tb.rows {
+		fmt.Fprintf(&buf, "\t{%q, %q, %q, %q, %q, 0x%016x},\n", row.eco,
+			row.name, row.moves, row.fen, row.normalFen, row.polyglotHash)
+	}
+	fmt.Fprintf(&buf, "}\n")
+
+	return format.Source(buf.Bytes())
+}
@@ -104,6 +104,9 @@ type EvalCtx struct {
 	doLazyInit    bool
 	atime         bool
 	cacheFileDir  string
+	multiPV       int  // default == 1
+	chess960      bool // default == false
+	noEngine      bool
 
 	engine     *uci.Engine
 	engVersion float64
@@ -136,12 +139,10 @@ func NewEvalCtx(cacheOnlyIn bool) *EvalCtx {
 	rv.doLazyInit = false
 	rv.atime = true
 	rv.cacheFileDir = defaultCacheFileDir()
-
-	var err error
-	rv.engine, err = uci.New("stockfish")
-	if err != nil {
-		log.Fatal("Unable to initialize stockfish")
-	}
+	rv.multiPV = 1
+	rv.chess960 = false
+	rv.noEngine = false
+	rv.engine = nil
 
 	return rv
 }
@@ -157,6 +158,13 @@ func (evalCtx *EvalCtx) WithCacheOnly() *EvalCtx {
 	return evalCtx
 }
 
+// WithoutEngine only consults the caches, so stockfish need not be
+// installed; it implies WithCacheOnly()
+func (evalCtx *EvalCtx) WithoutEngine() *EvalCtx {
+	evalCtx.noEngine = true
+	return evalCtx.WithCacheOnly()
+}
+
 func (evalCtx *EvalCtx) WithStaleOk(staleOkIn bool) *EvalCtx {
 	evalCtx.staleOk = staleOkIn
 	return evalCtx
@@ -207,6 +215,18 @@ func (evalCtx *EvalCtx) WithoutAtime() *EvalCtx {
 	return evalCtx
 }
 
+// WithMultiPV sets how many of the best moves EvalMultiPV() scores
+func (evalCtx *EvalCtx) WithMultiPV(numPVs int) *EvalCtx {
+	evalCtx.multiPV = max(numPVs, 1)
+	return evalCtx
+}
+
+// WithChess960 tells the engine that castling follows Chess960 rules
+func (evalCtx *EvalCtx) WithChess960(chess960 bool) *EvalCtx {
+	evalCtx.chess960 = chess960
+	return evalCtx
+}
+
 func (evalCtx *EvalCtx) GetPosition() string {
 	return evalCtx.position.String()
 }
@@ -239,6 +259,9 @@ func (evalCtx *EvalCtx) InitEngine() {
 		evalCtx.position = p[halfMoveIndex]
 	}
 
+	if evalCtx.noEngine {
+		return
+	}
 	evalCtx.earlyInitEngine()
 
 	// actual init is deferred until first use as it is exensive and unneeded
@@ -252,9 +275,16 @@ func renice(pid int) error {
 	return cmd.Run()
 }
 
-// just renice and grab the version; full init occurs in lazyInitEngine()
+// just start, renice, and grab the version; full init occurs in
+// lazyInitEngine()
 func (evalCtx *EvalCtx) earlyInitEngine() {
-	err := renice(evalCtx.engine.Getpid())
+	var err error
+	evalCtx.engine, err = uci.New("stockfish")
+	if err != nil {
+		log.Fatal("Unable to initialize stockfish")
+	}
+
+	err = renice(evalCtx.engine.Getpid())
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -277,11 +307,13 @@ func (evalCtx *EvalCtx) earlyInitEngine() {
 }
 
 func (evalCtx *EvalCtx) lazyInitEngine() {
-	//	err := evalCtx.engine.Run(uci.CmdSetOption{Name: "UCI_Chess960",
-	//		Value: "true"})
-	//	if err != nil {
-	//		log.Fatal(err)
-	//	}
+	if evalCtx.chess960 {
+		err := evalCtx.engine.Run(uci.CmdSetOption{Name: "UCI_Chess960",
+			Value: "true"})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 	err := evalCtx.engine.Run(uci.CmdSetOption{Name: "UCI_ShowWDL",
 		Value: "true"})
 	if err != nil {
@@ -303,9 +335,15 @@ func (evalCtx *EvalCtx) lazyInitEngine() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	//err = evalCtx.engine.Run(uci.CmdSetOption{Name: "MultiPV", Value: "5"})
+	if evalCtx.multiPV > 1 {
+		err = evalCtx.engine.Run(uci.CmdSetOption{Name: "MultiPV",
+			Value: strconv.Itoa(evalCtx.multiPV)})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	err = evalCtx.engine.Run(uci.CmdPosition{Position: evalCtx.position})
+	err = evalCtx.engine.Run(cmdPositionFEN{fen: evalCtx.positionFEN()})
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -313,15 +351,42 @@ func (evalCtx *EvalCtx) lazyInitEngine() {
 	evalCtx.doLazyInit = false
 }
 
+// positionFEN is the FEN of the current position given to the engine and
+// used for cache lookups; unlike position.XFENString() it keeps castling
+// rights the chess package cannot play, e.g. in Chess960
+func (evalCtx *EvalCtx) positionFEN() string {
+	if evalCtx.fen == "" {
+		return evalCtx.position.XFENString()
+	}
+
+	return castlingFEN(evalCtx.position, evalCtx.fen)
+}
+
+// cmdPositionFEN is uci.CmdPosition for a FEN rather than a chess.Position
+type cmdPositionFEN struct {
+	fen string
+}
+
+func (cmd cmdPositionFEN) String() string {
+	return "position fen " + cmd.fen
+}
+
+func (cmdPositionFEN) ProcessResponse(*uci.Engine) error {
+	return nil
+}
+
 func (evalCtx *EvalCtx) SetFEN(fen string) *EvalCtx {
 	evalCtx.fen = fen
-	fenCheck, err := chess.FEN(fen)
+	fenCheck, err := LoadFEN(fen)
 	if err != nil {
 		log.Fatal(err)
 	}
 	evalCtx.g = chess.NewGame(fenCheck)
 	evalCtx.position = evalCtx.g.Position()
-	err = evalCtx.engine.Run(uci.CmdPosition{Position: evalCtx.position})
+	if evalCtx.engine == nil {
+		return evalCtx
+	}
+	err = evalCtx.engine.Run(cmdPositionFEN{fen: evalCtx.positionFEN()})
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -334,7 +399,7 @@ func (evalCtx *EvalCtx) loadPgnOrFEN() *chess.Game {
 		evalCtx.fen = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
 	}
 	if evalCtx.fen != "" {
-		fen, err := chess.FEN(evalCtx.fen)
+		fen, err := LoadFEN(evalCtx.fen)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -366,7 +431,7 @@ func (evalCtx *EvalCtx) loadPgnOrFEN() *chess.Game {
 func (evalCtx *EvalCtx) loadResultFromLocalCache(
 	staleOk bool) (*EvalResult, error) {
 
-	fen := evalCtx.position.XFENString()
+	fen := evalCtx.positionFEN()
 	var err error
 	fen, err = NormalizeFEN(fen)
 	if err != nil {
@@ -378,7 +443,7 @@ func (evalCtx *EvalCtx) loadResultFromLocalCache(
 
 	encodedResult, err := ioutil.ReadFile(cacheFileFullName)
 	if os.IsNotExist(err) {
-		fen = evalCtx.position.XFENString()
+		fen = evalCtx.positionFEN()
 		cacheFileName = fen2CacheFileName(fen)
 		cacheFilePath = evalCtx.fen2CacheFilePath(fen)
 		cacheFileFullName = filepath.Join(cacheFilePath, cacheFileName)
@@ -397,7 +462,7 @@ func (evalCtx *EvalCtx) loadResultFromLocalCache(
 		log.Fatal(err)
 	}
 
-	if evalCtx.engVersion == UnknownEngVer {
+	if evalCtx.engVersion == UnknownEngVer && !evalCtx.noEngine {
 		log.Fatal("Unknown current engine version")
 	}
 
@@ -444,14 +509,19 @@ func (evalCtx *EvalCtx) loadResultFromCloudCache(
 	}
 	const BaseUrl = "https://lichess.org/api/cloud-eval"
 
-	fen := evalCtx.position.XFENString()
+	fen := evalCtx.positionFEN()
 	var err error
 	fen, err = NormalizeFEN(fen)
 	if err != nil {
 		return nil, err
 	}
 	position := url.QueryEscape(fen)
-	queryParams := fmt.Sprintf("?fen=%v&multiPv=1&variant=standard", position)
+	variant := StandardVariant
+	if evalCtx.chess960 {
+		variant = Chess960Variant
+	}
+	queryParams := fmt.Sprintf("?fen=%v&multiPv=1&variant=%v", position,
+		variant)
 	requestURL, err := url.Parse(BaseUrl + queryParams)
 	if err != nil {
 		return nil, fmt.Errorf("eval: failed to parse url:%w", err)
@@ -589,7 +659,7 @@ func (evalCtx *EvalCtx) loadResultFromCache(
 }
 
 func (evalCtx *EvalCtx) persistResultToCache(er *EvalResult) {
-	fen := evalCtx.position.XFENString()
+	fen := evalCtx.positionFEN()
 	var err error
 	fen, err = NormalizeFEN(fen)
 	if err != nil {
@@ -728,7 +798,7 @@ func (evalCtx *EvalCtx) Eval() *EvalResult {
 	lossPct, _ := results.Info.Score.LossPct()
 	drawPct, _ := results.Info.Score.DrawPct()
 
-	fen := evalCtx.position.XFENString()
+	fen := evalCtx.positionFEN()
 	fen, err = NormalizeFEN(fen)
 	if err != nil {
 		log.Fatal(err)
@@ -761,6 +831,89 @@ func (evalCtx *EvalCtx) Eval() *EvalResult {
 	return er
 }
 
+// PVResult is 1 line of a multi-PV search. like EvalResult, CP and Mate are
+// from white's perspective.
+type PVResult struct {
+	CP    int
+	Mate  int
+	Depth int
+	Moves []string // SAN, starting with the move the line recommends
+}
+
+// EvalMultiPV scores the best WithMultiPV() moves of the current position,
+// best first. unlike Eval() it always searches with the engine and its
+// results are not cached.
+func (evalCtx *EvalCtx) EvalMultiPV() []*PVResult {
+	if evalCtx.doLazyInit {
+		evalCtx.lazyInitEngine()
+	}
+
+	fmt.Fprintf(os.Stderr, "eval: scoring %v lines of position:%v\n",
+		evalCtx.multiPV, evalCtx.position)
+
+	var err error
+	if evalCtx.evalDepth != DefaultDepth {
+		err = evalCtx.engine.Run(uci.CmdGo{Depth: evalCtx.evalDepth})
+	} else {
+		err = evalCtx.engine.Run(uci.CmdGo{MoveTime: time.Second *
+			time.Duration(evalCtx.evalTimeInSec)})
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	results := evalCtx.engine.SearchResults()
+	ret := make([]*PVResult, 0, len(results.MultiPVInfo))
+	for _, info := range results.MultiPVInfo {
+		moves := pvSANs(evalCtx.position, info.PV, evalCtx.chess960)
+		if len(moves) == 0 {
+			continue
+		}
+		pv := &PVResult{
+			CP:    info.Score.CP,
+			Mate:  info.Score.Mate,
+			Depth: info.Depth,
+			Moves: moves,
+		}
+		if evalCtx.position.Turn() == chess.Black {
+			pv.CP = -pv.CP
+			pv.Mate = -pv.Mate
+		}
+		ret = append(ret, pv)
+	}
+
+	return ret
+}
+
+// pvSANs converts an engine's principal variation to SAN. it stops at the
+// first move which is not legal for the chess package. with UCI_Chess960 on
+// the engine writes castling as the king capturing its rook, so a move which
+// matches one of the package's castles is some other move, e.g. a rook from
+// e1 to g1, and ends the line too.
+func pvSANs(pos *chess.Position, pv []*chess.Move, chess960 bool) []string {
+	ret := make([]string, 0, len(pv))
+	algNotation := chess.AlgebraicNotation{}
+	for _, mv := range pv {
+		validMoves := pos.ValidMoves()
+		idx := slices.IndexFunc(validMoves, func(valid chess.Move) bool {
+			return valid.S1() == mv.S1() && valid.S2() == mv.S2() &&
+				valid.Promo() == mv.Promo()
+		})
+		if idx < 0 {
+			break
+		}
+		valid := validMoves[idx]
+		if chess960 && (valid.HasTag(chess.KingSideCastle) ||
+			valid.HasTag(chess.QueenSideCastle)) {
+			break
+		}
+		ret = append(ret, algNotation.Encode(pos, &valid))
+		pos = pos.Update(&valid)
+	}
+
+	return ret
+}
+
 type cachedEvalEntryList struct {
 	entries []string
 }
@@ -0,0 +1,88 @@
+package chesstools
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/corentings/chess/v2"
+)
+
+func TestPvSANs(t *testing.T) {
+	fenOpt, err := chess.FEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	if err != nil {
+		t.Fatalf("FEN failed: %v", err)
+	}
+	pos := chess.NewGame(fenOpt).Position()
+
+	// engines report moves as bare squares, e.g. e8h8 for Chess960 castling
+	pv := make([]*chess.Move, 0)
+	for _, uciMove := range []string{"e2e4", "e7e5", "g1f3", "e8h8"} {
+		mv, err := chess.UCINotation{}.Decode(nil, uciMove)
+		if err != nil {
+			t.Fatalf("Decode(%v) failed: %v", uciMove, err)
+		}
+		pv = append(pv, mv)
+	}
+
+	sans := pvSANs(pos, pv, true)
+	if !slices.Equal(sans, []string{"e4", "e5", "Nf3"}) {
+		t.Fatalf("unexpected SANs %v", sans)
+	}
+
+	// e1g1 is a castle to the chess package but not to a Chess960 engine
+	fenOpt, err = LoadFEN("r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1")
+	if err != nil {
+		t.Fatalf("LoadFEN failed: %v", err)
+	}
+	pos = chess.NewGame(fenOpt).Position()
+	mv, err := chess.UCINotation{}.Decode(nil, "e1g1")
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	sans = pvSANs(pos, []*chess.Move{mv}, false)
+	if !slices.Equal(sans, []string{"O-O"}) {
+		t.Fatalf("unexpected SANs %v", sans)
+	}
+	sans = pvSANs(pos, []*chess.Move{mv}, true)
+	if len(sans) != 0 {
+		t.Fatalf("expected no SANs with Chess960 castling but got %v", sans)
+	}
+}
+
+func TestEvalWithoutEngine(t *testing.T) {
+	fen := "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1"
+	evalCtx := NewEvalCtx(true).WithoutEngine().WithFEN(fen).
+		WithoutCloudCache().WithoutAtime()
+	defer evalCtx.Close()
+	evalCtx.cacheFileDir = t.TempDir()
+	evalCtx.InitEngine()
+	if evalCtx.engine != nil {
+		t.Fatalf("expected no engine")
+	}
+
+	if er := evalCtx.Eval(); er != nil {
+		t.Fatalf("expected a cache miss but got %v", er)
+	}
+	evalCtx.persistResultToCache(&EvalResult{CP: 30, Depth: 20,
+		EngVersion: 16})
+	er := evalCtx.SetFEN(fen).Eval()
+	if er == nil || er.CP != 30 {
+		t.Fatalf("expected the cached eval but got %v", er)
+	}
+}
+
+func TestPositionFENChess960(t *testing.T) {
+	fen := "bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1"
+	evalCtx := NewEvalCtx(true).WithoutEngine().WithFEN(fen).WithChess960(true)
+	defer evalCtx.Close()
+	evalCtx.InitEngine()
+
+	// the engine and caches see the rights the chess package cannot play
+	if evalCtx.positionFEN() != fen {
+		t.Fatalf("expected %v but got %v", fen, evalCtx.positionFEN())
+	}
+	if cmd := (cmdPositionFEN{fen: evalCtx.positionFEN()}).String(); cmd !=
+		"position fen "+fen {
+		t.Fatalf("unexpected position command %v", cmd)
+	}
+}
@@ -0,0 +1,694 @@
+package chesstools
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/corentings/chess/v2"
+)
+
+type FENField int
+
+const (
+	FENPlacementField FENField = iota
+	FENSideToMoveField
+	FENCastlingField
+	FENEnPassantField
+	FENHalfmoveField
+	FENFullmoveField
+
+	FENNoField // the issue concerns the FEN as a whole
+)
+
+var fenFieldNames = []string{"placement", "side to move", "castling",
+	"en passant", "halfmove clock", "fullmove number", "fen"}
+
+func (field FENField) String() string {
+	if field < FENPlacementField || field > FENNoField {
+		return "invalid"
+	}
+
+	return fenFieldNames[field]
+}
+
+type FENIssueCode int
+
+const (
+	FENFieldCount FENIssueCode = iota
+	FENBadPlacement
+	FENBadSideToMove
+	FENBadCastling
+	FENCastlingMismatch
+	FENBadEnPassant
+	FENBadHalfmove
+	FENBadFullmove
+	FENKingCount
+	FENPawnOnBackRank
+	FENTooManyPieces
+	FENOpponentInCheck
+)
+
+type FENSeverity int
+
+const (
+	FENError FENSeverity = iota
+	// legal but unusual, e.g. castling rights out of the usual KQkq order
+	FENWarning
+)
+
+func (severity FENSeverity) String() string {
+	if severity == FENWarning {
+		return "warning"
+	}
+
+	return "error"
+}
+
+// FENIssue is one problem found by ValidateFEN
+type FENIssue struct {
+	Code     FENIssueCode
+	Severity FENSeverity
+	Field    FENField
+	Message  string
+}
+
+func (issue FENIssue) String() string {
+	return fmt.Sprintf("%v: %v: %v", issue.Severity, issue.Field, issue.Message)
+}
+
+// HasFENErrors returns whether issues includes anything worse than a warning
+func HasFENErrors(issues []FENIssue) bool {
+	for _, issue := range issues {
+		if issue.Severity == FENError {
+			return true
+		}
+	}
+
+	return false
+}
+
+// explainedFENError describes a FEN parse error by ValidateFEN's issues
+// rather than by the parse error, which only repeats them, while keeping
+// the parse error available to errors.Is and errors.As
+type explainedFENError struct {
+	msg string
+	err error
+}
+
+func (e *explainedFENError) Error() string {
+	return e.msg
+}
+
+func (e *explainedFENError) Unwrap() error {
+	return e.err
+}
+
+// ExplainFENError replaces the message of err, an error from parsing fen,
+// with the errors ValidateFEN finds in fen when there are any; err remains
+// reachable via errors.Is and errors.As
+func ExplainFENError(fen string, err error) error {
+	explanations := make([]string, 0)
+	for _, issue := range ValidateFEN(fen) {
+		if issue.Severity == FENError {
+			explanations = append(explanations,
+				fmt.Sprintf("%v: %v", issue.Field, issue.Message))
+		}
+	}
+	if len(explanations) == 0 {
+		return err
+	}
+
+	return &explainedFENError{
+		msg: fmt.Sprintf("invalid FEN %q: %v", fen,
+			strings.Join(explanations, "; ")),
+		err: err,
+	}
+}
+
+// fenBoard holds a piece placement as FEN letters indexed by chess.Square,
+// with 0 for empty squares
+type fenBoard [64]byte
+
+func (b *fenBoard) at(file, rank int) byte {
+	if file < 0 || file > 7 || rank < 0 || rank > 7 {
+		return 0
+	}
+
+	return b[rank*8+file]
+}
+
+func pieceOwner(piece byte) chess.Color {
+	switch {
+	case piece >= 'A' && piece <= 'Z':
+		return chess.White
+	case piece >= 'a' && piece <= 'z':
+		return chess.Black
+	}
+
+	return chess.NoColor
+}
+
+// pieceLetter returns the FEN letter for a piece type of the given color
+func pieceLetter(pieceType byte, c chess.Color) byte {
+	if c == chess.White {
+		return pieceType - 'a' + 'A'
+	}
+
+	return pieceType
+}
+
+var pieceNames = map[byte]string{
+	'p': "pawn", 'n': "knight", 'b': "bishop", 'r': "rook", 'q': "queen",
+	'k': "king",
+}
+
+func pieceName(piece byte) string {
+	return pieceNames[strings.ToLower(string(piece))[0]]
+}
+
+func colorName(c chess.Color) string {
+	return strings.ToLower(c.Name())
+}
+
+func squareName(file, rank int) string {
+	return chess.NewSquare(chess.File(file), chess.Rank(rank)).String()
+}
+
+type fenValidation struct {
+	issues []FENIssue
+}
+
+func (v *fenValidation) add(code FENIssueCode, severity FENSeverity,
+	field FENField, format string, args ...any) {
+
+	v.issues = append(v.issues, FENIssue{Code: code, Severity: severity,
+		Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// ValidateFEN returns every problem it finds with fen, or no issues for a
+// legal position. unlike chess.FEN it keeps going after the first problem
+// and also reports placements which cannot arise in a game.
+func ValidateFEN(fen string) []FENIssue {
+	v := &fenValidation{issues: make([]FENIssue, 0)}
+
+	fields := strings.Fields(fen)
+	if len(fields) != 6 {
+		v.add(FENFieldCount, FENError, FENNoField,
+			"expected 6 space separated fields but found %v", len(fields))
+	}
+	field := func(idx FENField) (string, bool) {
+		if int(idx) < len(fields) {
+			return fields[idx], true
+		}
+		return "", false
+	}
+
+	var board *fenBoard
+	placement, ok := field(FENPlacementField)
+	if ok {
+		board = v.checkPlacement(placement)
+	}
+	turn := chess.NoColor
+	side, ok := field(FENSideToMoveField)
+	if ok {
+		switch side {
+		case "w":
+			turn = chess.White
+		case "b":
+			turn = chess.Black
+		default:
+			v.add(FENBadSideToMove, FENError, FENSideToMoveField,
+				"%q is neither w nor b", side)
+		}
+	}
+	castling, ok := field(FENCastlingField)
+	if ok {
+		v.checkCastling(castling, board)
+	}
+	enPassant, hasEnPassant := field(FENEnPassantField)
+	if hasEnPassant {
+		v.checkEnPassant(enPassant, turn, board)
+	}
+	halfmove, ok := field(FENHalfmoveField)
+	if ok {
+		clock, err := strconv.Atoi(halfmove)
+		if err != nil || clock < 0 {
+			v.add(FENBadHalfmove, FENError, FENHalfmoveField,
+				"%q is not a non-negative number", halfmove)
+		} else if clock != 0 && hasEnPassant && enPassant != "-" {
+			v.add(FENBadHalfmove, FENWarning, FENHalfmoveField,
+				"%v should be 0 right after the pawn move allowing en passant",
+				clock)
+		}
+	}
+	fullmove, ok := field(FENFullmoveField)
+	if ok {
+		moveNum, err := strconv.Atoi(fullmove)
+		if err != nil || moveNum < 1 {
+			v.add(FENBadFullmove, FENError, FENFullmoveField,
+				"%q is not a positive number", fullmove)
+		}
+	}
+
+	if board != nil && turn != chess.NoColor {
+		v.checkOpponentInCheck(board, turn)
+	}
+
+	return v.issues
+}
+
+// checkPlacement returns the parsed board when placement is well formed and
+// reports its problems
+func (v *fenValidation) checkPlacement(placement string) *fenBoard {
+	ranks := strings.Split(placement, "/")
+	if len(ranks) != 8 {
+		v.add(FENBadPlacement, FENError, FENPlacementField,
+			"expected 8 ranks separated by / but found %v", len(ranks))
+		return nil
+	}
+
+	var board fenBoard
+	wellFormed := true
+	for ii, rankStr := range ranks {
+		rank := 7 - ii
+		file := 0
+		for _, ch := range []byte(rankStr) {
+			switch {
+			case ch >= '1' && ch <= '8':
+				file += int(ch - '0')
+			case strings.IndexByte("pnbrqkPNBRQK", ch) >= 0:
+				if file < 8 {
+					board[rank*8+file] = ch
+				}
+				file++
+			default:
+				v.add(FENBadPlacement, FENError, FENPlacementField,
+					"rank %v has invalid character %q", rank+1, ch)
+				wellFormed = false
+			}
+		}
+		if file != 8 {
+			v.add(FENBadPlacement, FENError, FENPlacementField,
+				"rank %v (%q) describes %v squares instead of 8", rank+1, rankStr,
+				file)
+			wellFormed = false
+		}
+	}
+	if !wellFormed {
+		return nil
+	}
+
+	v.checkPieces(&board)
+
+	return &board
+}
+
+func (v *fenValidation) checkPieces(board *fenBoard) {
+	counts := make(map[byte]int)
+	for sq, piece := range board {
+		if piece == 0 {
+			continue
+		}
+		counts[piece]++
+		rank := sq / 8
+		if (piece == 'P' || piece == 'p') && (rank == 0 || rank == 7) {
+			v.add(FENPawnOnBackRank, FENError, FENPlacementField,
+				"%v pawn on %v", colorName(pieceOwner(piece)), squareName(sq%8, rank))
+		}
+	}
+
+	for _, c := range []chess.Color{chess.White, chess.Black} {
+		kings := counts[pieceLetter('k', c)]
+		if kings != 1 {
+			v.add(FENKingCount, FENError, FENPlacementField,
+				"%v has %v kings instead of 1", colorName(c), kings)
+		}
+
+		total := 0
+		for _, pieceType := range []byte("pnbrqk") {
+			total += counts[pieceLetter(pieceType, c)]
+		}
+		if total > 16 {
+			v.add(FENTooManyPieces, FENError, FENPlacementField,
+				"%v has %v pieces; at most 16 are possible", colorName(c), total)
+		}
+		pawns := counts[pieceLetter('p', c)]
+		if pawns > 8 {
+			v.add(FENTooManyPieces, FENError, FENPlacementField,
+				"%v has %v pawns; at most 8 are possible", colorName(c), pawns)
+			continue
+		}
+		// every piece beyond the starting set must be a promoted pawn
+		promoted := max(0, counts[pieceLetter('q', c)]-1) +
+			max(0, counts[pieceLetter('r', c)]-2) +
+			max(0, counts[pieceLetter('b', c)]-2) +
+			max(0, counts[pieceLetter('n', c)]-2)
+		if promoted > 8-pawns {
+			v.add(FENTooManyPieces, FENError, FENPlacementField,
+				"%v has %v promoted pieces but only %v pawns are missing",
+				colorName(c), promoted, 8-pawns)
+		}
+	}
+}
+
+// checkCastling accepts standard FEN, X-FEN, and Shredder-FEN castling fields
+func (v *fenValidation) checkCastling(castling string, board *fenBoard) {
+	if castling == "-" {
+		return
+	}
+
+	seen := make(map[byte]bool)
+	for _, ch := range []byte(castling) {
+		if !isCastlingLetter(ch) {
+			v.add(FENBadCastling, FENError, FENCastlingField,
+				"%q is not one of K, Q, k, q, A-H, a-h, or -", ch)
+			return
+		}
+		if seen[ch] {
+			v.add(FENBadCastling, FENError, FENCastlingField,
+				"%q is listed more than once", ch)
+			return
+		}
+		seen[ch] = true
+	}
+	if board == nil {
+		if !strings.ContainsAny(castling, castlingFiles) &&
+			castling != canonicalCastling(seen) {
+
+			v.add(FENBadCastling, FENWarning, FENCastlingField,
+				"%v is conventionally written %v", castling, canonicalCastling(seen))
+		}
+		return
+	}
+
+	rights := make([]castlingRight, 0)
+	mismatch := false
+	for _, ch := range []byte(castling) {
+		right, err := resolveCastlingRight(ch, board)
+		if err != nil {
+			v.add(FENCastlingMismatch, FENError, FENCastlingField, "%v", err)
+			mismatch = true
+			continue
+		}
+		if hasCastlingSide(rights, right) {
+			v.add(FENBadCastling, FENError, FENCastlingField,
+				"%v lists %v %v castling more than once", castling,
+				colorName(right.color), castlingSide(right.kingside))
+			return
+		}
+		rights = append(rights, right)
+	}
+	if mismatch {
+		return
+	}
+	conventional := formatCastling(rights, board, castlingNotationOf(castling))
+	if castling != conventional {
+		v.add(FENBadCastling, FENWarning, FENCastlingField,
+			"%v is conventionally written %v", castling, conventional)
+	}
+}
+
+func canonicalCastling(rights map[byte]bool) string {
+	ret := ""
+	for _, right := range []byte("KQkq") {
+		if rights[right] {
+			ret += string(right)
+		}
+	}
+	if ret == "" {
+		return "-"
+	}
+
+	return ret
+}
+
+// an en passant square is behind a pawn which has just advanced 2 squares, so
+// the square itself and the pawn's starting square must be empty
+func (v *fenValidation) checkEnPassant(enPassant string, turn chess.Color,
+	board *fenBoard) {
+
+	if enPassant == "-" {
+		return
+	}
+	if len(enPassant) != 2 || enPassant[0] < 'a' || enPassant[0] > 'h' ||
+		enPassant[1] < '1' || enPassant[1] > '8' {
+
+		v.add(FENBadEnPassant, FENError, FENEnPassantField,
+			"%q is neither a square nor -", enPassant)
+		return
+	}
+	file, rank := int(enPassant[0]-'a'), int(enPassant[1]-'1')
+	if rank != 2 && rank != 5 {
+		v.add(FENBadEnPassant, FENError, FENEnPassantField,
+			"%v is not on the 3rd or 6th rank", enPassant)
+		return
+	}
+	if turn == chess.NoColor {
+		return
+	}
+	wantRank, pawnRank, fromRank := 5, 4, 6
+	mover := chess.Black
+	if turn == chess.Black {
+		wantRank, pawnRank, fromRank = 2, 3, 1
+		mover = chess.White
+	}
+	if rank != wantRank {
+		v.add(FENBadEnPassant, FENError, FENEnPassantField,
+			"%v cannot be the en passant square with %v to move", enPassant,
+			colorName(turn))
+		return
+	}
+	if board == nil {
+		return
+	}
+	if board.at(file, pawnRank) != pieceLetter('p', mover) {
+		v.add(FENBadEnPassant, FENError, FENEnPassantField,
+			"%v requires a %v pawn on %v", enPassant, colorName(mover),
+			squareName(file, pawnRank))
+	}
+	for _, r := range []int{rank, fromRank} {
+		if board.at(file, r) != 0 {
+			v.add(FENBadEnPassant, FENError, FENEnPassantField,
+				"%v requires %v to be empty", enPassant, squareName(file, r))
+		}
+	}
+}
+
+func (v *fenValidation) checkOpponentInCheck(board *fenBoard,
+	turn chess.Color) {
+
+	opponent := turn.Other()
+	for sq, piece := range board {
+		if piece != pieceLetter('k', opponent) {
+			continue
+		}
+		attackerSq, ok := board.attacker(sq%8, sq/8, turn)
+		if ok {
+			v.add(FENOpponentInCheck, FENError, FENNoField,
+				"%v is to move but %v is in check from the %v on %v",
+				colorName(turn), colorName(opponent), pieceName(board[attackerSq]),
+				chess.Square(attackerSq))
+		}
+	}
+}
+
+var knightOffsets = [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2},
+	{-2, -1}, {-2, 1}, {-1, 2}}
+var kingOffsets = [][2]int{{1, 1}, {1, 0}, {1, -1}, {0, -1}, {-1, -1},
+	{-1, 0}, {-1, 1}, {0, 1}}
+
+// attacker returns the square of a piece of color c attacking file, rank
+func (b *fenBoard) attacker(file, rank int, c chess.Color) (int, bool) {
+	pawnRank := rank - 1
+	if c == chess.Black {
+		pawnRank = rank + 1
+	}
+	for _, df := range []int{-1, 1} {
+		if b.at(file+df, pawnRank) == pieceLetter('p', c) {
+			return pawnRank*8 + file + df, true
+		}
+	}
+	for _, offsets := range []struct {
+		deltas    [][2]int
+		pieceType byte
+	}{{knightOffsets, 'n'}, {kingOffsets, 'k'}} {
+		for _, d := range offsets.deltas {
+			if b.at(file+d[0], rank+d[1]) == pieceLetter(offsets.pieceType, c) {
+				return (rank+d[1])*8 + file + d[0], true
+			}
+		}
+	}
+	for ii, d := range kingOffsets {
+		// diagonals are the even entries of kingOffsets
+		slider := byte('r')
+		if ii%2 == 0 {
+			slider = 'b'
+		}
+		f, r := file+d[0], rank+d[1]
+		for f >= 0 && f <= 7 && r >= 0 && r <= 7 {
+			piece := b.at(f, r)
+			if piece != 0 {
+				if piece == pieceLetter(slider, c) || piece == pieceLetter('q', c) {
+					return r*8 + f, true
+				}
+				break
+			}
+			f, r = f+d[0], r+d[1]
+		}
+	}
+
+	return 0, false
+}
+
+// FENRepair is one change RepairFEN made
+type FENRepair struct {
+	Field FENField
+	// a missing field was filled in rather than a present one fixed; e.g.
+	// castling rights taken from the piece placement may grant rights the
+	// position does not actually have
+	Assumed     bool
+	Description string
+}
+
+func (repair FENRepair) String() string {
+	if repair.Assumed {
+		return "assumed " + repair.Description
+	}
+
+	return repair.Description
+}
+
+// RepairFEN fixes common mistakes in fen: missing or malformed trailing
+// fields, upper case side to move, castling rights unsupported by the piece
+// placement or out of order, and impossible en passant squares. it returns
+// the repaired FEN along with each repair, or an error when problems it
+// cannot fix remain. missing fields are filled in and reported as assumed.
+func RepairFEN(fen string) (string, []FENRepair, error) {
+	repairs := make([]FENRepair, 0)
+	repaired := func(field FENField, format string, args ...any) {
+		repairs = append(repairs, FENRepair{Field: field,
+			Description: fmt.Sprintf(format, args...)})
+	}
+	assumed := func(field FENField, format string, args ...any) {
+		repairs = append(repairs, FENRepair{Field: field, Assumed: true,
+			Description: fmt.Sprintf(format, args...)})
+	}
+	fields := strings.Fields(fen)
+	if len(fields) == 0 {
+		return "", repairs, fmt.Errorf("empty FEN")
+	}
+	if len(fields) > 6 {
+		repaired(FENNoField, "dropped %v extra fields", len(fields)-6)
+		fields = fields[:6]
+	}
+	v := &fenValidation{issues: make([]FENIssue, 0)}
+	board := v.checkPlacement(fields[0])
+
+	if len(fields) < 2 {
+		fields = append(fields, "w")
+		assumed(FENSideToMoveField, "white to move")
+	} else if fields[1] == "W" || fields[1] == "B" {
+		repaired(FENSideToMoveField, "side to move %v -> %v", fields[1],
+			strings.ToLower(fields[1]))
+		fields[1] = strings.ToLower(fields[1])
+	}
+
+	if len(fields) < 3 {
+		fields = append(fields, "")
+	}
+	castling := repairCastling(fields[2], board)
+	if castling != fields[2] {
+		if fields[2] == "" {
+			assumed(FENCastlingField, "castling rights %v from the piece placement",
+				castling)
+		} else {
+			repaired(FENCastlingField, "castling rights %v -> %v", fields[2],
+				castling)
+		}
+		fields[2] = castling
+	}
+
+	if len(fields) < 4 {
+		fields = append(fields, "-")
+		assumed(FENEnPassantField, "no en passant square")
+	} else if fields[3] != "-" {
+		turn := chess.NoColor
+		switch fields[1] {
+		case "w":
+			turn = chess.White
+		case "b":
+			turn = chess.Black
+		}
+		ep := &fenValidation{issues: make([]FENIssue, 0)}
+		ep.checkEnPassant(fields[3], turn, board)
+		if len(ep.issues) > 0 {
+			repaired(FENEnPassantField, "removed impossible en passant square %v",
+				fields[3])
+			fields[3] = "-"
+		}
+	}
+
+	if len(fields) < 5 {
+		fields = append(fields, "0")
+		assumed(FENHalfmoveField, "halfmove clock 0")
+	} else if clock, err := strconv.Atoi(fields[4]); err != nil || clock < 0 {
+		repaired(FENHalfmoveField, "halfmove clock %v -> 0", fields[4])
+		fields[4] = "0"
+	}
+	if len(fields) < 6 {
+		fields = append(fields, "1")
+		assumed(FENFullmoveField, "fullmove number 1")
+	} else if moveNum, err := strconv.Atoi(fields[5]); err != nil || moveNum < 1 {
+		repaired(FENFullmoveField, "fullmove number %v -> 1", fields[5])
+		fields[5] = "1"
+	}
+
+	ret := strings.Join(fields, " ")
+	for _, issue := range ValidateFEN(ret) {
+		if issue.Severity == FENError {
+			return ret, repairs, fmt.Errorf("cannot repair %v", issue)
+		}
+	}
+
+	return ret, repairs, nil
+}
+
+// repairCastling keeps the valid rights of castling supported by board, in
+// the conventional order of castling's notation; with no castling field at
+// all every right the placement supports is assumed and written in X-FEN
+func repairCastling(castling string, board *fenBoard) string {
+	if board == nil {
+		if strings.ContainsAny(castling, castlingFiles) {
+			return castling
+		}
+		rights := make(map[byte]bool)
+		for _, ch := range []byte(castling) {
+			if strings.IndexByte("KQkq", ch) >= 0 {
+				rights[ch] = true
+			}
+		}
+		return canonicalCastling(rights)
+	}
+
+	rights := make([]castlingRight, 0)
+	if castling == "" {
+		for _, c := range []chess.Color{chess.White, chess.Black} {
+			kingFile := board.kingFile(c)
+			if kingFile < 0 {
+				continue
+			}
+			for _, kingside := range []bool{true, false} {
+				rookFile := board.outermostRook(c, kingFile, kingside)
+				if rookFile >= 0 {
+					rights = append(rights, castlingRight{color: c,
+						rookFile: rookFile, kingside: kingside})
+				}
+			}
+		}
+		return formatCastling(rights, board, XFENCastling)
+	}
+
+	return formatCastling(resolvableCastling(castling, board), board,
+		castlingNotationOf(castling))
+}
@@ -0,0 +1,145 @@
+package chesstools
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func issueCodes(issues []FENIssue) []FENIssueCode {
+	codes := make([]FENIssueCode, 0, len(issues))
+	for _, issue := range issues {
+		codes = append(codes, issue.Code)
+	}
+
+	return codes
+}
+
+func TestValidateFEN(t *testing.T) {
+	tests := []struct {
+		fen      string
+		expected []FENIssueCode
+		errors   bool
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			[]FENIssueCode{}, false},
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+			[]FENIssueCode{}, false},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq -",
+			[]FENIssueCode{FENFieldCount}, true},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBN w KQkq - 0 1",
+			[]FENIssueCode{FENBadPlacement}, true},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1",
+			[]FENIssueCode{FENBadSideToMove}, true},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w kqKQ - 0 1",
+			[]FENIssueCode{FENBadCastling}, false},
+		{"4k3/8/8/8/8/8/8/4K2R w KQ - 0 1",
+			[]FENIssueCode{FENCastlingMismatch}, true},
+		{"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1",
+			[]FENIssueCode{}, false},
+		{"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w HFhf - 0 1",
+			[]FENIssueCode{}, false},
+		{"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w FHfh - 0 1",
+			[]FENIssueCode{FENBadCastling}, false},
+		{"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KHkq - 0 1",
+			[]FENIssueCode{FENBadCastling}, true},
+		{"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w GFgf - 0 1",
+			[]FENIssueCode{FENCastlingMismatch, FENCastlingMismatch}, true},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e6 0 1",
+			[]FENIssueCode{FENBadEnPassant, FENBadEnPassant}, true},
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 3 1",
+			[]FENIssueCode{FENBadHalfmove}, false},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 0",
+			[]FENIssueCode{FENBadFullmove}, true},
+		{"4k3/8/8/8/8/8/8/4KK2 w - - 0 1",
+			[]FENIssueCode{FENKingCount}, true},
+		{"P3k3/8/8/8/8/8/8/4K3 w - - 0 1",
+			[]FENIssueCode{FENPawnOnBackRank}, true},
+		{"4k3/8/8/8/PPPPPPPP/P7/8/4K3 w - - 0 1",
+			[]FENIssueCode{FENTooManyPieces}, true},
+		{"4k3/8/8/8/8/8/8/4R1K1 w - - 0 1",
+			[]FENIssueCode{FENOpponentInCheck}, true},
+	}
+
+	for _, test := range tests {
+		issues := ValidateFEN(test.fen)
+		codes := issueCodes(issues)
+		if len(codes) != len(test.expected) {
+			t.Fatalf("%v: expected issues %v but got %v", test.fen,
+				test.expected, issues)
+		}
+		for ii := range codes {
+			if codes[ii] != test.expected[ii] {
+				t.Fatalf("%v: expected issues %v but got %v", test.fen,
+					test.expected, issues)
+			}
+		}
+		if HasFENErrors(issues) != test.errors {
+			t.Fatalf("%v: unexpected severities %v", test.fen, issues)
+		}
+	}
+
+	issues := ValidateFEN("4k3/8/8/8/8/8/8/4R1K1 w - - 0 1")
+	if issues[0].String() != "error: fen: white is to move but black is in check from the rook on e1" {
+		t.Fatalf("unexpected message %v", issues[0])
+	}
+}
+
+func TestRepairFEN(t *testing.T) {
+	tests := []struct {
+		fen      string
+		expected string
+		repairs  int
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", 0},
+		// placement only; castling rights come from the placement
+		{"r3k3/8/8/8/8/8/8/R3K2R",
+			"r3k3/8/8/8/8/8/8/R3K2R w KQq - 0 1", 5},
+		{"r3k3/8/8/8/8/8/8/4K2R B qkKQ e6 x 0 extra",
+			"r3k3/8/8/8/8/8/8/4K2R b Kq - 0 1", 6},
+		{"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR",
+			"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w KQkq - 0 1", 5},
+		{"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w fHh - 0 1",
+			"bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w Hhf - 0 1", 1},
+	}
+
+	for _, test := range tests {
+		repaired, repairs, err := RepairFEN(test.fen)
+		if err != nil {
+			t.Fatalf("RepairFEN(%v) failed: %v", test.fen, err)
+		}
+		if repaired != test.expected || len(repairs) != test.repairs {
+			t.Fatalf("RepairFEN(%v): expected %v with %v repairs but got %v %v",
+				test.fen, test.expected, test.repairs, repaired, repairs)
+		}
+	}
+
+	// inferred castling rights may not be the position's actual rights
+	_, repairs, err := RepairFEN("r3k3/8/8/8/8/8/8/R3K2R w")
+	if err != nil || len(repairs) != 4 || !repairs[0].Assumed ||
+		repairs[0].Field != FENCastlingField {
+		t.Fatalf("expected castling rights to be assumed: %v %v", repairs, err)
+	}
+
+	_, _, err = RepairFEN("P3k3/8/8/8/8/8/8/4K3 w - - 0 1")
+	if err == nil || !strings.Contains(err.Error(), "pawn on a8") {
+		t.Fatalf("expected a pawn on the back rank to be unrepairable: %v", err)
+	}
+}
+
+func TestExplainFENError(t *testing.T) {
+	fen := "4k3/8/8/8/8/8/8/4K2R w KQ - 0 1"
+	err := ExplainFENError(fen, nil)
+	if err == nil || !strings.Contains(err.Error(),
+		"castling: Q requires a white rook queenside of the king on e1") {
+		t.Fatalf("unexpected explanation %v", err)
+	}
+	parseErr := errors.New("parse failed")
+	err = ExplainFENError(fen, parseErr)
+	if !errors.Is(err, parseErr) ||
+		strings.Contains(err.Error(), parseErr.Error()) {
+		t.Fatalf("expected %v to wrap the parse error without repeating it",
+			err)
+	}
+}
@@ -2,4 +2,7 @@ module github.com/mikeb26/chesstools
 
 go 1.25.0
 
-require github.com/corentings/chess/v2 v2.5.1
+require (
+	github.com/corentings/chess/v2 v2.5.1
+	github.com/klauspost/compress v1.18.0
+)
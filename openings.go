@@ -1,7 +1,6 @@
 package chesstools
 
 import (
-	_ "embed"
 	"log"
 	"strconv"
 
@@ -23,6 +22,10 @@ const (
 	PlayerDbBaseUrl  = "https://explorer.lichess.ovh/player"
 
 	LichessTokenEnv = "LICHESS_TOKEN"
+
+	// Lichess variant keys for the explorer and cloud evals
+	StandardVariant = "standard"
+	Chess960Variant = "chess960"
 )
 
 func lichessBearerToken() string {
@@ -32,17 +35,23 @@ func lichessBearerToken() string {
 	return ""
 }
 
-//go:embed eco/all_fen.tsv
-var openingNamesTsvText string
+//go:generate go run ./eco/gen -dir eco -out openings_table.go
 
 type Opening struct {
-	eco  string
-	name string
+	eco          string
+	name         string
+	moves        string
+	fen          string
+	normalFen    string
+	polyglotHash uint64
 }
 
 var openingsByFEN map[string]*Opening
 var openingsByNormalFEN map[string]*Opening
 
+// in table order; used for reverse lookups by name or ECO code
+var openingList []*Opening
+
 type MoveStats struct {
 	Uci       string `json:"uci"`
 	San       string `json:"san"`
@@ -152,7 +161,7 @@ func (openingGame *OpeningGame) WithFullRatingRange(fetchFullRatingRange bool) *
 }
 
 func (openingGame *OpeningGame) WithFEN(fen string) *OpeningGame {
-	newGameArgs, err := chess.FEN(fen)
+	newGameArgs, err := LoadFEN(fen)
 	if err != nil {
 		log.Fatalf("FEN invalid err:%v fen:%v", err, fen)
 	}
@@ -237,16 +246,7 @@ func (openingGame *OpeningGame) WithTopReplies(fetchTop bool) *OpeningGame {
 }
 
 func (openingGame *OpeningGame) withECO() *OpeningGame {
-	var ok bool
-
-	fen := openingGame.G.Position().XFENString()
-	opening, ok := openingsByFEN[fen]
-	if !ok {
-		fen, err := NormalizeFEN(fen)
-		if err == nil {
-			opening, ok = openingsByNormalFEN[fen]
-		}
-	}
+	opening, ok := lookupOpening(openingGame.G.Position().XFENString())
 	if !ok {
 		if openingGame.Parent != nil {
 			openingGame.openingName = openingGame.Parent.openingName
@@ -356,6 +356,52 @@ func getTopReplies(g *chess.Game, fullRatingRange bool,
 	} else {
 		lastFen = fen
 	}
+	if opponentColor != g.Position().Turn() {
+		opponent = ""
+	}
+
+	return getExplorerReplies(fen, StandardVariant, fullRatingRange, allSpeeds,
+		opponent, opponentColor)
+}
+
+// GetLichessReplies returns the moves played from g's current position
+// across the Lichess database
+func GetLichessReplies(g *chess.Game, fullRatingRange bool,
+	allSpeeds bool) (*OpeningResp, error) {
+
+	return getExplorerReplies(g.Position().XFENString(), StandardVariant,
+		fullRatingRange, allSpeeds, "", chess.NoColor)
+}
+
+// GetLichess960Replies returns the moves played from fen across the Lichess
+// chess960 database. it takes a FEN rather than a game as a game loaded by
+// LoadFEN() lacks the castling rights the chess package cannot play.
+func GetLichess960Replies(fen string, fullRatingRange bool,
+	allSpeeds bool) (*OpeningResp, error) {
+
+	return getExplorerReplies(fen, Chess960Variant, fullRatingRange, allSpeeds,
+		"", chess.NoColor)
+}
+
+// GetPlayerReplies returns the moves played from g's current position in
+// player's games as color. unlike WithOpponent() the player explorer is
+// queried regardless of whose turn it is, so the result includes both
+// player's own moves and their opponents' replies.
+func GetPlayerReplies(g *chess.Game, player string, color chess.Color,
+	allSpeeds bool) (*OpeningResp, error) {
+
+	if player == "" || color == chess.NoColor {
+		return nil, fmt.Errorf("opening: player and color are required")
+	}
+
+	return getExplorerReplies(g.Position().XFENString(), StandardVariant, true,
+		allSpeeds, player, color)
+}
+
+// explorerURL returns the Lichess explorer request for the replies from fen
+func explorerURL(fen string, variant string, fullRatingRange bool,
+	allSpeeds bool, player string, playerColor chess.Color) (*url.URL, error) {
+
 	position := url.QueryEscape(fen)
 	var ratingBuckets string
 	if fullRatingRange {
@@ -375,20 +421,36 @@ func getTopReplies(g *chess.Game, fullRatingRange bool,
 	var requestURL *url.URL
 	var err error
 
-	if opponent == "" || opponentColor != g.Position().Turn() {
+	if player == "" {
 		queryParams =
 			fmt.Sprintf("?fen=%v&ratings=%v&speeds=%v", position, ratingBuckets,
 				speeds)
 		requestURL, err = url.Parse(LichessDbBaseUrl + queryParams)
 	} else {
 		queryParams =
-			fmt.Sprintf("?player=%v&fen=%v&ratings=%v&speeds=%v&color=%v", opponent,
-				position, ratingBuckets, speeds, strings.ToLower(opponentColor.Name()))
+			fmt.Sprintf("?player=%v&fen=%v&ratings=%v&speeds=%v&color=%v",
+				url.QueryEscape(player), position, ratingBuckets, speeds,
+				strings.ToLower(playerColor.Name()))
 		requestURL, err = url.Parse(PlayerDbBaseUrl + queryParams)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("opening: failed to parse url:%w", err)
 	}
+	if variant != StandardVariant {
+		requestURL.RawQuery += "&variant=" + url.QueryEscape(variant)
+	}
+
+	return requestURL, nil
+}
+
+func getExplorerReplies(fen string, variant string, fullRatingRange bool,
+	allSpeeds bool, player string, playerColor chess.Color) (*OpeningResp, error) {
+
+	requestURL, err := explorerURL(fen, variant, fullRatingRange, allSpeeds,
+		player, playerColor)
+	if err != nil {
+		return nil, err
+	}
 
 	//fmt.Fprintf(os.Stderr, "Getting top replies for %v url:%v....\n", g.Moves(),
 	//	requestURL)
@@ -470,26 +532,12 @@ func getTopReplies(g *chess.Game, fullRatingRange bool,
 func init() {
 	openingsByFEN = make(map[string]*Opening)
 	openingsByNormalFEN = make(map[string]*Opening)
-	for _, openingRow := range strings.Split(openingNamesTsvText, "\n") {
-		openingFields := strings.Split(openingRow, ";")
-		if len(openingFields) != 3 {
-			continue
-		}
-
-		fen := openingFields[0]
-		ecoIn := openingFields[1]
-		nameIn := openingFields[2]
-		openingsByFEN[fen] = &Opening{
-			eco:  ecoIn,
-			name: nameIn,
-		}
-		normalizedFen, err := NormalizeFEN(fen)
-		if err == nil {
-			openingsByNormalFEN[normalizedFen] = &Opening{
-				eco:  ecoIn,
-				name: nameIn,
-			}
-		}
+	openingList = make([]*Opening, 0, len(openingTable))
+	for idx := range openingTable {
+		opening := &openingTable[idx]
+		openingList = append(openingList, opening)
+		openingsByFEN[opening.fen] = opening
+		openingsByNormalFEN[opening.normalFen] = opening
 	}
 }
 
@@ -526,7 +574,7 @@ func (openingGame *OpeningGame) GetMoveCount() int {
 	return getMoveCountFromFEN(openingGame.G.Position().XFENString())
 }
 
-func GetOpeningName(fen string) string {
+func lookupOpening(fen string) (*Opening, bool) {
 	opening, ok := openingsByFEN[fen]
 	if !ok {
 		fen, err := NormalizeFEN(fen)
@@ -534,6 +582,12 @@ func GetOpeningName(fen string) string {
 			opening, ok = openingsByNormalFEN[fen]
 		}
 	}
+
+	return opening, ok
+}
+
+func GetOpeningName(fen string) string {
+	opening, ok := lookupOpening(fen)
 	if !ok {
 		return ""
 	}
@@ -542,16 +596,82 @@ func GetOpeningName(fen string) string {
 }
 
 func GetOpeningEco(fen string) string {
-	opening, ok := openingsByFEN[fen]
-	if !ok {
-		fen, err := NormalizeFEN(fen)
-		if err == nil {
-			opening, ok = openingsByNormalFEN[fen]
-		}
-	}
+	opening, ok := lookupOpening(fen)
 	if !ok {
 		return ""
 	}
 
 	return opening.eco
 }
+
+// ClassifyGame returns the ECO code, opening name, and ply of the deepest
+// position along g's main line which is named in the opening table. unlike
+// GetOpeningName() this still classifies games which have left book. if no
+// position is named, empty strings and a ply of -1 are returned.
+func ClassifyGame(g *chess.Game) (string, string, int) {
+	positions := g.Positions()
+	for ply := len(positions) - 1; ply >= 0; ply-- {
+		opening, ok := lookupOpening(positions[ply].XFENString())
+		if ok {
+			return opening.eco, opening.name, ply
+		}
+	}
+
+	return "", "", -1
+}
+
+func (opening *Opening) Eco() string {
+	return opening.eco
+}
+
+func (opening *Opening) Name() string {
+	return opening.name
+}
+
+// Moves returns the opening's canonical move sequence in PGN movetext form.
+// this is empty for the handful of openings which are only known by FEN.
+func (opening *Opening) Moves() string {
+	return opening.moves
+}
+
+func (opening *Opening) FEN() string {
+	return opening.fen
+}
+
+// PolyglotHash returns the Polyglot opening book key of the opening's
+// position
+func (opening *Opening) PolyglotHash() uint64 {
+	return opening.polyglotHash
+}
+
+// SearchOpenings returns every opening whose name contains query, ignoring
+// case, in opening table order
+func SearchOpenings(query string) []*Opening {
+	query = strings.ToLower(query)
+	ret := make([]*Opening, 0)
+	for _, opening := range openingList {
+		if strings.Contains(strings.ToLower(opening.name), query) {
+			ret = append(ret, opening)
+		}
+	}
+
+	return ret
+}
+
+// GetOpeningsByEco returns every opening whose ECO code begins with eco, in
+// opening table order. e.g. "B90" matches only B90 while "B9" matches B90
+// through B99
+func GetOpeningsByEco(eco string) []*Opening {
+	eco = strings.ToUpper(eco)
+	ret := make([]*Opening, 0)
+	if eco == "" {
+		return ret
+	}
+	for _, opening := range openingList {
+		if strings.HasPrefix(opening.eco, eco) {
+			ret = append(ret, opening)
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,142 @@
+package chesstools
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/corentings/chess/v2"
+)
+
+func loadTestGame(t *testing.T, moves string) *chess.Game {
+	pgnReader, err := chess.PGN(strings.NewReader(moves))
+	if err != nil {
+		t.Fatalf("Failed to parse moves %v: %v", moves, err)
+	}
+
+	return chess.NewGame(pgnReader)
+}
+
+func TestClassifyGameInBook(t *testing.T) {
+	g := loadTestGame(t, "1. e4 c5 2. Nf3 d6 3. d4 cxd4 4. Nxd4 Nf6 5. Nc3 a6 6. h3")
+
+	eco, name, ply := ClassifyGame(g)
+	if eco != "B90" || name != "Sicilian Defense: Najdorf Variation, Adams Attack" {
+		t.Fatalf("unexpected classification %v %v", eco, name)
+	}
+	if ply != 11 {
+		t.Fatalf("expected ply 11 but got %v", ply)
+	}
+}
+
+func TestClassifyGameOutOfBook(t *testing.T) {
+	g := loadTestGame(t, "1. e4 c5 2. Nf3 d6 3. d4 cxd4 4. Nxd4 Nf6 5. Nc3 a6 6. a3 h6 7. Ra2")
+
+	if GetOpeningEco(g.Position().XFENString()) != "" {
+		t.Fatalf("expected final position to be out of book")
+	}
+	eco, name, ply := ClassifyGame(g)
+	if eco != "B90" || name != "Sicilian Defense: Najdorf Variation" {
+		t.Fatalf("unexpected classification %v %v", eco, name)
+	}
+	if ply != 10 {
+		t.Fatalf("expected ply 10 but got %v", ply)
+	}
+}
+
+func TestClassifyGameNoBook(t *testing.T) {
+	g := chess.NewGame()
+
+	eco, name, ply := ClassifyGame(g)
+	if eco != "" || name != "" || ply != -1 {
+		t.Fatalf("expected no classification but got %v %v %v", eco, name, ply)
+	}
+}
+
+func TestSearchOpenings(t *testing.T) {
+	openings := SearchOpenings("najdorf variation, adams")
+	if len(openings) != 1 {
+		t.Fatalf("expected 1 opening but got %v", len(openings))
+	}
+	if openings[0].Eco() != "B90" {
+		t.Fatalf("unexpected eco %v", openings[0].Eco())
+	}
+	expectedMoves := "1. e4 c5 2. Nf3 d6 3. d4 cxd4 4. Nxd4 Nf6 5. Nc3 a6 6. h3"
+	if openings[0].Moves() != expectedMoves {
+		t.Fatalf("expected moves %v got %v", expectedMoves, openings[0].Moves())
+	}
+	g := loadTestGame(t, expectedMoves)
+	if g.Position().XFENString() != openings[0].FEN() {
+		t.Fatalf("expected fen %v got %v", g.Position().XFENString(),
+			openings[0].FEN())
+	}
+
+	if len(SearchOpenings("no such opening")) != 0 {
+		t.Fatalf("expected no matches")
+	}
+}
+
+func TestGetOpeningsByEco(t *testing.T) {
+	b90 := GetOpeningsByEco("b90")
+	if len(b90) == 0 {
+		t.Fatalf("expected B90 openings")
+	}
+	for _, opening := range b90 {
+		if opening.Eco() != "B90" {
+			t.Fatalf("unexpected eco %v", opening.Eco())
+		}
+	}
+
+	b9x := GetOpeningsByEco("B9")
+	if len(b9x) <= len(b90) {
+		t.Fatalf("expected B9 prefix to match more openings than B90")
+	}
+	if len(GetOpeningsByEco("")) != 0 {
+		t.Fatalf("expected no matches for an empty eco")
+	}
+}
+
+func TestOpeningTable(t *testing.T) {
+	if len(openingTable) == 0 {
+		t.Fatalf("expected a non-empty opening table")
+	}
+	for _, opening := range openingTable {
+		normalFen, err := NormalizeFEN(opening.fen)
+		if err != nil {
+			t.Fatalf("invalid fen for %v: %v", opening.name, err)
+		}
+		if normalFen != opening.normalFen {
+			t.Fatalf("expected normalized fen %v for %v but got %v", normalFen,
+				opening.name, opening.normalFen)
+		}
+		fenArgs, err := chess.FEN(opening.fen)
+		if err != nil {
+			t.Fatalf("invalid fen for %v: %v", opening.name, err)
+		}
+		hash := chess.NewGame(fenArgs).Position().ZobristHash()
+		if hash != opening.PolyglotHash() {
+			t.Fatalf("expected polyglot hash %x for %v but got %x", hash,
+				opening.name, opening.PolyglotHash())
+		}
+	}
+
+	// extra_fen.tsv renames this position from the lichess tables
+	if GetOpeningName("rnbqkbnr/pp2pppp/2p5/3p4/3PP3/5P2/PPP3PP/RNBQKBNR b KQkq - 0 3") != "Caro-Kann Defense: Fantasy Variation" {
+		t.Fatalf("expected extra_fen.tsv to override the lichess name")
+	}
+}
+
+func TestExplorerURL960(t *testing.T) {
+	fen, err := Chess960StartFEN(0)
+	if err != nil {
+		t.Fatalf("Chess960StartFEN failed: %v", err)
+	}
+	requestURL, err := explorerURL(fen, Chess960Variant, false, false, "",
+		chess.NoColor)
+	if err != nil {
+		t.Fatalf("explorerURL failed: %v", err)
+	}
+	query := requestURL.Query()
+	if query.Get("fen") != fen || query.Get("variant") != Chess960Variant {
+		t.Fatalf("unexpected explorer request %v", requestURL)
+	}
+}
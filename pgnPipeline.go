@@ -0,0 +1,362 @@
+package chesstools
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/corentings/chess/v2"
+)
+
+// DefaultProgressInterval is how often commands report throughput while
+// processing large PGNs
+const DefaultProgressInterval = 10 * time.Second
+
+// PgnGameInfo describes where a game handed to a PgnGameFunc came from
+type PgnGameInfo struct {
+	Name    string
+	GameNum int
+	Offset  int64
+	Raw     string
+}
+
+// PgnGameFunc processes a single game and returns the text to emit for it.
+// it is invoked concurrently from multiple workers so it must not modify
+// shared state without synchronization.
+type PgnGameFunc func(g *chess.Game, info PgnGameInfo) (string, error)
+
+// PgnEmitFunc receives each game along with the output its PgnGameFunc
+// returned. unlike PgnGameFunc it is invoked from a single goroutine, in
+// input order unless the pipeline is unordered, so it may keep state such
+// as counts or which games have already been seen.
+type PgnEmitFunc func(output string, g *chess.Game, info PgnGameInfo) error
+
+// PgnPipeline splits a PGN source into raw games, parses and processes them
+// on a pool of workers, and emits the results either in their original
+// order or as soon as each is ready
+type PgnPipeline struct {
+	jobs             int
+	ordered          bool
+	strict           bool
+	expandVariations bool
+	errOutput        io.Writer
+	progress         time.Duration
+
+	start   time.Time
+	games   atomic.Int64
+	skipped atomic.Int64
+	bytes   atomic.Int64
+}
+
+type pgnJob struct {
+	seq     int
+	info    PgnGameInfo
+	games   []*chess.Game
+	outputs []any
+	skipped bool
+	err     error
+}
+
+func NewPgnPipeline(jobs int) *PgnPipeline {
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+
+	return &PgnPipeline{
+		jobs:      jobs,
+		ordered:   true,
+		errOutput: os.Stderr,
+		start:     time.Now(),
+	}
+}
+
+// WithOrdered controls whether output is emitted in the order games appear
+// in the source (the default) or in the order workers finish them
+func (p *PgnPipeline) WithOrdered(orderedIn bool) *PgnPipeline {
+	p.ordered = orderedIn
+
+	return p
+}
+
+// WithStrict makes the first malformed game abort Run() rather than being
+// reported and skipped
+func (p *PgnPipeline) WithStrict(strictIn bool) *PgnPipeline {
+	p.strict = strictIn
+
+	return p
+}
+
+// WithExpandVariations hands each variation of a game to the PgnGameFunc as
+// its own game
+func (p *PgnPipeline) WithExpandVariations(expandVariationsIn bool) *PgnPipeline {
+	p.expandVariations = expandVariationsIn
+
+	return p
+}
+
+// WithErrorOutput sets where skipped games and progress are reported;
+// defaults to stderr
+func (p *PgnPipeline) WithErrorOutput(errOutputIn io.Writer) *PgnPipeline {
+	p.errOutput = errOutputIn
+
+	return p
+}
+
+// WithProgress reports throughput every interval while Run() is in progress;
+// 0 (the default) disables progress reports
+func (p *PgnPipeline) WithProgress(interval time.Duration) *PgnPipeline {
+	p.progress = interval
+
+	return p
+}
+
+// Run processes every game in r, writing the output of process to out. it
+// may be invoked multiple times, e.g. once per input file, and throughput
+// accumulates across invocations.
+func (p *PgnPipeline) Run(r io.Reader, name string, process PgnGameFunc,
+	out io.Writer) error {
+
+	return p.RunEmit(r, name, process,
+		func(output string, _ *chess.Game, _ PgnGameInfo) error {
+			_, err := io.WriteString(out, output)
+			return err
+		})
+}
+
+// RunEmit is like Run() but hands each game's output to emit rather than
+// writing it
+func (p *PgnPipeline) RunEmit(r io.Reader, name string, process PgnGameFunc,
+	emit PgnEmitFunc) error {
+
+	return RunPgnResults(p, r, name, process, emit)
+}
+
+// RunPgnResults is like RunEmit() but for process functions whose result is
+// something other than text, e.g. records that emit merges into a running
+// tally
+func RunPgnResults[T any](p *PgnPipeline, r io.Reader, name string,
+	process func(g *chess.Game, info PgnGameInfo) (T, error),
+	emit func(result T, g *chess.Game, info PgnGameInfo) error) error {
+
+	return p.run(r, name,
+		func(g *chess.Game, info PgnGameInfo) (any, error) {
+			return process(g, info)
+		},
+		func(result any, g *chess.Game, info PgnGameInfo) error {
+			return emit(result.(T), g, info)
+		})
+}
+
+func (p *PgnPipeline) run(r io.Reader, name string,
+	process func(*chess.Game, PgnGameInfo) (any, error),
+	emit func(any, *chess.Game, PgnGameInfo) error) error {
+
+	stream := NewPgnStream(r, name)
+	done := make(chan struct{})
+	jobCh := make(chan *pgnJob, p.jobs*4)
+	resultCh := make(chan *pgnJob, p.jobs*4)
+
+	go p.split(stream, jobCh, done)
+
+	var wg sync.WaitGroup
+	for ii := 0; ii < p.jobs; ii++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				p.work(job, process)
+				resultCh <- job
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(resultCh)
+	}()
+
+	if p.progress > 0 {
+		ticker := time.NewTicker(p.progress)
+		defer ticker.Stop()
+		go func() {
+			for {
+				select {
+				case <-ticker.C:
+					fmt.Fprintf(p.errOutput, "%v\n", p.Stats())
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	err := p.emit(resultCh, emit)
+	close(done)
+	// drain so that workers and the splitter can exit
+	for range resultCh {
+	}
+
+	return err
+}
+
+func (p *PgnPipeline) split(stream *PgnStream, jobCh chan<- *pgnJob,
+	done <-chan struct{}) {
+
+	defer close(jobCh)
+
+	for seq := 0; ; seq++ {
+		prevOffset := stream.offset
+		raw, gameNum, offset, err := stream.readRawGame()
+		p.bytes.Add(stream.offset - prevOffset)
+		if err == io.EOF {
+			return
+		}
+		job := &pgnJob{
+			seq: seq,
+			info: PgnGameInfo{
+				Name:    stream.name,
+				GameNum: gameNum,
+				Offset:  offset,
+				Raw:     raw,
+			},
+		}
+		if err != nil {
+			job.err = fmt.Errorf("Failed to read %v: %w", stream.name, err)
+		}
+
+		select {
+		case jobCh <- job:
+		case <-done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (p *PgnPipeline) work(job *pgnJob,
+	process func(*chess.Game, PgnGameInfo) (any, error)) {
+
+	if job.err != nil {
+		return
+	}
+
+	games, err := parseRawGame(job.info.Raw)
+	if err != nil {
+		parseErr := &PgnParseError{
+			Name:    job.info.Name,
+			GameNum: job.info.GameNum,
+			Offset:  job.info.Offset,
+			Err:     err,
+		}
+		if p.strict {
+			job.err = parseErr
+		} else {
+			fmt.Fprintf(p.errOutput, "Skipping malformed game %v\n", parseErr)
+			job.skipped = true
+		}
+		return
+	}
+	if p.expandVariations {
+		games = splitGame(games[0])
+	}
+
+	job.outputs = make([]any, len(games))
+	for ii, g := range games {
+		output, err := process(g, job.info)
+		if err != nil {
+			job.err = err
+			return
+		}
+		job.outputs[ii] = output
+	}
+	job.games = games
+}
+
+func (p *PgnPipeline) emit(resultCh <-chan *pgnJob,
+	emit func(any, *chess.Game, PgnGameInfo) error) error {
+
+	pending := make(map[int]*pgnJob)
+	nextSeq := 0
+
+	for job := range resultCh {
+		if !p.ordered {
+			err := p.emitOne(job, emit)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		pending[job.seq] = job
+		for {
+			next, ok := pending[nextSeq]
+			if !ok {
+				break
+			}
+			delete(pending, nextSeq)
+			nextSeq++
+			err := p.emitOne(next, emit)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *PgnPipeline) emitOne(job *pgnJob,
+	emit func(any, *chess.Game, PgnGameInfo) error) error {
+
+	if job.err != nil {
+		return job.err
+	}
+	if job.skipped {
+		p.skipped.Add(1)
+		return nil
+	}
+	p.games.Add(int64(len(job.games)))
+
+	for ii, g := range job.games {
+		err := emit(job.outputs[ii], g, job.info)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PgnPipelineStats summarizes the throughput of a PgnPipeline
+type PgnPipelineStats struct {
+	Games   int64
+	Skipped int64
+	Bytes   int64
+	Elapsed time.Duration
+}
+
+func (p *PgnPipeline) Stats() PgnPipelineStats {
+	return PgnPipelineStats{
+		Games:   p.games.Load(),
+		Skipped: p.skipped.Load(),
+		Bytes:   p.bytes.Load(),
+		Elapsed: time.Since(p.start),
+	}
+}
+
+func (s PgnPipelineStats) String() string {
+	secs := s.Elapsed.Seconds()
+	if secs <= 0 {
+		secs = 1e-9
+	}
+	mb := float64(s.Bytes) / (1024 * 1024)
+
+	return fmt.Sprintf("Processed %v games (%.1f MB) in %v: %.1f games/s, %.1f MB/s; skipped %v malformed games",
+		s.Games, mb, s.Elapsed.Round(time.Millisecond), float64(s.Games)/secs,
+		mb/secs, s.Skipped)
+}
@@ -0,0 +1,135 @@
+package chesstools
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/corentings/chess/v2"
+)
+
+func eventOf(g *chess.Game, info PgnGameInfo) (string, error) {
+	return fmt.Sprintf("%v:%v\n", g.GetTagPair("Event"), info.GameNum), nil
+}
+
+func manyGamesPgn(numGames int) string {
+	var sb strings.Builder
+	for ii := 1; ii <= numGames; ii++ {
+		sb.WriteString(fmt.Sprintf("[Event \"%v\"]\n[Result \"*\"]\n\n1. e4 e5 2. Nf3 *\n\n", ii))
+	}
+
+	return sb.String()
+}
+
+func TestPgnPipelineOrdered(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPgnPipeline(8)
+	err := p.Run(strings.NewReader(manyGamesPgn(500)), "many.pgn", eventOf, &out)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 500 {
+		t.Fatalf("expected 500 games but got %v", len(lines))
+	}
+	for ii, line := range lines {
+		if line != fmt.Sprintf("%v:%v", ii+1, ii+1) {
+			t.Fatalf("game %v out of order: %v", ii+1, line)
+		}
+	}
+	stats := p.Stats()
+	if stats.Games != 500 || stats.Bytes != int64(len(manyGamesPgn(500))) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestPgnPipelineUnordered(t *testing.T) {
+	var out bytes.Buffer
+	p := NewPgnPipeline(8).WithOrdered(false)
+	err := p.Run(strings.NewReader(manyGamesPgn(500)), "many.pgn", eventOf, &out)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	sort.Slice(lines, func(i, j int) bool {
+		var a, b int
+		fmt.Sscanf(lines[i], "%d", &a)
+		fmt.Sscanf(lines[j], "%d", &b)
+		return a < b
+	})
+	for ii, line := range lines {
+		if line != fmt.Sprintf("%v:%v", ii+1, ii+1) {
+			t.Fatalf("unexpected or missing game %v: %v", ii+1, line)
+		}
+	}
+}
+
+func TestPgnPipelineResults(t *testing.T) {
+	total := 0
+	p := NewPgnPipeline(8)
+	err := RunPgnResults(p, strings.NewReader(manyGamesPgn(100)), "many.pgn",
+		func(g *chess.Game, info PgnGameInfo) (int, error) {
+			return len(g.Moves()) * info.GameNum, nil
+		},
+		func(plies int, _ *chess.Game, _ PgnGameInfo) error {
+			total += plies
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("RunPgnResults failed: %v", err)
+	}
+	if total != 3*100*101/2 {
+		t.Fatalf("unexpected total %v", total)
+	}
+}
+
+func TestPgnPipelineMalformed(t *testing.T) {
+	var out, errOut bytes.Buffer
+	p := NewPgnPipeline(4).WithErrorOutput(&errOut).WithExpandVariations(true)
+	err := p.Run(strings.NewReader(streamTestPgn), "test.pgn", eventOf, &out)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if out.String() != "one:1\nthree:3\nthree:3\n" {
+		t.Fatalf("unexpected output %v", out.String())
+	}
+	if p.Stats().Skipped != 1 || !strings.Contains(errOut.String(), "test.pgn#2") {
+		t.Fatalf("expected game 2 to be skipped: %+v %v", p.Stats(),
+			errOut.String())
+	}
+
+	out.Reset()
+	p = NewPgnPipeline(4).WithStrict(true)
+	err = p.Run(strings.NewReader(streamTestPgn), "test.pgn", eventOf, &out)
+	var parseErr *PgnParseError
+	if !errors.As(err, &parseErr) || parseErr.GameNum != 2 {
+		t.Fatalf("expected a parse error for game 2 but got %v", err)
+	}
+	if out.String() != "one:1\n" {
+		t.Fatalf("expected only game 1 before the error but got %v", out.String())
+	}
+}
+
+func TestPgnPipelineProcessError(t *testing.T) {
+	failing := func(g *chess.Game, info PgnGameInfo) (string, error) {
+		if info.GameNum == 250 {
+			return "", fmt.Errorf("failed on %v", info.GameNum)
+		}
+		return "x", nil
+	}
+
+	var out bytes.Buffer
+	err := NewPgnPipeline(8).Run(strings.NewReader(manyGamesPgn(500)),
+		"many.pgn", failing, &out)
+	if err == nil || err.Error() != "failed on 250" {
+		t.Fatalf("expected the process error but got %v", err)
+	}
+	if out.Len() != 249 {
+		t.Fatalf("expected 249 games before the error but got %v", out.Len())
+	}
+}
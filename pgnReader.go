@@ -1,22 +1,58 @@
 package chesstools
 
 import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
 	"fmt"
 	//	"golang.org/x/oauth2/clientcredentials"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 const LichessUrlPrefix = "https://lichess.org"
+const LichessPseudoUrlPrefix = "lichess:"
+
+// StdinPgn may be passed to OpenPgn() in place of a file name to read from
+// stdin
+const StdinPgn = "-"
 
+// OpenPgn opens a PGN source, which may be a local file, StdinPgn, a
+// lichess.org game, study, study chapter or broadcast URL, a
+// lichess:@/<user>?<params> pseudo-URL for a user's games, a chess.com game
+// or monthly archive URL, or any other http(s) URL. gzip, bzip2 and zstd
+// compressed sources (e.g. the Lichess monthly database dumps) are
+// decompressed transparently.
 func OpenPgn(pgnFileOrUrl string) (io.ReadCloser, error) {
-	if strings.HasPrefix(pgnFileOrUrl, LichessUrlPrefix) {
-		return openPgnLichess(pgnFileOrUrl)
-	} // else
+	var rc io.ReadCloser
+	var err error
 
-	return openPgnFile(pgnFileOrUrl)
+	if pgnFileOrUrl == StdinPgn {
+		rc = io.NopCloser(os.Stdin)
+	} else if strings.HasPrefix(pgnFileOrUrl, LichessUrlPrefix) {
+		rc, err = openPgnLichess(pgnFileOrUrl)
+	} else if strings.HasPrefix(pgnFileOrUrl, LichessPseudoUrlPrefix) {
+		rc, err = openPgnLichessUser(pgnFileOrUrl)
+	} else if isChessComUrl(pgnFileOrUrl) {
+		rc, err = openPgnChessCom(pgnFileOrUrl)
+	} else if isHttpUrl(pgnFileOrUrl) {
+		rc, err = openPgnUrl(pgnFileOrUrl, pgnFileOrUrl)
+	} else {
+		rc, err = openPgnFile(pgnFileOrUrl)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decompressPgn(rc, pgnFileOrUrl)
 }
 
 func openPgnFile(filename string) (io.ReadCloser, error) {
@@ -28,59 +64,202 @@ func openPgnFile(filename string) (io.ReadCloser, error) {
 	return f, nil
 }
 
+// overridden by tests
+var lichessBaseUrl = LichessUrlPrefix
+
 func openPgnLichess(url string) (io.ReadCloser, error) {
-	// e.g. https://lichess.org/1mIMQ8xz for a game
-	// or https://lichess.org/study/p1SdJUis for a study
+	// e.g. https://lichess.org/1mIMQ8xz for a game,
+	// https://lichess.org/study/p1SdJUis for a study,
+	// https://lichess.org/study/p1SdJUis/Qm4aV2uQ for a study chapter,
+	// https://lichess.org/broadcast/<tourSlug>/<tourId> for a broadcast,
+	// https://lichess.org/broadcast/<tourSlug>/<roundSlug>/<roundId> for a
+	// broadcast round, or the same followed by /<gameId> for one of its games.
 	// https://lichess.org/api#tag/Games says gameId is 8 characters.
 	// when clicking from https://lichess.org/@/<user>/all there seems
 	// to be 4 additional characters appended, so strip these if present
 
-	const GameIdLen = 8
-	const GameIdFieldNum = 4
-	const StudyIdLen = 8
-	const StudyIdFieldNum = 5
 	const LichessUrlGamePath = "/game/export/"
 	const LichessUrlStudyPath = "/study/"
-	const LichessUrlStudyPrefix = LichessUrlPrefix + LichessUrlStudyPath
+	const LichessUrlStudyApiPath = "/api/study/"
+	const LichessUrlBroadcastApiPath = "/api/broadcast/"
 	const LichessUrlGameSuffixParams = "?evals=0&clocks=0"
-	const LichessUrlStudySuffix = ".pgn"
+	const LichessUrlPgnSuffix = ".pgn"
+
+	path := strings.TrimPrefix(url, LichessUrlPrefix)
+	if idx := strings.IndexAny(path, "?#"); idx != -1 {
+		path = path[0:idx]
+	}
+	urlParts := strings.Split(strings.Trim(path, "/"), "/")
 
 	var url2Fetch string
+	var err error
 
-	// @todo detect study chapter urls
-	if strings.HasPrefix(url, LichessUrlStudyPrefix) {
-		urlParts := strings.Split(url, "/")
-		if len(urlParts) < StudyIdFieldNum {
+	switch urlParts[0] {
+	case "study":
+		var studyId, chapterId string
+		if len(urlParts) < 2 {
 			return nil, fmt.Errorf("Cannot find lichess study id field in url %v", url)
 		}
-		studyId := urlParts[StudyIdFieldNum-1]
-		if len(studyId) < StudyIdLen {
-			return nil, fmt.Errorf("Malformed study id field in url %v", url)
+		studyId, err = lichessId(urlParts[1], url, "study")
+		if err != nil {
+			return nil, err
 		}
-		if len(studyId) > StudyIdLen {
-			studyId = studyId[0:StudyIdLen]
+		if len(urlParts) < 3 {
+			url2Fetch = lichessBaseUrl + LichessUrlStudyPath + studyId +
+				LichessUrlPgnSuffix
+			break
 		}
-		url2Fetch = LichessUrlStudyPrefix + studyId + LichessUrlStudySuffix
-	} else {
-		urlParts := strings.Split(url, "/")
-		if len(urlParts) < GameIdFieldNum {
+		chapterId, err = lichessId(urlParts[2], url, "chapter")
+		if err != nil {
+			return nil, err
+		}
+		url2Fetch = lichessBaseUrl + LichessUrlStudyApiPath + studyId + "/" +
+			chapterId + LichessUrlPgnSuffix
+	case "broadcast":
+		var tourId, roundId, gameId string
+		switch len(urlParts) {
+		case 3:
+			tourId, err = lichessId(urlParts[2], url, "broadcast")
+			if err != nil {
+				return nil, err
+			}
+			url2Fetch = lichessBaseUrl + LichessUrlBroadcastApiPath + tourId +
+				LichessUrlPgnSuffix
+		case 4:
+			roundId, err = lichessId(urlParts[3], url, "broadcast round")
+			if err != nil {
+				return nil, err
+			}
+			url2Fetch = lichessBaseUrl + LichessUrlBroadcastApiPath + "round/" +
+				roundId + LichessUrlPgnSuffix
+		case 5:
+			// a broadcast round is a study and its games are its chapters
+			roundId, err = lichessId(urlParts[3], url, "broadcast round")
+			if err != nil {
+				return nil, err
+			}
+			gameId, err = lichessId(urlParts[4], url, "broadcast game")
+			if err != nil {
+				return nil, err
+			}
+			url2Fetch = lichessBaseUrl + LichessUrlStudyApiPath + roundId + "/" +
+				gameId + LichessUrlPgnSuffix
+		default:
+			return nil, fmt.Errorf("Cannot find lichess broadcast id field in url %v", url)
+		}
+	default:
+		var gameId string
+		if urlParts[0] == "" {
 			return nil, fmt.Errorf("Cannot find lichess game id field in url %v", url)
 		}
-		gameId := urlParts[GameIdFieldNum-1]
-		if len(gameId) < GameIdLen {
-			return nil, fmt.Errorf("Malformed game id field in url %v", url)
+		gameId, err = lichessId(urlParts[0], url, "game")
+		if err != nil {
+			return nil, err
+		}
+		url2Fetch = lichessBaseUrl + LichessUrlGamePath + gameId +
+			LichessUrlGameSuffixParams
+	}
+
+	return openPgnLichessUrl(url2Fetch, url)
+}
+
+func lichessId(field string, url string, idType string) (string, error) {
+	const IdLen = 8
+
+	if len(field) < IdLen {
+		return "", fmt.Errorf("Malformed %v id field in url %v", idType, url)
+	}
+
+	return field[0:IdLen], nil
+}
+
+// openPgnLichessUser streams a user's games via the lichess export API.
+// e.g. lichess:@/<user>?since=2024-01-01&perfType=blitz
+// the query parameters are passed through to the API (see
+// https://lichess.org/api#tag/Games/operation/apiGamesUser) except that
+// since and until may also be given as YYYY-MM-DD dates. evals and clocks
+// are included unless explicitly disabled.
+func openPgnLichessUser(pseudoUrl string) (io.ReadCloser, error) {
+	const LichessUrlUserApiPath = "/api/games/user/"
+
+	userAndQuery := strings.TrimPrefix(pseudoUrl, LichessPseudoUrlPrefix)
+	if !strings.HasPrefix(userAndQuery, "@/") {
+		return nil, fmt.Errorf("Malformed lichess user url %v; expecting %v@/<user>[?<params>]",
+			pseudoUrl, LichessPseudoUrlPrefix)
+	}
+	userAndQuery = strings.TrimPrefix(userAndQuery, "@/")
+
+	user := userAndQuery
+	rawQuery := ""
+	if idx := strings.Index(userAndQuery, "?"); idx != -1 {
+		user = userAndQuery[0:idx]
+		rawQuery = userAndQuery[idx+1:]
+	}
+	user = strings.Trim(user, "/")
+	if user == "" {
+		return nil, fmt.Errorf("Cannot find lichess username in url %v", pseudoUrl)
+	}
+
+	params, err := neturl.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse lichess user url %v: %w",
+			pseudoUrl, err)
+	}
+	for _, param := range []string{"since", "until"} {
+		val := params.Get(param)
+		if val == "" {
+			continue
+		}
+		if _, err := strconv.ParseInt(val, 10, 64); err == nil {
+			continue
 		}
-		if len(gameId) > GameIdLen {
-			gameId = gameId[0:GameIdLen]
+		t, err := time.Parse("2006-01-02", val)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %v value %v in url %v; expecting YYYY-MM-DD or milliseconds since the epoch",
+				param, val, pseudoUrl)
+		}
+		params.Set(param, strconv.FormatInt(t.UnixMilli(), 10))
+	}
+	for _, param := range []string{"evals", "clocks"} {
+		if params.Get(param) == "" {
+			params.Set(param, "true")
 		}
-		url2Fetch = LichessUrlPrefix + LichessUrlGamePath + gameId + LichessUrlGameSuffixParams
 	}
 
-	client := http.DefaultClient
+	url2Fetch := lichessBaseUrl + LichessUrlUserApiPath +
+		neturl.PathEscape(user) + "?" + params.Encode()
+
+	return openPgnLichessUrl(url2Fetch, pseudoUrl)
+}
+
+func openPgnLichessUrl(url2Fetch string, url string) (io.ReadCloser, error) {
 	req, err := http.NewRequest("GET", url2Fetch, nil)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to construct http request for url %v: %w", url, err)
 	}
+	req.Header.Set("Accept", "application/x-chess-pgn")
+	// private studies and faster export rates need a token
+	if tok := lichessBearerToken(); tok != "" {
+		req.Header.Set("Authorization", "Bearer "+tok)
+	}
+
+	return doPgnRequest(req, url)
+}
+
+// openPgnUrl fetches url2Fetch; url is the user supplied url it was derived
+// from and is used for error reporting
+func openPgnUrl(url2Fetch string, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", url2Fetch, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to construct http request for url %v: %w", url, err)
+	}
+
+	return doPgnRequest(req, url)
+}
+
+func doPgnRequest(req *http.Request, url string) (io.ReadCloser, error) {
+	client := http.DefaultClient
+	req.Header.Set("User-Agent", UserAgent)
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to fetch url %v: %w", url, err)
@@ -94,6 +273,72 @@ func openPgnLichess(url string) (io.ReadCloser, error) {
 	return resp.Body, nil
 }
 
+func isHttpUrl(pgnFileOrUrl string) bool {
+	return strings.HasPrefix(pgnFileOrUrl, "https://") ||
+		strings.HasPrefix(pgnFileOrUrl, "http://")
+}
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+type decompressedPgn struct {
+	io.Reader
+	closeFuncs []func() error
+}
+
+func (d *decompressedPgn) Close() error {
+	var ret error
+	for _, closeFunc := range d.closeFuncs {
+		err := closeFunc()
+		if err != nil && ret == nil {
+			ret = err
+		}
+	}
+
+	return ret
+}
+
+// decompressPgn sniffs rc's leading bytes rather than trusting the source
+// name's extension so compressed stdin and URLs work too
+func decompressPgn(rc io.ReadCloser, pgnFileOrUrl string) (io.ReadCloser, error) {
+	br := bufio.NewReader(rc)
+	magic, _ := br.Peek(len(zstdMagic))
+
+	ret := &decompressedPgn{
+		Reader:     br,
+		closeFuncs: []func() error{rc.Close},
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("Failed to decompress %v: %w", pgnFileOrUrl, err)
+		}
+		ret.Reader = gz
+		ret.closeFuncs = append([]func() error{gz.Close}, ret.closeFuncs...)
+	case bytes.HasPrefix(magic, bzip2Magic):
+		ret.Reader = bzip2.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			rc.Close()
+			return nil, fmt.Errorf("Failed to decompress %v: %w", pgnFileOrUrl, err)
+		}
+		ret.Reader = zr
+		ret.closeFuncs = append([]func() error{func() error {
+			zr.Close()
+			return nil
+		}}, ret.closeFuncs...)
+	}
+
+	return ret, nil
+}
+
 func NormalizeFEN(fen string) (string, error) {
 	// for opening repertoire purposes zero the halfmove clock field and reset
 	// the full move number field from the FEN as these may differ across
@@ -110,8 +355,18 @@ func NormalizeFEN(fen string) (string, error) {
 		return "", fmt.Errorf("Invalid FEN:{%v} expecting 6 fields but found %v", fen, len(fenFields))
 	}
 
-	var sb strings.Builder
+	// Chess960 castling rights may be written in X-FEN or Shredder-FEN; use
+	// X-FEN throughout so both forms of a position normalize identically
 	var err error
+	if strings.ContainsAny(fenFields[2], castlingFiles) {
+		fenFields[2], err = convertCastlingField(fenFields[0], fenFields[2],
+			XFENCastling)
+		if err != nil {
+			return "", fmt.Errorf("Invalid FEN:{%v}: %w", fen, err)
+		}
+	}
+
+	var sb strings.Builder
 	for ii := 0; ii < 4; ii++ {
 		_, err = sb.WriteString(fenFields[ii])
 		if err != nil {
@@ -0,0 +1,279 @@
+package chesstools
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const testPgnFile = "assets/test1.pgn"
+
+func readTestPgn(t *testing.T) string {
+	data, err := os.ReadFile(testPgnFile)
+	if err != nil {
+		t.Fatalf("failed to read %v: %v", testPgnFile, err)
+	}
+
+	return string(data)
+}
+
+func readPgnSource(t *testing.T, src string) string {
+	rc, err := OpenPgn(src)
+	if err != nil {
+		t.Fatalf("OpenPgn(%v) failed: %v", src, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("failed to read %v: %v", src, err)
+	}
+
+	return string(data)
+}
+
+func TestOpenPgnCompressed(t *testing.T) {
+	expected := readTestPgn(t)
+	tmpDir := t.TempDir()
+
+	gzFile := filepath.Join(tmpDir, "test1.pgn.gz")
+	f, err := os.Create(gzFile)
+	if err != nil {
+		t.Fatalf("failed to create %v: %v", gzFile, err)
+	}
+	gz := gzip.NewWriter(f)
+	gz.Write([]byte(expected))
+	gz.Close()
+	f.Close()
+
+	zstFile := filepath.Join(tmpDir, "test1.pgn.zst")
+	f, err = os.Create(zstFile)
+	if err != nil {
+		t.Fatalf("failed to create %v: %v", zstFile, err)
+	}
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		t.Fatalf("failed to create zstd writer: %v", err)
+	}
+	zw.Write([]byte(expected))
+	zw.Close()
+	f.Close()
+
+	for _, src := range []string{testPgnFile, gzFile, zstFile,
+		testPgnFile + ".bz2"} {
+
+		if readPgnSource(t, src) != expected {
+			t.Fatalf("unexpected content from %v", src)
+		}
+	}
+}
+
+func TestOpenPgnStdin(t *testing.T) {
+	f, err := os.Open(testPgnFile)
+	if err != nil {
+		t.Fatalf("failed to open %v: %v", testPgnFile, err)
+	}
+	defer f.Close()
+
+	savedStdin := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin = savedStdin }()
+
+	if readPgnSource(t, StdinPgn) != readTestPgn(t) {
+		t.Fatalf("unexpected content from stdin")
+	}
+}
+
+func TestOpenPgnHttp(t *testing.T) {
+	expected := readTestPgn(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		if r.URL.Path != "/games.pgn" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, expected)
+	}))
+	defer ts.Close()
+
+	if readPgnSource(t, ts.URL+"/games.pgn") != expected {
+		t.Fatalf("unexpected content from %v", ts.URL)
+	}
+	_, err := OpenPgn(ts.URL + "/missing.pgn")
+	if err == nil {
+		t.Fatalf("expected an error for a missing url")
+	}
+}
+
+func TestOpenPgnChessCom(t *testing.T) {
+	const gamePgn = "[Event \"Live Chess\"]\n\n1. e4 e5 1-0\n"
+	const archivePgn = gamePgn + "\n[Event \"Live Chess\"]\n\n1. d4 d5 0-1\n"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		switch r.URL.Path {
+		case "/callback/live/game/12345":
+			io.WriteString(w, `{"game":{"pgnHeaders":{"White":"SomePlayer","Date":"2024.01.05"}}}`)
+		case "/callback/daily/game/777":
+			// started in january and finished in february
+			io.WriteString(w, `{"game":{"pgnHeaders":{"White":"SomePlayer","Date":"2024.01.30"}}}`)
+		case "/pub/player/someplayer/games/2024/02":
+			fmt.Fprintf(w, `{"games":[{"url":"https://www.chess.com/game/daily/777","pgn":%q}]}`,
+				gamePgn)
+		case "/pub/player/someplayer/games/2024/01":
+			fmt.Fprintf(w, `{"games":[{"url":"https://www.chess.com/game/live/999","pgn":"x"},{"url":"https://www.chess.com/game/live/12345","pgn":%q}]}`,
+				gamePgn)
+		case "/pub/player/someplayer/games/2024/01/pgn":
+			io.WriteString(w, archivePgn)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	savedBase, savedApiBase := chessComBaseUrl, chessComApiBaseUrl
+	chessComBaseUrl, chessComApiBaseUrl = ts.URL, ts.URL
+	defer func() {
+		chessComBaseUrl, chessComApiBaseUrl = savedBase, savedApiBase
+	}()
+
+	for _, src := range []string{"https://www.chess.com/game/live/12345",
+		"https://www.chess.com/live/game/12345",
+		"https://www.chess.com/game/daily/777"} {
+
+		if readPgnSource(t, src) != gamePgn {
+			t.Fatalf("unexpected content from %v", src)
+		}
+	}
+	got := readPgnSource(t, "https://api.chess.com/pub/player/someplayer/games/2024/01")
+	if got != archivePgn {
+		t.Fatalf("unexpected archive content %v", got)
+	}
+	_, err := OpenPgn("https://www.chess.com/game/live/54321")
+	if err == nil || !strings.Contains(err.Error(), "54321") {
+		t.Fatalf("expected an error for an unknown game but got %v", err)
+	}
+}
+
+func TestChessComArchiveMonths(t *testing.T) {
+	months, err := chessComArchiveMonths("2024.12.31", "2025.01.01")
+	if err != nil || len(months) != 2 ||
+		months[0].Format("2006/01") != "2025/01" ||
+		months[1].Format("2006/01") != "2024/12" {
+		t.Fatalf("unexpected months %v err:%v", months, err)
+	}
+	_, err = chessComArchiveMonths("2024.??.??", "")
+	if err == nil {
+		t.Fatalf("expected an error for an unknown date")
+	}
+}
+
+// lichessStandIn serves testPgnFile for each lichess export endpoint
+// OpenPgn() uses so the lichess sources can be tested offline. every
+// request's path and query is recorded in requests.
+type lichessStandIn struct {
+	server   *httptest.Server
+	requests []string
+	headers  []http.Header
+	savedUrl string
+}
+
+func newLichessStandIn(t *testing.T) *lichessStandIn {
+	pgn := readTestPgn(t)
+
+	standIn := &lichessStandIn{}
+	standIn.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		standIn.requests = append(standIn.requests, r.URL.RequestURI())
+		standIn.headers = append(standIn.headers, r.Header)
+
+		p := r.URL.Path
+		if strings.HasPrefix(p, "/game/export/") ||
+			strings.HasPrefix(p, "/api/games/user/") ||
+			(strings.HasPrefix(p, "/study/") && strings.HasSuffix(p, ".pgn")) ||
+			(strings.HasPrefix(p, "/api/study/") && strings.HasSuffix(p, ".pgn")) ||
+			(strings.HasPrefix(p, "/api/broadcast/") && strings.HasSuffix(p, ".pgn")) {
+
+			w.Header().Set("Content-Type", "application/x-chess-pgn")
+			io.WriteString(w, pgn)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	standIn.savedUrl = lichessBaseUrl
+	lichessBaseUrl = standIn.server.URL
+
+	return standIn
+}
+
+func (standIn *lichessStandIn) Close() {
+	lichessBaseUrl = standIn.savedUrl
+	standIn.server.Close()
+}
+
+func TestOpenPgnLichess(t *testing.T) {
+	standIn := newLichessStandIn(t)
+	defer standIn.Close()
+
+	expected := readTestPgn(t)
+	tests := []struct {
+		src     string
+		request string
+	}{
+		{"https://lichess.org/1mIMQ8xz", "/game/export/1mIMQ8xz?evals=0&clocks=0"},
+		{"https://lichess.org/1mIMQ8xzabcd", "/game/export/1mIMQ8xz?evals=0&clocks=0"},
+		{"https://lichess.org/study/p1SdJUis", "/study/p1SdJUis.pgn"},
+		{"https://lichess.org/study/p1SdJUis/Qm4aV2uQ", "/api/study/p1SdJUis/Qm4aV2uQ.pgn"},
+		{"https://lichess.org/study/p1SdJUis/Qm4aV2uQ#12", "/api/study/p1SdJUis/Qm4aV2uQ.pgn"},
+		{"https://lichess.org/broadcast/some-event/8jN2XrPc", "/api/broadcast/8jN2XrPc.pgn"},
+		{"https://lichess.org/broadcast/some-event/round-1/Yd2mFqLe", "/api/broadcast/round/Yd2mFqLe.pgn"},
+		{"https://lichess.org/broadcast/some-event/round-1/Yd2mFqLe/Ab3cDe4F", "/api/study/Yd2mFqLe/Ab3cDe4F.pgn"},
+		{"lichess:@/someone", "/api/games/user/someone?clocks=true&evals=true"},
+		{"lichess:@/someone?since=2024-01-01&perfType=blitz",
+			"/api/games/user/someone?clocks=true&evals=true&perfType=blitz&since=1704067200000"},
+		{"lichess:@/someone?since=1704067200000&evals=false",
+			"/api/games/user/someone?clocks=true&evals=false&since=1704067200000"},
+	}
+
+	for _, test := range tests {
+		if readPgnSource(t, test.src) != expected {
+			t.Fatalf("unexpected content from %v", test.src)
+		}
+		got := standIn.requests[len(standIn.requests)-1]
+		if got != test.request {
+			t.Fatalf("expected %v to request %v but got %v", test.src,
+				test.request, got)
+		}
+		accept := standIn.headers[len(standIn.headers)-1].Get("Accept")
+		if accept != "application/x-chess-pgn" {
+			t.Fatalf("unexpected Accept header %v for %v", accept, test.src)
+		}
+	}
+}
+
+func TestOpenPgnLichessMalformed(t *testing.T) {
+	standIn := newLichessStandIn(t)
+	defer standIn.Close()
+
+	for _, src := range []string{"https://lichess.org/",
+		"https://lichess.org/abc", "https://lichess.org/study/abc",
+		"https://lichess.org/broadcast/some-event", "lichess:someone",
+		"lichess:@/", "lichess:@/someone?since=yesterday"} {
+
+		_, err := OpenPgn(src)
+		if err == nil {
+			t.Fatalf("expected an error for %v", src)
+		}
+	}
+	if len(standIn.requests) != 0 {
+		t.Fatalf("expected malformed urls to be rejected before fetching")
+	}
+}
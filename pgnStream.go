@@ -0,0 +1,317 @@
+package chesstools
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/corentings/chess/v2"
+)
+
+// PgnParseError describes a game which could not be parsed
+type PgnParseError struct {
+	Name    string
+	GameNum int
+	Offset  int64
+	Err     error
+}
+
+func (e *PgnParseError) Error() string {
+	return fmt.Sprintf("%v#%v (byte offset %v): %v", e.Name, e.GameNum,
+		e.Offset, e.Err)
+}
+
+func (e *PgnParseError) Unwrap() error {
+	return e.Err
+}
+
+// PgnStream reads games one at a time from a PGN source of any size. unlike
+// chess.Scanner it tracks where each game starts and, unless strict, skips
+// games which fail to parse after reporting them so that one malformed game
+// doesn't abort a multi-gigabyte database.
+type PgnStream struct {
+	reader           *bufio.Reader
+	name             string
+	strict           bool
+	expandVariations bool
+	errOutput        io.Writer
+
+	offset     int64 // bytes consumed from reader
+	rawGameNum int
+	eof        bool
+	peekedLine string // first line of the next game
+	havePeeked bool
+	pending    []*chess.Game
+	pendingErr error
+	skipped    int
+
+	// describe the game most recently returned by ParseNext()
+	gameNum    int
+	gameOffset int64
+	raw        string
+
+	// raw game read ahead of the game returned by the current HasNext()
+	nextGameNum    int
+	nextGameOffset int64
+	nextRaw        string
+}
+
+func NewPgnStream(r io.Reader, name string) *PgnStream {
+	return &PgnStream{
+		reader:    bufio.NewReaderSize(r, 1024*1024),
+		name:      name,
+		strict:    false,
+		errOutput: os.Stderr,
+		pending:   make([]*chess.Game, 0),
+	}
+}
+
+// WithStrict makes the first malformed game an error returned by
+// ParseNext() rather than being reported and skipped
+func (s *PgnStream) WithStrict(strictIn bool) *PgnStream {
+	s.strict = strictIn
+
+	return s
+}
+
+// WithExpandVariations returns each variation of a game as its own game
+// just like chess.WithExpandVariations()
+func (s *PgnStream) WithExpandVariations(expandVariationsIn bool) *PgnStream {
+	s.expandVariations = expandVariationsIn
+
+	return s
+}
+
+// WithErrorOutput sets where skipped games are reported; defaults to stderr
+func (s *PgnStream) WithErrorOutput(errOutputIn io.Writer) *PgnStream {
+	s.errOutput = errOutputIn
+
+	return s
+}
+
+func (s *PgnStream) HasNext() bool {
+	for len(s.pending) == 0 && s.pendingErr == nil {
+		raw, gameNum, offset, err := s.readRawGame()
+		if err != nil {
+			if err != io.EOF {
+				s.pendingErr = fmt.Errorf("Failed to read %v: %w", s.name, err)
+				return true
+			}
+			return false
+		}
+
+		games, err := parseRawGame(raw)
+		if err != nil {
+			parseErr := &PgnParseError{
+				Name:    s.name,
+				GameNum: gameNum,
+				Offset:  offset,
+				Err:     err,
+			}
+			if s.strict {
+				s.pendingErr = parseErr
+				break
+			}
+			fmt.Fprintf(s.errOutput, "Skipping malformed game %v\n", parseErr)
+			s.skipped++
+			continue
+		}
+		s.pending = s.expand(games)
+		s.nextRaw = raw
+		s.nextGameNum = gameNum
+		s.nextGameOffset = offset
+	}
+
+	return true
+}
+
+func (s *PgnStream) ParseNext() (*chess.Game, error) {
+	if len(s.pending) == 0 && s.pendingErr == nil && !s.HasNext() {
+		return nil, io.EOF
+	}
+	if len(s.pending) == 0 {
+		err := s.pendingErr
+		s.pendingErr = nil
+		return nil, err
+	}
+
+	g := s.pending[0]
+	s.pending = s.pending[1:]
+	s.raw = s.nextRaw
+	s.gameNum = s.nextGameNum
+	s.gameOffset = s.nextGameOffset
+
+	return g, nil
+}
+
+// GameNum is the 1-based position within the source of the game most
+// recently returned by ParseNext(), counting malformed games. expanded
+// variations share their game's number.
+func (s *PgnStream) GameNum() int {
+	return s.gameNum
+}
+
+// Offset is the byte offset within the source of the game most recently
+// returned by ParseNext()
+func (s *PgnStream) Offset() int64 {
+	return s.gameOffset
+}
+
+// Raw is the unmodified PGN text of the game most recently returned by
+// ParseNext()
+func (s *PgnStream) Raw() string {
+	return s.raw
+}
+
+// Skipped is the number of malformed games skipped so far
+func (s *PgnStream) Skipped() int {
+	return s.skipped
+}
+
+// parseRawGame converts parser panics into errors since a malformed game
+// should never take down a whole run
+func parseRawGame(raw string) (games []*chess.Game, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			games = nil
+			err = fmt.Errorf("parser panic: %v", r)
+		}
+	}()
+
+	tokens, err := chess.TokenizeGame(&chess.GameScanned{Raw: raw})
+	if err != nil {
+		return nil, err
+	}
+	g, err := chess.NewParser(tokens).Parse()
+	if err != nil {
+		return nil, err
+	}
+	cacheTags(g, tokenTags(tokens))
+
+	return []*chess.Game{g}, nil
+}
+
+// tokenTags returns the tags of a tokenized game in the order they were
+// read. a repeated tag keeps its first position and its last value as it
+// does in the parsed game.
+func tokenTags(tokens []chess.Token) []PgnTag {
+	tags := make([]PgnTag, 0)
+	index := make(map[string]int)
+	for ii := 0; ii+1 < len(tokens); ii++ {
+		if tokens[ii].Type != chess.TagKey ||
+			tokens[ii+1].Type != chess.TagValue {
+			continue
+		}
+		tag := PgnTag{Key: tokens[ii].Value, Value: tokens[ii+1].Value}
+		idx, ok := index[tag.Key]
+		if ok {
+			tags[idx] = tag
+			continue
+		}
+		index[tag.Key] = len(tags)
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+// splitGame is chess.Game.Split() for parsed games; each line keeps the
+// tags cached for g
+func splitGame(g *chess.Game) []*chess.Game {
+	lines := g.Split()
+	tags, ok := cachedTags(g)
+	if ok {
+		for _, line := range lines {
+			cacheTags(line, tags)
+		}
+	}
+
+	return lines
+}
+
+func (s *PgnStream) expand(games []*chess.Game) []*chess.Game {
+	if !s.expandVariations || len(games) != 1 {
+		return games
+	}
+
+	return splitGame(games[0])
+}
+
+// readRawGame returns the text of the next game along with its number and
+// byte offset. a game ends where a tag line follows movetext; braces are
+// tracked so a line within a multi-line comment that happens to begin with
+// '[' isn't mistaken for a tag.
+func (s *PgnStream) readRawGame() (string, int, int64, error) {
+	var sb strings.Builder
+	var gameOffset int64 = -1
+	inMovetext := false
+	inComment := false
+
+	for s.havePeeked || !s.eof {
+		var line string
+		if s.havePeeked {
+			line = s.peekedLine
+			s.havePeeked = false
+		} else {
+			var err error
+			line, err = s.reader.ReadString('\n')
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					return "", 0, 0, err
+				}
+				s.eof = true
+			}
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if !inComment && inMovetext && strings.HasPrefix(trimmed, "[") {
+			// start of the next game; leave it for the next call
+			s.peekedLine = line
+			s.havePeeked = true
+			break
+		}
+		if gameOffset == -1 && trimmed != "" {
+			gameOffset = s.offset
+		}
+		s.offset += int64(len(line))
+		if gameOffset == -1 {
+			continue
+		}
+
+		if inComment || (trimmed != "" && !strings.HasPrefix(trimmed, "[") &&
+			!strings.HasPrefix(trimmed, "%")) {
+			inMovetext = true
+		}
+		inComment = updateCommentState(trimmed, inComment)
+		sb.WriteString(line)
+	}
+
+	if gameOffset == -1 {
+		return "", 0, 0, io.EOF
+	}
+	s.rawGameNum++
+
+	return strings.TrimSpace(sb.String()), s.rawGameNum, gameOffset, nil
+}
+
+func updateCommentState(line string, inComment bool) bool {
+	for _, ch := range line {
+		if inComment {
+			if ch == '}' {
+				inComment = false
+			}
+			continue
+		}
+		if ch == '{' {
+			inComment = true
+		} else if ch == ';' {
+			// rest of line comment
+			break
+		}
+	}
+
+	return inComment
+}
@@ -0,0 +1,136 @@
+package chesstools
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/corentings/chess/v2"
+)
+
+const streamTestPgn = `[Event "one"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 { a comment which
+[spans] lines } Nc6 1-0
+
+[Event "two"]
+[Result "*"]
+
+1. e4 e5 2. Ke3 *
+
+[Event "three"]
+[Result "0-1"]
+
+1. d4 d5 (1... Nf6 2. c4) 2. c4 0-1
+`
+
+func TestPgnStreamSkipsMalformed(t *testing.T) {
+	var errBuf bytes.Buffer
+	s := NewPgnStream(strings.NewReader(streamTestPgn), "test.pgn").WithErrorOutput(&errBuf)
+
+	events := make([]string, 0)
+	gameNums := make([]int, 0)
+	for s.HasNext() {
+		g, err := s.ParseNext()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		event := g.GetTagPair("Event")
+		events = append(events, event)
+		gameNums = append(gameNums, s.GameNum())
+		if s.Offset() != int64(strings.Index(streamTestPgn, "[Event \""+event)) {
+			t.Fatalf("unexpected offset %v for game %v", s.Offset(), event)
+		}
+		if !strings.HasPrefix(s.Raw(), "[Event \""+event) {
+			t.Fatalf("unexpected raw text %v", s.Raw())
+		}
+	}
+
+	if strings.Join(events, ",") != "one,three" {
+		t.Fatalf("unexpected games %v", events)
+	}
+	if gameNums[0] != 1 || gameNums[1] != 3 {
+		t.Fatalf("unexpected game numbers %v", gameNums)
+	}
+	if s.Skipped() != 1 {
+		t.Fatalf("expected 1 skipped game but got %v", s.Skipped())
+	}
+	expected := fmt.Sprintf("test.pgn#2 (byte offset %v)",
+		strings.Index(streamTestPgn, "[Event \"two"))
+	if !strings.Contains(errBuf.String(), expected) {
+		t.Fatalf("expected %v in %v", expected, errBuf.String())
+	}
+}
+
+func TestPgnStreamStrict(t *testing.T) {
+	s := NewPgnStream(strings.NewReader(streamTestPgn), "test.pgn").WithStrict(true)
+
+	numGames := 0
+	var parseErr *PgnParseError
+	for s.HasNext() {
+		_, err := s.ParseNext()
+		if err != nil {
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected a PgnParseError but got %v", err)
+			}
+			break
+		}
+		numGames++
+	}
+	if numGames != 1 || parseErr == nil || parseErr.GameNum != 2 {
+		t.Fatalf("expected to stop at game 2 after 1 game but got %v %v",
+			numGames, parseErr)
+	}
+}
+
+func TestPgnStreamExpandVariations(t *testing.T) {
+	s := NewPgnStream(strings.NewReader(streamTestPgn), "test.pgn").WithExpandVariations(true).WithErrorOutput(&bytes.Buffer{})
+
+	numGames := 0
+	for s.HasNext() {
+		_, err := s.ParseNext()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		numGames++
+	}
+	if numGames != 3 {
+		t.Fatalf("expected 3 games including the variation but got %v", numGames)
+	}
+}
+
+// games should come out the same as they do from chess.Scanner
+func TestPgnStreamMatchesScanner(t *testing.T) {
+	data, err := os.ReadFile(testPgnFile)
+	if err != nil {
+		t.Fatalf("failed to read %v: %v", testPgnFile, err)
+	}
+
+	expected := make([]string, 0)
+	scanner := chess.NewScanner(bytes.NewReader(data))
+	for scanner.HasNext() {
+		g, err := scanner.ParseNext()
+		if err != nil {
+			t.Fatalf("scanner failed: %v", err)
+		}
+		expected = append(expected, g.String())
+	}
+
+	got := make([]string, 0)
+	s := NewPgnStream(bytes.NewReader(data), testPgnFile).WithStrict(true)
+	for s.HasNext() {
+		g, err := s.ParseNext()
+		if err != nil {
+			t.Fatalf("stream failed: %v", err)
+		}
+		got = append(got, g.String())
+	}
+
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected:\n%v\ngot:\n%v", expected, got)
+	}
+}
@@ -0,0 +1,438 @@
+package chesstools
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"weak"
+
+	"github.com/corentings/chess/v2"
+)
+
+const DefaultPgnLineWidth = 80
+
+// SevenTagRoster lists the tags which PGN requires, in the order PGN
+// requires them to appear
+var SevenTagRoster = []string{"Event", "Site", "Date", "Round", "White",
+	"Black", "Result"}
+
+type PgnTag struct {
+	Key   string
+	Value string
+}
+
+// PgnWriter serializes games in PGN export format: seven tag roster first,
+// movetext wrapped to a fixed width, and comments, NAGs, commands such as
+// [%clk] and [%eval], and nested variations all preserved
+type PgnWriter struct {
+	lineWidth int
+}
+
+func NewPgnWriter() *PgnWriter {
+	return &PgnWriter{
+		lineWidth: DefaultPgnLineWidth,
+	}
+}
+
+// WithLineWidth sets the maximum movetext line length; 0 disables wrapping
+func (w *PgnWriter) WithLineWidth(lineWidthIn int) *PgnWriter {
+	w.lineWidth = lineWidthIn
+
+	return w
+}
+
+// GameString returns g as PGN followed by a newline
+func (w *PgnWriter) GameString(g *chess.Game) string {
+	var sb strings.Builder
+	w.WriteGame(&sb, g)
+
+	return sb.String()
+}
+
+func (w *PgnWriter) WriteGame(out io.Writer, g *chess.Game) error {
+	return w.WriteGameWithTags(out, GameTags(g), g)
+}
+
+// WriteGameWithTags writes g using tags in place of g's own tags
+func (w *PgnWriter) WriteGameWithTags(out io.Writer, tags []PgnTag,
+	g *chess.Game) error {
+
+	err := w.WriteTags(out, tags)
+	if err != nil {
+		return err
+	}
+	if len(tags) > 0 {
+		_, err = io.WriteString(out, "\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	result := "*"
+	for _, tag := range tags {
+		if tag.Key == "Result" && tag.Value != "" {
+			result = tag.Value
+		}
+	}
+	atoms := moveTreeAtoms(g.GetRootMove())
+	atoms = append(atoms, result)
+
+	return w.writeAtoms(out, atoms)
+}
+
+// WriteTags writes tags with the seven tag roster first; other tags keep
+// their relative order
+func (w *PgnWriter) WriteTags(out io.Writer, tags []PgnTag) error {
+	for _, tag := range SortTags(tags) {
+		_, err := fmt.Fprintf(out, "[%v \"%v\"]\n", tag.Key,
+			escapeTagValue(tag.Value))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteMovetext wraps already rendered movetext, e.g. "1. e4 { [%eval
+// 0.3] } e5", and terminates it with result
+func (w *PgnWriter) WriteMovetext(out io.Writer, movetext string,
+	result string) error {
+
+	atoms := movetextAtoms(movetext)
+	atoms = append(atoms, result)
+
+	return w.writeAtoms(out, atoms)
+}
+
+func (w *PgnWriter) writeAtoms(out io.Writer, atoms []string) error {
+	var sb strings.Builder
+	lineLen := 0
+
+	for _, atom := range atoms {
+		if lineLen > 0 {
+			if w.lineWidth > 0 && lineLen+1+len(atom) > w.lineWidth {
+				sb.WriteString("\n")
+				lineLen = 0
+			} else {
+				sb.WriteString(" ")
+				lineLen++
+			}
+		}
+		sb.WriteString(atom)
+		lineLen += len(atom)
+	}
+	sb.WriteString("\n")
+
+	_, err := io.WriteString(out, sb.String())
+	return err
+}
+
+// SortTags orders tags for export: the seven tag roster first, in roster
+// order, followed by all other tags in their original order
+func SortTags(tags []PgnTag) []PgnTag {
+	sorted := make([]PgnTag, 0, len(tags))
+	for _, key := range SevenTagRoster {
+		for _, tag := range tags {
+			if tag.Key == key {
+				sorted = append(sorted, tag)
+				break
+			}
+		}
+	}
+	for _, tag := range tags {
+		if !isRosterTag(tag.Key) {
+			sorted = append(sorted, tag)
+		}
+	}
+
+	return sorted
+}
+
+func isRosterTag(key string) bool {
+	for _, rosterKey := range SevenTagRoster {
+		if key == rosterKey {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TagsFromMap converts a tag map to a slice, taking tags listed in order
+// first and any remaining tags alphabetically
+func TagsFromMap(tagMap map[string]string, order ...string) []PgnTag {
+	tags := make([]PgnTag, 0, len(tagMap))
+	seen := make(map[string]bool)
+	for _, key := range order {
+		val, ok := tagMap[key]
+		if !ok || val == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		tags = append(tags, PgnTag{Key: key, Value: val})
+	}
+
+	rest := make([]string, 0)
+	for key, val := range tagMap {
+		if !seen[key] && val != "" {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	for _, key := range rest {
+		tags = append(tags, PgnTag{Key: key, Value: tagMap[key]})
+	}
+
+	return tags
+}
+
+// GameTags returns g's tags in the order they were read, followed by any
+// missing seven tag roster tags with the placeholder values PGN requires
+func GameTags(g *chess.Game) []PgnTag {
+	tags, ok := cachedTags(g)
+	if !ok {
+		tags = renderedTags(g)
+	}
+
+	for _, key := range SevenTagRoster {
+		if tagIndex(tags, key) == -1 {
+			tags = append(tags, PgnTag{Key: key, Value: rosterPlaceholder(g,
+				key)})
+		}
+	}
+
+	return tags
+}
+
+func tagIndex(tags []PgnTag, key string) int {
+	for ii, tag := range tags {
+		if tag.Key == key {
+			return ii
+		}
+	}
+
+	return -1
+}
+
+func rosterPlaceholder(g *chess.Game, key string) string {
+	switch key {
+	case "Date":
+		return "????.??.??"
+	case "Result":
+		return string(g.Outcome())
+	}
+
+	return "?"
+}
+
+// the chess package has no way to list a game's tags, so the tags of each
+// game parsed by parseRawGame() are cached here until the game is garbage
+// collected
+var parsedTags sync.Map // weak.Pointer[chess.Game] -> []PgnTag
+
+func cacheTags(g *chess.Game, tags []PgnTag) {
+	wp := weak.Make(g)
+	parsedTags.Store(wp, tags)
+	runtime.AddCleanup(g, func(wp weak.Pointer[chess.Game]) {
+		parsedTags.Delete(wp)
+	}, wp)
+}
+
+// cachedTags returns a copy of g's cached tags provided they still match
+// its own; a game whose tags changed since it was parsed has to be rendered
+// to recover them
+func cachedTags(g *chess.Game) ([]PgnTag, bool) {
+	cached, ok := parsedTags.Load(weak.Make(g))
+	if !ok {
+		return nil, false
+	}
+	tags := slices.Clone(cached.([]PgnTag))
+	for _, tag := range tags {
+		if g.GetTagPair(tag.Key) != tag.Value {
+			return nil, false
+		}
+	}
+
+	return tags, true
+}
+
+// renderedTags recovers the tags of a game built in code or parsed
+// elsewhere from chess.Game.String(), the only place the chess package
+// exposes the full set
+func renderedTags(g *chess.Game) []PgnTag {
+	tags := make([]PgnTag, 0)
+
+	for _, line := range strings.Split(g.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "\"]") {
+			break
+		}
+		spaceIdx := strings.Index(line, " \"")
+		if spaceIdx == -1 {
+			break
+		}
+		tags = append(tags, PgnTag{
+			Key:   line[1:spaceIdx],
+			Value: unescapeTagValue(line[spaceIdx+2 : len(line)-2]),
+		})
+	}
+
+	return tags
+}
+
+func escapeTagValue(val string) string {
+	val = strings.ReplaceAll(val, "\\", "\\\\")
+
+	return strings.ReplaceAll(val, "\"", "\\\"")
+}
+
+func unescapeTagValue(val string) string {
+	var sb strings.Builder
+	escaped := false
+	for _, ch := range val {
+		if ch == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		sb.WriteRune(ch)
+	}
+
+	return sb.String()
+}
+
+// the chess package keeps suffix annotations such as !? as given; export
+// format requires numeric NAGs
+var nagSymbols = map[string]string{
+	"!":  "$1",
+	"?":  "$2",
+	"!!": "$3",
+	"??": "$4",
+	"!?": "$5",
+	"?!": "$6",
+}
+
+func nagAtom(nag string) string {
+	if numeric, ok := nagSymbols[nag]; ok {
+		return numeric
+	}
+
+	return nag
+}
+
+// commentAtoms splits comment blocks into words so that long comments wrap;
+// commands such as [%clk 0:01:00] are kept whole
+func commentAtoms(blocks []chess.CommentBlock) []string {
+	atoms := make([]string, 0)
+
+	for _, block := range blocks {
+		items := make([]string, 0)
+		for _, item := range block.Items {
+			switch item.Kind {
+			case chess.CommentText:
+				items = append(items, strings.Fields(item.Text)...)
+			case chess.CommentCommand:
+				items = append(items, fmt.Sprintf("[%%%v %v]", item.Key,
+					strings.TrimSpace(item.Value)))
+			}
+		}
+		if len(items) == 0 {
+			continue
+		}
+		items[0] = "{ " + items[0]
+		items[len(items)-1] += " }"
+		atoms = append(atoms, items...)
+	}
+
+	return atoms
+}
+
+func moveTreeAtoms(root *chess.Move) []string {
+	atoms := commentAtoms(root.CommentBlocks())
+	if len(root.Children()) == 0 {
+		return atoms
+	}
+
+	return lineAtoms(atoms, root.Children()[0], true)
+}
+
+// lineAtoms appends mv and the moves following it, including variations
+// branching from the line, to atoms. a black move gets a move number when
+// it follows a comment or variation or starts a line.
+func lineAtoms(atoms []string, mv *chess.Move, forceNumber bool) []string {
+	for mv != nil {
+		parent := mv.Parent()
+		pos := parent.Position()
+		san := chess.AlgebraicNotation{}.Encode(pos, mv)
+		fenFields := strings.Fields(pos.XFENString())
+		moveNum := fenFields[len(fenFields)-1]
+
+		if pos.Turn() == chess.White {
+			atoms = append(atoms, fmt.Sprintf("%v. %v", moveNum, san))
+		} else if forceNumber {
+			atoms = append(atoms, fmt.Sprintf("%v... %v", moveNum, san))
+		} else {
+			atoms = append(atoms, san)
+		}
+		if mv.NAG() != "" {
+			atoms = append(atoms, nagAtom(mv.NAG()))
+		}
+		comments := commentAtoms(mv.CommentBlocks())
+		atoms = append(atoms, comments...)
+		forceNumber = len(comments) > 0
+
+		siblings := parent.Children()
+		if len(siblings) > 1 && siblings[0] == mv {
+			for _, variation := range siblings[1:] {
+				varAtoms := lineAtoms(make([]string, 0), variation, true)
+				varAtoms[0] = "(" + varAtoms[0]
+				varAtoms[len(varAtoms)-1] += ")"
+				atoms = append(atoms, varAtoms...)
+			}
+			forceNumber = true
+		}
+
+		if len(mv.Children()) == 0 {
+			break
+		}
+		mv = mv.Children()[0]
+	}
+
+	return atoms
+}
+
+// movetextAtoms splits rendered movetext into atoms, keeping a move number
+// with its move and commands whole
+func movetextAtoms(movetext string) []string {
+	atoms := make([]string, 0)
+	words := strings.Fields(movetext)
+
+	for ii := 0; ii < len(words); ii++ {
+		word := words[ii]
+		if strings.HasPrefix(word, "[%") && !strings.HasSuffix(word, "]") {
+			for ii+1 < len(words) && !strings.HasSuffix(word, "]") {
+				ii++
+				word += " " + words[ii]
+			}
+		} else if strings.HasSuffix(word, ".") && ii+1 < len(words) &&
+			strings.Trim(word, "0123456789.(") == "" {
+			ii++
+			word += " " + words[ii]
+		}
+		// keep braces with the comment they delimit and a closing paren
+		// with the variation
+		if len(atoms) > 0 && (word == "}" || word == ")" ||
+			atoms[len(atoms)-1] == "{") {
+			atoms[len(atoms)-1] += " " + word
+			continue
+		}
+		atoms = append(atoms, word)
+	}
+
+	return atoms
+}
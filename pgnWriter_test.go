@@ -0,0 +1,141 @@
+package chesstools
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/corentings/chess/v2"
+)
+
+const annotatedPgn = `[Annotator "someone"]
+[Black "bob"]
+[Event "Annotated"]
+[Result "1-0"]
+[White "alice"]
+[WhiteElo "2000"]
+
+{ A short game } 1. e4 $1 { [%clk 0:05:00] [%eval 0.30] } 1... e5 { [%clk 0:04:58] }
+2. Nf3 Nc6 (2... d6 { Philidor } 3. d4 (3. Bc4 Be7) 3... Nf6) (2... Nf6 { Petroff, a
+very solid defence which has been played at the highest levels for a very long time }) 3. Bb5 ?! a6 1-0
+`
+
+func parseOnePgn(t *testing.T, pgn string) *chess.Game {
+	pgnReader, err := chess.PGN(strings.NewReader(pgn))
+	if err != nil {
+		t.Fatalf("failed to parse pgn: %v\n%v", err, pgn)
+	}
+
+	return chess.NewGame(pgnReader)
+}
+
+func TestPgnWriterRoundTrip(t *testing.T) {
+	g := parseOnePgn(t, annotatedPgn)
+	out := NewPgnWriter().GameString(g)
+
+	expected := `[Event "Annotated"]
+[Site "?"]
+[Date "????.??.??"]
+[Round "?"]
+[White "alice"]
+[Black "bob"]
+[Result "1-0"]
+[Annotator "someone"]
+[WhiteElo "2000"]
+
+{ A short game } 1. e4 $1 { [%clk 0:05:00] [%eval 0.30] } 1... e5
+{ [%clk 0:04:58] } 2. Nf3 Nc6 (2... d6 { Philidor } 3. d4 (3. Bc4 Be7) 3... Nf6)
+(2... Nf6 { Petroff, a very solid defence which has been played at the highest
+levels for a very long time }) 3. Bb5 $6 a6 1-0
+`
+	if out != expected {
+		t.Fatalf("expected:\n%v\ngot:\n%v", expected, out)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if len(line) > DefaultPgnLineWidth {
+			t.Fatalf("line exceeds %v columns: %v", DefaultPgnLineWidth, line)
+		}
+	}
+
+	// writing what was written should be stable
+	again := NewPgnWriter().GameString(parseOnePgn(t, out))
+	if again != out {
+		t.Fatalf("output changed on second pass:\n%v\n%v", out, again)
+	}
+}
+
+func TestGameTags(t *testing.T) {
+	games, err := parseRawGame(`[Event "e"]
+[WhiteElo "2000"]
+[BlackElo "1900"]
+[ECO "C20"]
+[Result "1-0"]
+
+1. e4 e5 (1... c5) 1-0`)
+	if err != nil {
+		t.Fatalf("parseRawGame failed: %v", err)
+	}
+
+	// non-roster tags keep the order they were read in
+	expected := []PgnTag{{"Event", "e"}, {"WhiteElo", "2000"},
+		{"BlackElo", "1900"}, {"ECO", "C20"}, {"Result", "1-0"},
+		{"Site", "?"}, {"Date", "????.??.??"}, {"Round", "?"}, {"White", "?"},
+		{"Black", "?"}}
+	for _, g := range append(games, splitGame(games[0])...) {
+		tags := GameTags(g)
+		if !slices.Equal(tags, expected) {
+			t.Fatalf("expected %v but got %v", expected, tags)
+		}
+	}
+
+	// a tag changed after parsing is picked up
+	games[0].AddTagPair("Event", "changed")
+	if GameTags(games[0])[0] != (PgnTag{"Event", "changed"}) {
+		t.Fatalf("unexpected tags %v", GameTags(games[0]))
+	}
+
+	g := chess.NewGame()
+	expected = []PgnTag{{"Event", "?"}, {"Site", "?"},
+		{"Date", "????.??.??"}, {"Round", "?"}, {"White", "?"},
+		{"Black", "?"}, {"Result", "*"}}
+	if !slices.Equal(GameTags(g), expected) {
+		t.Fatalf("expected %v but got %v", expected, GameTags(g))
+	}
+}
+
+func TestPgnWriterSetUp(t *testing.T) {
+	g := parseOnePgn(t, `[FEN "8/8/4k3/8/4P3/4K3/8/8 b - - 0 40"]
+[SetUp "1"]
+
+40... Kd6 41. Kd4 *`)
+	out := NewPgnWriter().WithLineWidth(0).GameString(g)
+	if !strings.HasSuffix(out, "\n\n40... Kd6 41. Kd4 *\n") {
+		t.Fatalf("unexpected movetext:\n%v", out)
+	}
+}
+
+func TestPgnWriterTags(t *testing.T) {
+	tags := TagsFromMap(map[string]string{"ECO": "B20", "White": "a",
+		"Event": "e", "Result": "*", "Annotator": "x", "Opening": ""},
+		"Event", "Annotator", "White")
+
+	var buf bytes.Buffer
+	w := NewPgnWriter().WithLineWidth(20)
+	w.WriteTags(&buf, tags)
+	w.WriteMovetext(&buf, "1. e4 { [%eval 0.3] } 1... c5 2. Nf3 d6 3. d4", "*")
+
+	expected := `[Event "e"]
+[White "a"]
+[Result "*"]
+[Annotator "x"]
+[ECO "B20"]
+1. e4
+{ [%eval 0.3] }
+1... c5 2. Nf3 d6
+3. d4 *
+`
+	if buf.String() != expected {
+		t.Fatalf("expected:\n%v\ngot:\n%v", expected, buf.String())
+	}
+}